@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tagphi/czdb-search-golang/pkg/builder"
+)
+
+// runBuild 从按地址升序排列的CSV生成加密的CZDB数据库
+func runBuild(args []string) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	input := fs.String("i", "-", "Input CSV file ('-' for stdin): start_ip,end_ip,<columns...>,other")
+	output := fs.String("o", "", "Output CZDB database file")
+	key := fs.String("k", "", "Base64 encoded key for encryption")
+	clientId := fs.Int("client-id", 0, "Client ID written to the encrypted block (0-4095)")
+	expires := fs.Int("expires", 991231, "Expiration date written to the encrypted block, in yymmdd form")
+	randomSize := fs.Int("random-size", 0, "Size of the random padding after the encrypted block (0 for random)")
+	pageSize := fs.Int("page-size", builder.DefaultHeaderPageSize, "Number of index blocks covered by each header entry")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *output == "" || *key == "" {
+		return fatalf("output file (-o) and key (-k) are required")
+	}
+
+	dbBuilder, err := builder.New(builder.Config{
+		Key:            *key,
+		ClientId:       int32(*clientId),
+		ExpirationDate: int32(*expires),
+		RandomSize:     *randomSize,
+		HeaderPageSize: *pageSize,
+	})
+	if err != nil {
+		return fatalf("%v", err)
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return fatalf("opening input file: %v", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	count, err := dbBuilder.AddCSV(r)
+	if err != nil {
+		return fatalf("reading %s: %v", *input, err)
+	}
+	if err := dbBuilder.WriteFile(*output); err != nil {
+		return fatalf("%v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Built %s with %d records\n", *output, count)
+	return 0
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+)
+
+// runCheckKey 检查密钥是否与数据库文件匹配
+//
+// 密钥匹配时退出码为 0，密钥错误时为 1，文件无法读取或损坏时为 2。
+func runCheckKey(args []string) int {
+	fs := flag.NewFlagSet("check-key", flag.ContinueOnError)
+	path := fs.String("p", "", "Path to CZDB database file")
+	key := fs.String("k", "", "Base64 encoded key for decryption")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *path == "" || *key == "" {
+		fatalf("database path (-p) and key (-k) are required")
+		return 2
+	}
+
+	err := db.CheckKey(*path, *key)
+	if errors.Is(err, db.ErrWrongKey) {
+		fmt.Fprintf(os.Stderr, "Wrong key for %s: %v\n", *path, err)
+		return 1
+	}
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+	fmt.Printf("Key matches %s\n", *path)
+	return 0
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+	"github.com/tagphi/czdb-search-golang/pkg/utils"
+)
+
+// commands 是支持的子命令，返回值为进程退出码
+var commands = map[string]func(args []string) int{
+	"build":      runBuild,
+	"check-key":  runCheckKey,
+	"diff":       runDiff,
+	"enrich-log": runEnrichLog,
+	"export":     runExport,
+	"info":       runInfo,
+	"lookup":     runLookup,
+	"serve":      runServe,
+	"serve-dns":  runServeDNS,
+	"serve-resp": runServeRESP,
+	"verify":     runVerify,
+}
+
+// dbFlags 是各子命令共用的数据库参数
+type dbFlags struct {
+	path    string
+	key     string
+	mode    string
+	expiry  string
+	schema  string
+	columns string
+	cache   int
+	debug   bool
+}
+
+// addDBFlags 在 FlagSet 中注册数据库参数
+func addDBFlags(fs *flag.FlagSet) *dbFlags {
+	flags := &dbFlags{}
+	fs.StringVar(&flags.path, "p", "", "Path to CZDB database file")
+	fs.StringVar(&flags.key, "k", "", "Base64 encoded key for decryption")
+	fs.StringVar(&flags.mode, "m", "btree", "Search mode: 'memory', 'btree' or 'mmap'")
+	fs.StringVar(&flags.expiry, "expiry", "warn", "Handling of an expired database license: 'ignore', 'warn' or 'refuse'")
+	fs.StringVar(&flags.schema, "schema", "", "Comma separated column names in geo map order (default: "+strings.Join(db.DefaultColumnSchema, ",")+")")
+	fs.StringVar(&flags.columns, "select", "", "Comma separated column names to return instead of the file's column selection")
+	fs.IntVar(&flags.cache, "cache", 0, "Number of matched ranges to cache in front of the database (0 disables the cache)")
+	fs.BoolVar(&flags.debug, "debug", false, "Enable debug output (written to stderr)")
+	return flags
+}
+
+// open 检查参数并打开数据库，调试信息和警告输出到标准错误
+func (flags *dbFlags) open() (*db.DBSearcher, error) {
+	opts, err := flags.options()
+	if err != nil {
+		return nil, err
+	}
+	return db.OpenFile(flags.path, flags.key, opts)
+}
+
+// options 检查参数并转换为打开选项，同时设置调试输出
+func (flags *dbFlags) options() (*db.Options, error) {
+	utils.SetDebugOutput(os.Stderr)
+	utils.SetDebugEnabled(flags.debug)
+
+	if flags.path == "" || flags.key == "" {
+		return nil, fmt.Errorf("database path (-p) and key (-k) are required")
+	}
+	expiryPolicy, err := db.ParseExpiryPolicy(flags.expiry)
+	if err != nil {
+		return nil, err
+	}
+	if flags.cache < 0 {
+		return nil, fmt.Errorf("cache size (-cache) must not be negative")
+	}
+	opts := &db.Options{SearchType: parseSearchType(flags.mode), ExpiryPolicy: expiryPolicy, CacheSize: flags.cache}
+	if flags.schema != "" {
+		opts.Schema = splitList(flags.schema)
+	}
+	if flags.columns != "" {
+		opts.Columns = splitList(flags.columns)
+	}
+	return opts, nil
+}
+
+// parseSearchType 将命令行中的搜索模式转换为 SearchType，默认为 BTREE
+func parseSearchType(mode string) db.SearchType {
+	switch strings.ToLower(mode) {
+	case "memory":
+		return db.MEMORY
+	case "mmap":
+		return db.MMAP
+	default:
+		return db.BTREE
+	}
+}
+
+// splitList 按逗号拆分参数值并去掉空白
+func splitList(value string) []string {
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+// createOutput 创建输出文件，path 为 "-" 时输出到标准输出
+//
+// 返回的 closeOutput 关闭文件并返回关闭时的错误，延迟写入的错误 (如网络文件系统空间不足) 可能到关闭时才报告，
+// 因此调用方在写完后必须检查它的返回值；重复调用时不做任何事，可以同时用 defer 在出错时关闭。
+func createOutput(path string) (w io.Writer, closeOutput func() error, err error) {
+	if path == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating output file: %w", err)
+	}
+	closed := false
+	return file, func() error {
+		if closed {
+			return nil
+		}
+		closed = true
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("closing output file: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// readLine 读取一行并去掉末尾的 \n 或 \r\n，行的长度不受限制；输入结束且没有剩余数据时返回 io.EOF
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil && !(err == io.EOF && line != "") {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// fatalf 向标准错误输出错误信息并返回失败的退出码
+func fatalf(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	return 1
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+	"github.com/tagphi/czdb-search-golang/pkg/utils"
+)
+
+// diffJSONEntry 是 jsonl 格式中的一个变化区间
+type diffJSONEntry struct {
+	Kind    string          `json:"kind"`
+	StartIP string          `json:"start_ip"`
+	EndIP   string          `json:"end_ip"`
+	Old     *diffJSONResult `json:"old,omitempty"`
+	New     *diffJSONResult `json:"new,omitempty"`
+}
+
+// diffJSONResult 是变化前后的地理信息
+type diffJSONResult struct {
+	Columns []string `json:"columns"`
+	Other   string   `json:"other"`
+}
+
+// diffJSONSummary 是 jsonl 格式中的统计结果
+type diffJSONSummary struct {
+	Column  int                  `json:"column"`
+	Name    string               `json:"column_name"`
+	Added   int                  `json:"added_ranges"`
+	Removed int                  `json:"removed_ranges"`
+	Changed int                  `json:"changed_ranges"`
+	Total   db.DiffSummaryRow    `json:"total"`
+	Rows    []*db.DiffSummaryRow `json:"rows"`
+}
+
+// runDiff 比较两个版本的数据库，输出新增、删除和地理信息改变的区间及按列值的统计
+//
+// 没有变化时退出码为 0，有变化时为 1，出错时为 2。
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	oldPath := fs.String("old", "", "Path to the old CZDB database file")
+	newPath := fs.String("new", "", "Path to the new CZDB database file")
+	key := fs.String("k", "", "Base64 encoded key for decryption")
+	newKey := fs.String("new-key", "", "Key for the new database file (default: same as -k)")
+	mode := fs.String("m", "btree", "Search mode: 'memory', 'btree' or 'mmap'")
+	format := fs.String("format", "text", "Output format: 'text' or 'jsonl'")
+	output := fs.String("o", "-", "Output file for the changed ranges ('-' for stdout)")
+	by := fs.String("by", "country", "Column name or index to group the summary by, e.g. 'country', 'province' or 1")
+	summaryOnly := fs.Bool("summary-only", false, "Only print the summary, to stdout")
+	debug := fs.Bool("debug", false, "Enable debug output (written to stderr)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	utils.SetDebugOutput(os.Stderr)
+	utils.SetDebugEnabled(*debug)
+	if *oldPath == "" || *newPath == "" || *key == "" {
+		fatalf("old (-old) and new (-new) database paths and key (-k) are required")
+		return 2
+	}
+	if *format != "text" && *format != "jsonl" {
+		fatalf("unsupported output format %q", *format)
+		return 2
+	}
+	if *newKey == "" {
+		newKey = key
+	}
+
+	opts := &db.Options{SearchType: parseSearchType(*mode)}
+	oldSearcher, err := db.OpenFile(*oldPath, *key, opts)
+	if err != nil {
+		fatalf("opening %s: %v", *oldPath, err)
+		return 2
+	}
+	defer db.CloseDBSearcher(oldSearcher)
+	newSearcher, err := db.OpenFile(*newPath, *newKey, opts)
+	if err != nil {
+		fatalf("opening %s: %v", *newPath, err)
+		return 2
+	}
+	defer db.CloseDBSearcher(newSearcher)
+
+	column, err := diffColumn(newSearcher, *by)
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+
+	w, closeOutput, err := createOutput(*output)
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+	defer closeOutput()
+	buf := bufio.NewWriter(w)
+
+	summary := db.NewDiffSummary(column)
+	var writeErr error
+	err = db.Diff(oldSearcher, newSearcher, func(entry db.DiffEntry) bool {
+		summary.Add(entry)
+		if *summaryOnly {
+			return true
+		}
+		writeErr = writeDiffEntry(buf, entry, *format)
+		return writeErr == nil
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err == nil {
+		err = closeOutput()
+	}
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+
+	name := db.ColumnName(newSearcher.Schema, column)
+	if *summaryOnly {
+		err = writeDiffSummary(os.Stdout, summary, name, *format)
+	} else {
+		err = writeDiffSummary(os.Stderr, summary, name, "text")
+	}
+	if err != nil {
+		fatalf("writing summary: %v", err)
+		return 2
+	}
+
+	if len(summary.Counts) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// diffColumn 解析 -by 参数，接受列名称或原始列索引
+func diffColumn(dbSearcher *db.DBSearcher, by string) (int, error) {
+	if index, err := strconv.Atoi(by); err == nil {
+		if index < 0 {
+			return 0, fmt.Errorf("invalid column index %d (-by)", index)
+		}
+		return index, nil
+	}
+	index, err := dbSearcher.ColumnIndex(by)
+	if err != nil {
+		return 0, fmt.Errorf("%w (-by); available columns are %s", err, strings.Join(dbSearcher.AvailableColumns(), ", "))
+	}
+	return index, nil
+}
+
+// writeDiffEntry 写出一个变化区间
+func writeDiffEntry(w io.Writer, entry db.DiffEntry, format string) error {
+	if format == "jsonl" {
+		line, err := json.Marshal(diffJSONEntry{
+			Kind:    entry.Kind.String(),
+			StartIP: entry.Range.Start.String(),
+			EndIP:   entry.Range.End.String(),
+			Old:     newDiffJSONResult(entry.Old),
+			New:     newDiffJSONResult(entry.New),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", line)
+		return err
+	}
+
+	switch entry.Kind {
+	case db.DiffAdded:
+		_, err := fmt.Fprintf(w, "+ %s\t%s\n", entry.Range, formatDiffResult(entry.New))
+		return err
+	case db.DiffRemoved:
+		_, err := fmt.Fprintf(w, "- %s\t%s\n", entry.Range, formatDiffResult(entry.Old))
+		return err
+	default:
+		_, err := fmt.Fprintf(w, "~ %s\t%s -> %s\n", entry.Range, formatDiffResult(entry.Old), formatDiffResult(entry.New))
+		return err
+	}
+}
+
+// newDiffJSONResult 转换地理信息，nil 表示该侧没有记录
+func newDiffJSONResult(result *db.GeoResult) *diffJSONResult {
+	if result == nil {
+		return nil
+	}
+	return &diffJSONResult{Columns: result.Columns, Other: result.OtherData}
+}
+
+// formatDiffResult 以 "列|列|列|other" 的形式输出地理信息
+func formatDiffResult(result *db.GeoResult) string {
+	return strings.Join(append(append([]string(nil), result.Columns...), result.OtherData), "|")
+}
+
+// writeDiffSummary 输出按列值分组的统计，name 为分组列的名称
+func writeDiffSummary(w io.Writer, summary *db.DiffSummary, name string, format string) error {
+	if format == "jsonl" {
+		return json.NewEncoder(w).Encode(diffJSONSummary{
+			Column:  summary.Column,
+			Name:    name,
+			Added:   summary.Counts[db.DiffAdded],
+			Removed: summary.Counts[db.DiffRemoved],
+			Changed: summary.Counts[db.DiffChanged],
+			Total:   summary.Total,
+			Rows:    summary.Rows(),
+		})
+	}
+
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "Ranges: %d added, %d removed, %d changed\n",
+		summary.Counts[db.DiffAdded], summary.Counts[db.DiffRemoved], summary.Counts[db.DiffChanged])
+	// 列值放在最后，避免中文宽度影响对齐
+	fmt.Fprintf(buf, "%20s %20s %20s  %s\n", "added", "removed", "changed", name)
+	for _, row := range summary.Rows() {
+		key := row.Key
+		if key == "" {
+			key = "(empty)"
+		}
+		fmt.Fprintf(buf, "%20s %20s %20s  %s\n", row.Added, row.Removed, row.Changed, key)
+	}
+	fmt.Fprintf(buf, "%20s %20s %20s  %s\n", summary.Total.Added, summary.Total.Removed, summary.Total.Changed, "total")
+	return buf.Flush()
+}
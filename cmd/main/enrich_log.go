@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+	"github.com/tagphi/czdb-search-golang/pkg/enrich"
+)
+
+// maxEnrichLineLength 是解析的日志行的最大长度，更长的行按不匹配处理
+const maxEnrichLineLength = 1024 * 1024
+
+// enrichStats 是日志处理的统计
+type enrichStats struct {
+	total     int
+	found     int
+	notFound  int // 未找到或IP版本与数据库不一致
+	invalid   int // 无法确定客户端IP
+	unmatched int // 与日志格式不匹配
+}
+
+// runEnrichLog 读取标准输入或文件中的访问日志，按客户端IP加入地理字段后输出日志行或 JSON Lines
+//
+// 与日志格式不匹配的行在 line 格式中原样输出，在 jsonl 格式中输出为带 error 的对象，统计输出到标准错误。
+func runEnrichLog(args []string) int {
+	fs := flag.NewFlagSet("enrich-log", flag.ContinueOnError)
+	flags := addDBFlags(fs)
+	logFormat := fs.String("log-format", "combined", "Log format: 'common', 'combined' or an nginx log_format string")
+	format := fs.String("format", "line", "Output format: 'line' (the log line with geo fields added) or 'jsonl'")
+	fields := fs.String("fields", "", "Comma-separated geo fields to add: column names or 'other' (default: selected columns and other)")
+	trustedProxies := fs.String("trusted-proxies", "", "Comma-separated CIDRs or IPs of proxies whose X-Forwarded-For is trusted")
+	clientVar := fs.String("client-var", "remote_addr", "Log format variable holding the client address")
+	forwardedVar := fs.String("forwarded-var", "http_x_forwarded_for", "Log format variable holding the X-Forwarded-For header")
+	insertAfter := fs.String("insert-after", "", "Insert the geo fields after this variable instead of at the end of the line")
+	output := fs.String("o", "-", "Output file ('-' for stdout)")
+	quiet := fs.Bool("q", false, "Do not print the summary to stderr")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s enrich-log [flags] [file ...]\n\nReads access log lines from the files, or stdin if none or '-' is given.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *format != "line" && *format != "jsonl" {
+		fatalf("unsupported output format %q", *format)
+		return 2
+	}
+	parsedFormat, err := enrich.ParseFormat(*logFormat)
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+	proxies, err := enrich.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	for _, input := range inputs {
+		if _, err := os.Stat(input); input != "-" && err != nil {
+			fatalf("%v", err)
+			return 2
+		}
+	}
+
+	dbSearcher, err := flags.open()
+	if err != nil {
+		fatalf("initializing database searcher: %v", err)
+		return 2
+	}
+	defer db.CloseDBSearcher(dbSearcher)
+
+	geoFields, err := parseGeoFields(dbSearcher, *fields)
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+	enricher, err := enrich.New(dbSearcher, parsedFormat, enrich.Options{
+		Fields:            geoFields,
+		ClientVariable:    *clientVar,
+		ForwardedVariable: *forwardedVar,
+		TrustedProxies:    proxies,
+		InsertAfter:       *insertAfter,
+	})
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+
+	w, closeOutput, err := createOutput(*output)
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+	defer closeOutput()
+
+	writer := bufio.NewWriter(w)
+	stats, err := enrichInputs(enricher, inputs, *format == "jsonl", writer)
+	if flushErr := writer.Flush(); err == nil && flushErr != nil {
+		err = fmt.Errorf("writing output: %w", flushErr)
+	}
+	if err == nil {
+		err = closeOutput()
+	}
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "Processed %d lines: %d found, %d not found, %d invalid client IP, %d not matching the log format\n",
+			stats.total, stats.found, stats.notFound, stats.invalid, stats.unmatched)
+	}
+	return 0
+}
+
+// parseGeoFields 解析 -fields 参数，为空时使用选中的列和 other
+//
+// 只能使用选中的列，其他列需要通过 -select 选择。
+func parseGeoFields(dbSearcher *db.DBSearcher, spec string) ([]string, error) {
+	var selected []string
+	for _, index := range db.SelectedColumns(dbSearcher.Selection()) {
+		selected = append(selected, db.ColumnName(dbSearcher.Schema, index))
+	}
+	if strings.TrimSpace(spec) == "" {
+		return append(selected, enrich.OtherField), nil
+	}
+
+	var geoFields []string
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		valid := field == enrich.OtherField
+		for _, name := range selected {
+			valid = valid || name == field
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown geo field %q; selected columns are %s (use -select to choose others)",
+				field, strings.Join(selected, ", "))
+		}
+		geoFields = append(geoFields, field)
+	}
+	return geoFields, nil
+}
+
+// enrichInputs 依次处理各输入中的日志行并写出结果，查询出现未找到以外的错误时返回错误
+func enrichInputs(enricher *enrich.Enricher, inputs []string, jsonLines bool, writer *bufio.Writer) (enrichStats, error) {
+	var stats enrichStats
+	var buf []byte
+	process := func(input string, r io.Reader) error {
+		reader := bufio.NewReaderSize(r, 64*1024)
+		for {
+			line, err := readLine(reader)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", input, err)
+			}
+			if line == "" {
+				continue
+			}
+			stats.total++
+
+			// 过长的行不解析，按不匹配处理并原样输出
+			var entry *enrich.Entry
+			if len(line) > maxEnrichLineLength {
+				err = enrich.ErrNoMatch
+			} else {
+				entry, err = enricher.Enrich(line)
+			}
+			buf = buf[:0]
+			switch {
+			case err != nil:
+				stats.unmatched++
+				if jsonLines {
+					encoded, _ := json.Marshal(line)
+					buf = append(buf, `{"line":`...)
+					buf = append(buf, encoded...)
+					buf = append(buf, `,"error":"log format mismatch"}`...)
+				} else {
+					buf = append(buf, line...)
+				}
+			case entry.Err == nil:
+				stats.found++
+			case errors.Is(entry.Err, db.ErrInvalidIP):
+				stats.invalid++
+			case errors.Is(entry.Err, db.ErrNotFound), errors.Is(entry.Err, db.ErrIPVersionMismatch):
+				stats.notFound++
+			default:
+				return fmt.Errorf("looking up %s: %w", entry.ClientIP, entry.Err)
+			}
+			if err == nil {
+				if jsonLines {
+					buf = enricher.AppendJSON(buf, entry)
+				} else {
+					buf = enricher.AppendLine(buf, entry)
+				}
+			}
+			buf = append(buf, '\n')
+			if _, err := writer.Write(buf); err != nil {
+				return fmt.Errorf("writing output: %w", err)
+			}
+			// 输入暂时没有更多数据时 (如 tail -f 的管道) 立即输出已处理的行
+			if reader.Buffered() == 0 {
+				if err := writer.Flush(); err != nil {
+					return fmt.Errorf("writing output: %w", err)
+				}
+			}
+		}
+	}
+
+	for _, input := range inputs {
+		if input == "-" {
+			if err := process("stdin", os.Stdin); err != nil {
+				return stats, err
+			}
+			continue
+		}
+		file, err := os.Open(input)
+		if err != nil {
+			return stats, err
+		}
+		err = process(input, file)
+		file.Close()
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
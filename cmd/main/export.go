@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+	"github.com/tagphi/czdb-search-golang/pkg/export"
+)
+
+// runExport 将整个数据库导出为 CSV、TSV、JSON Lines 或 MMDB
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags := addDBFlags(fs)
+	format := fs.String("format", "csv", "Output format: 'csv', 'tsv', 'jsonl' or 'mmdb'")
+	output := fs.String("o", "-", "Output file ('-' for stdout)")
+	columns := fs.String("columns", "", "Comma separated header names for the geo columns, in column order")
+	numeric := fs.Bool("numeric", false, "Also emit start_num and end_num columns")
+	noHeader := fs.Bool("no-header", false, "Do not write the CSV/TSV header row")
+	mmdbFields := fs.String("mmdb-fields", "", "MMDB field mapping, e.g. 'country.names.zh-CN=0,city=2,isp=other' (default: one key per column)")
+	mmdbType := fs.String("mmdb-type", "CZDB", "MMDB database_type metadata")
+	mmdbIPv6 := fs.Bool("mmdb-ipv6", false, "Write an IPv4 database into an IPv6 MMDB tree")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	exportFormat, err := export.ParseFormat(*format)
+	if err != nil {
+		return fatalf("%v", err)
+	}
+
+	dbSearcher, err := flags.open()
+	if err != nil {
+		return fatalf("initializing database searcher: %v", err)
+	}
+	defer db.CloseDBSearcher(dbSearcher)
+
+	if exportFormat == export.MMDB && *output == "-" {
+		return fatalf("mmdb output requires an output file (-o)")
+	}
+
+	w, closeOutput, err := createOutput(*output)
+	if err != nil {
+		return fatalf("%v", err)
+	}
+	defer closeOutput()
+
+	var names []string
+	if *columns != "" {
+		names = strings.Split(*columns, ",")
+	}
+
+	if exportFormat == export.MMDB {
+		opts := export.MMDBOptions{DatabaseType: *mmdbType}
+		if *mmdbFields != "" {
+			if opts.Fields, err = export.ParseMMDBFields(*mmdbFields); err != nil {
+				return fatalf("%v", err)
+			}
+		} else {
+			opts.Fields = export.DefaultMMDBFields(db.SelectedColumns(dbSearcher.Selection()), dbSearcher.Schema, names)
+		}
+		if *mmdbIPv6 {
+			opts.IPVersion = 6
+		}
+
+		count, err := export.ExportMMDB(dbSearcher, w, opts)
+		if err != nil {
+			return fatalf("exporting after %d records: %v", count, err)
+		}
+		return finishExport(count, closeOutput)
+	}
+
+	opts := export.Options{
+		Format:   exportFormat,
+		Numeric:  *numeric,
+		NoHeader: *noHeader,
+		Columns:  names,
+		Schema:   dbSearcher.Schema,
+	}
+
+	count, err := export.Export(dbSearcher, w, opts)
+	if err != nil {
+		return fatalf("exporting after %d records: %v", count, err)
+	}
+	return finishExport(count, closeOutput)
+}
+
+// finishExport 关闭输出文件并输出统计，关闭失败时导出的文件可能不完整，退出码为 2
+func finishExport(count int, closeOutput func() error) int {
+	if err := closeOutput(); err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d records\n", count)
+	return 0
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+)
+
+// databaseInfo 是 info 子命令输出的数据库信息
+type databaseInfo struct {
+	Path             string   `json:"path"`
+	FileSize         int64    `json:"file_size"`
+	IPVersion        int      `json:"ip_version"`
+	Version          int32    `json:"version"`
+	ClientId         int32    `json:"client_id"`
+	ExpiresAt        string   `json:"expires_at,omitempty"`
+	DaysUntilExpiry  *int     `json:"days_until_expiry,omitempty"`
+	Expired          bool     `json:"expired"`
+	HeaderEntries    int      `json:"header_entries"`
+	IndexRecords     int      `json:"index_records"`
+	Columns          []string `json:"columns"`
+	AvailableColumns []string `json:"available_columns"`
+	GeoMapSize       int      `json:"geo_map_size"`
+}
+
+// newDatabaseInfo 收集已打开数据库的信息
+func newDatabaseInfo(path string, dbSearcher *db.DBSearcher) databaseInfo {
+	info := databaseInfo{
+		Path:             path,
+		FileSize:         dbSearcher.FileSize,
+		IPVersion:        int(dbSearcher.IPType),
+		Version:          dbSearcher.HyperHeader.Version,
+		ClientId:         dbSearcher.DecryptedBlock.ClientId,
+		Expired:          dbSearcher.Expired(),
+		HeaderEntries:    dbSearcher.BtreeModeParam.HeaderLength,
+		IndexRecords:     int((dbSearcher.EndIndexPtr-dbSearcher.StartIndexPtr)/dbSearcher.IndexLength) + 1,
+		AvailableColumns: dbSearcher.AvailableColumns(),
+		GeoMapSize:       len(dbSearcher.GeoMapData),
+	}
+	info.Columns = []string{}
+	for _, index := range db.SelectedColumns(dbSearcher.Selection()) {
+		info.Columns = append(info.Columns, db.ColumnName(dbSearcher.Schema, index))
+	}
+	if expiresAt := dbSearcher.ExpiresAt(); !expiresAt.IsZero() {
+		days := dbSearcher.DaysUntilExpiry()
+		info.ExpiresAt = expiresAt.Format(time.RFC3339)
+		info.DaysUntilExpiry = &days
+	}
+	return info
+}
+
+// runInfo 输出数据库的基本信息和授权过期日期
+func runInfo(args []string) int {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	flags := addDBFlags(fs)
+	format := fs.String("format", "text", "Output format: 'text' or 'json'")
+	warnDays := fs.Int("warn-days", 30, "Print a warning when the license expires within this many days")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "text" && *format != "json" {
+		return fatalf("unsupported output format %q", *format)
+	}
+
+	// 由 info 自己报告过期状态，打开时不再重复警告
+	flags.expiry = db.ExpiryIgnore.String()
+	dbSearcher, err := flags.open()
+	if err != nil {
+		return fatalf("initializing database searcher: %v", err)
+	}
+	defer db.CloseDBSearcher(dbSearcher)
+
+	info := newDatabaseInfo(flags.path, dbSearcher)
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(info); err != nil {
+			return fatalf("writing info: %v", err)
+		}
+	} else {
+		fmt.Printf("File:           %s (%d bytes)\n", info.Path, info.FileSize)
+		fmt.Printf("IP version:     IPv%d\n", info.IPVersion)
+		fmt.Printf("Version:        %d\n", info.Version)
+		fmt.Printf("Client ID:      %d\n", info.ClientId)
+		if info.DaysUntilExpiry != nil {
+			fmt.Printf("Expires:        %s (%d days left)\n", dbSearcher.ExpiresAt().AddDate(0, 0, -1).Format("2006-01-02"), *info.DaysUntilExpiry)
+		} else {
+			fmt.Printf("Expires:        unknown (invalid date %d)\n", dbSearcher.DecryptedBlock.ExpirationDate)
+		}
+		fmt.Printf("Header entries: %d\n", info.HeaderEntries)
+		fmt.Printf("Index records:  %d\n", info.IndexRecords)
+		fmt.Printf("Columns:        %s\n", strings.Join(info.Columns, ","))
+		fmt.Printf("Available:      %s\n", strings.Join(info.AvailableColumns, ","))
+		fmt.Printf("Geo map size:   %d bytes\n", info.GeoMapSize)
+	}
+
+	if info.Expired {
+		fmt.Fprintf(os.Stderr, "Warning: database license expired %d days ago\n", -*info.DaysUntilExpiry)
+	} else if info.DaysUntilExpiry != nil && *info.DaysUntilExpiry < *warnDays {
+		fmt.Fprintf(os.Stderr, "Warning: database license expires in %d days\n", *info.DaysUntilExpiry)
+	}
+	return 0
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+	"github.com/tagphi/czdb-search-golang/pkg/export"
+)
+
+// lookupChunkSize 是一个任务中的行数，同一任务中的IP通过 SearchBatch 一起查询
+const lookupChunkSize = 256
+
+// lookupChunk 是一批输入行及其查询结果
+type lookupChunk struct {
+	lines   []string
+	results []db.GeoResult
+	errs    []error
+	done    chan struct{} // 查询完成后关闭
+}
+
+// lookupStats 是查询结果的统计
+type lookupStats struct {
+	total    int
+	found    int
+	notFound int // 未找到或IP版本与数据库不一致
+	invalid  int
+}
+
+// runLookup 非交互地查询标准输入或文件中的IP，每行一个，按输入顺序输出 TSV、CSV 或 JSON Lines
+//
+// 每个输出行以原始输入开头，空行和以 # 开头的行被忽略，统计和错误只输出到标准错误。
+// 所有IP都找到时退出码为 0，有IP未找到或无效时为 1，出错时为 2。
+func runLookup(args []string) int {
+	fs := flag.NewFlagSet("lookup", flag.ContinueOnError)
+	flags := addDBFlags(fs)
+	format := fs.String("format", "tsv", "Output format: 'tsv', 'csv' or 'jsonl'")
+	output := fs.String("o", "-", "Output file ('-' for stdout)")
+	workers := fs.Int("workers", 1, "Number of parallel lookup workers; output keeps the input order")
+	noHeader := fs.Bool("no-header", false, "Do not write the CSV/TSV header row")
+	quiet := fs.Bool("q", false, "Do not print the summary to stderr")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s lookup [flags] [file ...]\n\nReads one IP per line from the files, or stdin if none or '-' is given.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	outputFormat, err := export.ParseFormat(*format)
+	if err != nil || outputFormat == export.MMDB {
+		fatalf("unsupported output format %q", *format)
+		return 2
+	}
+	if *workers < 1 {
+		fatalf("number of workers (-workers) must be at least 1")
+		return 2
+	}
+
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	// 在写出任何结果之前检查输入文件，避免输出不完整
+	for _, input := range inputs {
+		if _, err := os.Stat(input); input != "-" && err != nil {
+			fatalf("%v", err)
+			return 2
+		}
+	}
+
+	dbSearcher, err := flags.open()
+	if err != nil {
+		fatalf("initializing database searcher: %v", err)
+		return 2
+	}
+	defer db.CloseDBSearcher(dbSearcher)
+
+	w, closeOutput, err := createOutput(*output)
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+	defer closeOutput()
+
+	var names []string
+	for _, index := range db.SelectedColumns(dbSearcher.Selection()) {
+		names = append(names, db.ColumnName(dbSearcher.Schema, index))
+	}
+	writer := newLookupWriter(w, outputFormat, names)
+	if !*noHeader {
+		if err := writer.writeHeader(); err != nil {
+			fatalf("writing output: %v", err)
+			return 2
+		}
+	}
+
+	stats, err := lookupInputs(dbSearcher, inputs, *workers, writer)
+	if flushErr := writer.flush(); err == nil && flushErr != nil {
+		err = fmt.Errorf("writing output: %w", flushErr)
+	}
+	if err == nil {
+		err = closeOutput()
+	}
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "Looked up %d IPs: %d found, %d not found, %d invalid\n",
+			stats.total, stats.found, stats.notFound, stats.invalid)
+	}
+	if stats.found < stats.total {
+		return 1
+	}
+	return 0
+}
+
+// lookupInputs 读取输入并由 workers 个 goroutine 并行查询，按输入顺序写出结果
+//
+// 读取、查询和写出同时进行：读取的每批输入先按顺序放入 ordered，再交给空闲的 worker 查询，
+// 写出时按 ordered 的顺序等待每批查询完成，因此输出顺序与输入相同，内存占用与 workers 成正比。
+func lookupInputs(dbSearcher *db.DBSearcher, inputs []string, workers int, writer *lookupWriter) (lookupStats, error) {
+	jobs := make(chan *lookupChunk)
+	ordered := make(chan *lookupChunk, workers*2)
+	stop := make(chan struct{})
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for chunk := range jobs {
+				lookupLines(dbSearcher, chunk)
+				close(chunk.done)
+			}
+		}()
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+		readErr <- readLines(inputs, func(lines []string) bool {
+			chunk := &lookupChunk{lines: lines, done: make(chan struct{})}
+			select {
+			case ordered <- chunk:
+			case <-stop:
+				return false
+			}
+			select {
+			case jobs <- chunk:
+			case <-stop:
+				close(chunk.done)
+				return false
+			}
+			return true
+		})
+	}()
+
+	var stats lookupStats
+	var err error
+	for chunk := range ordered {
+		<-chunk.done
+		if err != nil {
+			continue
+		}
+		// 每批写完后立即刷新，在管道中使用时结果不会滞留在缓冲区中
+		if err = writer.writeChunk(chunk, &stats); err == nil {
+			if err = writer.flush(); err != nil {
+				err = fmt.Errorf("writing output: %w", err)
+			}
+		}
+		if err != nil {
+			// 通知读取停止，继续取出已排队的任务直到 ordered 关闭
+			close(stop)
+		}
+	}
+	if readErr := <-readErr; err == nil {
+		err = readErr
+	}
+	return stats, err
+}
+
+// readLines 依次读取各输入中的非空行，每 lookupChunkSize 行调用一次 emit，emit 返回 false 时停止
+//
+// 输入暂时没有更多数据时 (如 tail -f 的管道) 立即用已读取的行调用 emit，不等待凑满一批，
+// 因此在管道中使用时每行的结果会及时输出。
+func readLines(inputs []string, emit func(lines []string) bool) error {
+	lines := make([]string, 0, lookupChunkSize)
+	emitLines := func() bool {
+		if len(lines) == 0 {
+			return true
+		}
+		more := emit(lines)
+		lines = make([]string, 0, lookupChunkSize)
+		return more
+	}
+	scan := func(input string, r io.Reader) (bool, error) {
+		reader := bufio.NewReaderSize(r, 64*1024)
+		for {
+			line, err := readLine(reader)
+			if err == io.EOF {
+				return true, nil
+			}
+			if err != nil {
+				return false, fmt.Errorf("reading %s: %w", input, err)
+			}
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				lines = append(lines, line)
+			}
+			// 缓冲区为空说明再读取可能阻塞
+			if len(lines) == lookupChunkSize || reader.Buffered() == 0 {
+				if !emitLines() {
+					return false, nil
+				}
+			}
+		}
+	}
+
+	for _, input := range inputs {
+		var more bool
+		var err error
+		if input == "-" {
+			more, err = scan("stdin", os.Stdin)
+		} else {
+			file, openErr := os.Open(input)
+			if openErr != nil {
+				return openErr
+			}
+			more, err = scan(input, file)
+			file.Close()
+		}
+		if !more {
+			return err
+		}
+	}
+	emitLines()
+	return nil
+}
+
+// lookupLines 批量查询一批输入行，无法解析的行不参与查询
+func lookupLines(dbSearcher *db.DBSearcher, chunk *lookupChunk) {
+	chunk.results = make([]db.GeoResult, len(chunk.lines))
+	chunk.errs = make([]error, len(chunk.lines))
+	addrs := make([]netip.Addr, 0, len(chunk.lines))
+	positions := make([]int, 0, len(chunk.lines))
+	for i, line := range chunk.lines {
+		addr, err := netip.ParseAddr(line)
+		if err != nil {
+			chunk.errs[i] = db.ErrInvalidIP
+			continue
+		}
+		addrs = append(addrs, addr)
+		positions = append(positions, i)
+	}
+
+	results, errs := dbSearcher.SearchBatch(addrs)
+	for j, i := range positions {
+		chunk.results[i], chunk.errs[i] = results[j], errs[j]
+	}
+}
+
+// lookupWriter 以 TSV、CSV 或 JSON Lines 格式写出查询结果
+//
+// 每行的字段为 input、各选中列、other 和 error，找到时 error 为空，未找到时各列为空。
+type lookupWriter struct {
+	format export.Format
+	names  []string // 选中列的名称
+	buf    *bufio.Writer
+	csv    *csv.Writer
+	values []string // 复用的字段缓冲
+}
+
+// newLookupWriter 创建查询结果写出器，写完后需调用 flush
+func newLookupWriter(w io.Writer, format export.Format, names []string) *lookupWriter {
+	writer := &lookupWriter{format: format, names: names, buf: bufio.NewWriter(w)}
+	if format == export.CSV {
+		writer.csv = csv.NewWriter(writer.buf)
+	}
+	return writer
+}
+
+// writeHeader 写出 CSV 或 TSV 的表头，JSON Lines 没有表头
+func (writer *lookupWriter) writeHeader() error {
+	if writer.format == export.JSONLines {
+		return nil
+	}
+	header := append([]string{"input"}, writer.names...)
+	return writer.writeRow(append(header, "other", "error"))
+}
+
+// writeChunk 写出一批查询结果并更新统计，查询出现未找到以外的错误时返回错误
+func (writer *lookupWriter) writeChunk(chunk *lookupChunk, stats *lookupStats) error {
+	for i, line := range chunk.lines {
+		err := chunk.errs[i]
+		stats.total++
+		switch {
+		case err == nil:
+			stats.found++
+		case errors.Is(err, db.ErrInvalidIP):
+			stats.invalid++
+		case errors.Is(err, db.ErrNotFound), errors.Is(err, db.ErrIPVersionMismatch):
+			stats.notFound++
+		default:
+			return fmt.Errorf("looking up %s: %w", line, err)
+		}
+		if err := writer.write(line, &chunk.results[i], err); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+	}
+	return nil
+}
+
+// write 写出一个IP的查询结果
+func (writer *lookupWriter) write(input string, result *db.GeoResult, lookupErr error) error {
+	if writer.format == export.JSONLines {
+		return writer.writeJSON(input, result, lookupErr)
+	}
+
+	values := append(writer.values[:0], input)
+	if lookupErr == nil {
+		values = append(values, result.Columns...)
+		values = append(values, result.OtherData, "")
+	} else {
+		for range writer.names {
+			values = append(values, "")
+		}
+		values = append(values, "", errorText(lookupErr))
+	}
+	writer.values = values
+	return writer.writeRow(values)
+}
+
+// writeRow 写出一行 CSV 或 TSV
+func (writer *lookupWriter) writeRow(values []string) error {
+	if writer.csv != nil {
+		return writer.csv.Write(values)
+	}
+	for i, value := range values {
+		if i > 0 {
+			writer.buf.WriteByte('\t')
+		}
+		writer.buf.WriteString(export.EscapeTSV(value))
+	}
+	return writer.buf.WriteByte('\n')
+}
+
+// writeJSON 按字段顺序写出一个 JSON 对象，找到时包含各列和 other，未找到时包含 error
+func (writer *lookupWriter) writeJSON(input string, result *db.GeoResult, lookupErr error) error {
+	var line bytes.Buffer
+	writeField := func(name string, value interface{}) {
+		if line.Len() > 0 {
+			line.WriteByte(',')
+		} else {
+			line.WriteByte('{')
+		}
+		key, _ := json.Marshal(name)
+		encoded, _ := json.Marshal(value)
+		line.Write(key)
+		line.WriteByte(':')
+		line.Write(encoded)
+	}
+
+	writeField("input", input)
+	writeField("found", lookupErr == nil)
+	if lookupErr == nil {
+		for i, name := range writer.names {
+			writeField(name, result.Columns[i])
+		}
+		writeField("other", result.OtherData)
+	} else {
+		writeField("error", errorText(lookupErr))
+	}
+	line.WriteString("}\n")
+	_, err := writer.buf.Write(line.Bytes())
+	return err
+}
+
+// flush 将缓冲的数据写入输出目标
+func (writer *lookupWriter) flush() error {
+	if writer.csv != nil {
+		writer.csv.Flush()
+		if err := writer.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return writer.buf.Flush()
+}
+
+// errorText 返回输出中 error 字段的值
+func errorText(err error) string {
+	switch {
+	case errors.Is(err, db.ErrInvalidIP):
+		return "invalid ip"
+	case errors.Is(err, db.ErrIPVersionMismatch):
+		return "ip version mismatch"
+	default:
+		return "not found"
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tagphi/czdb-search-golang/internal/testdb"
+	"github.com/tagphi/czdb-search-golang/pkg/builder"
+	"github.com/tagphi/czdb-search-golang/pkg/export"
+)
+
+// testRanges 是测试数据库中的记录
+var testRanges = []builder.Range{
+	testdb.Range("1.0.1.0", "1.0.3.255", []string{"中国", "福建", "福州"}, "电信"),
+	testdb.Range("8.8.8.0", "8.8.8.255", []string{"美国", "", ""}, "Google"),
+	testdb.Range("223.5.5.0", "223.5.5.255", []string{"中国", "浙江", "杭州"}, "阿里云"),
+}
+
+// writeTestFile 将内容写入测试的临时目录，返回文件路径
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	return path
+}
+
+// TestLookupInputsOrder 测试多个 worker 并行查询时输出顺序与输入相同
+func TestLookupInputsOrder(t *testing.T) {
+	dbSearcher := testdb.Open(t, 991231, testRanges)
+
+	// 超过多批的输入，找到、未找到和无效的IP交替出现
+	var input, expected strings.Builder
+	var want lookupStats
+	for i := 0; i < 3*lookupChunkSize+17; i++ {
+		want.total++
+		switch i % 4 {
+		case 0:
+			want.found++
+			fmt.Fprintf(&input, "1.0.%d.%d\n", 1+i%3, i%256)
+			fmt.Fprintf(&expected, "1.0.%d.%d\t中国\t福建\t福州\t电信\t\n", 1+i%3, i%256)
+		case 1:
+			want.found++
+			fmt.Fprintf(&input, "8.8.8.%d\n", i%256)
+			fmt.Fprintf(&expected, "8.8.8.%d\t美国\t\t\tGoogle\t\n", i%256)
+		case 2:
+			want.notFound++
+			fmt.Fprintf(&input, "9.9.9.%d\n", i%256)
+			fmt.Fprintf(&expected, "9.9.9.%d\t\t\t\t\tnot found\n", i%256)
+		default:
+			want.invalid++
+			fmt.Fprintf(&input, "# 注释\n\nbad-%d\n", i)
+			fmt.Fprintf(&expected, "bad-%d\t\t\t\t\tinvalid ip\n", i)
+		}
+	}
+	path := writeTestFile(t, "ips.txt", input.String())
+
+	for _, workers := range []int{1, 4} {
+		var out bytes.Buffer
+		writer := newLookupWriter(&out, export.TSV, []string{"country", "province", "city"})
+		stats, err := lookupInputs(dbSearcher, []string{path}, workers, writer)
+		if err != nil {
+			t.Fatalf("workers=%d: lookupInputs 返回错误: %v", workers, err)
+		}
+		if err := writer.flush(); err != nil {
+			t.Fatalf("workers=%d: flush 返回错误: %v", workers, err)
+		}
+		if out.String() != expected.String() {
+			t.Errorf("workers=%d: 输出与输入顺序不一致", workers)
+		}
+		if stats != want {
+			t.Errorf("workers=%d: 统计 = %+v, 期望 %+v", workers, stats, want)
+		}
+	}
+}
+
+// TestRunLookupExitCodes 测试全部找到、部分未找到和出错时的退出码
+func TestRunLookupExitCodes(t *testing.T) {
+	dbPath := testdb.Write(t, 991231, testRanges)
+	found := writeTestFile(t, "found.txt", "8.8.8.8\n223.5.5.5\n")
+	// 超过 64 KiB 的行按无效IP处理，不会中止查询
+	partial := writeTestFile(t, "partial.txt", "8.8.8.8\n9.9.9.9\nbad\n"+strings.Repeat("1", 100*1024)+"\n")
+	output := filepath.Join(t.TempDir(), "out.csv")
+
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"-p", dbPath, "-k", testdb.Key, "-q", "-format", "csv", "-o", output, found}, 0},
+		{[]string{"-p", dbPath, "-k", testdb.Key, "-q", "-workers", "2", "-o", output, partial}, 1},
+		{[]string{"-p", dbPath, "-k", testdb.Key, "-q", "-o", output, filepath.Join(t.TempDir(), "missing.txt")}, 2},
+		{[]string{"-p", dbPath, "-k", testdb.Key, "-q", "-format", "mmdb", "-o", output, found}, 2},
+		{[]string{"-p", dbPath, "-k", testdb.Key, "-q", "-workers", "0", "-o", output, found}, 2},
+		{[]string{"-p", filepath.Join(t.TempDir(), "missing.czdb"), "-k", testdb.Key, "-q", "-o", output, found}, 2},
+		{[]string{"-p", dbPath, "-k", testdb.Key, "-q", "-o", filepath.Join(t.TempDir(), "missing", "out.tsv"), found}, 2},
+	}
+	for _, test := range tests {
+		if code := runLookup(test.args); code != test.expected {
+			t.Errorf("lookup %q 退出码 = %d, 期望 %d", test.args, code, test.expected)
+		}
+	}
+
+	// 第一个用例的 CSV 输出
+	if code := runLookup(tests[0].args); code != 0 {
+		t.Fatalf("退出码 = %d", code)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("读取输出失败: %v", err)
+	}
+	expected := "input,country,province,city,other,error\n8.8.8.8,美国,,,Google,\n223.5.5.5,中国,浙江,杭州,阿里云,\n"
+	if string(data) != expected {
+		t.Errorf("CSV 输出 =\n%s\n期望\n%s", data, expected)
+	}
+}
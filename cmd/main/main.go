@@ -2,27 +2,40 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/tagphi/czdb-search-golang/pkg/db"
 	"github.com/tagphi/czdb-search-golang/pkg/utils"
 )
 
 func main() {
+	// 子命令，未指定时进入交互式查询
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
 	// 定义命令行参数
 	dbPath := flag.String("p", "", "Path to CZDB database file")
 	key := flag.String("k", "", "Base64 encoded key for decryption")
-	mode := flag.String("m", "btree", "Search mode: 'memory' or 'btree'")
+	mode := flag.String("m", "btree", "Search mode: 'memory', 'btree' or 'mmap'")
 	debug := flag.Bool("debug", false, "Enable debug output")
-	logFile := flag.String("log", "", "Log file for debug output (default: stdout)")
+	logFile := flag.String("log", "", "Log file for debug output (default: stderr)")
+	watch := flag.Duration("watch", 0, "Poll the database file at this interval and reload it when it changes (0 disables)")
+	cacheSize := flag.Int("cache", 0, "Number of matched ranges to cache in front of the database (0 disables the cache)")
 
 	// 解析命令行参数
 	flag.Parse()
 
-	// 设置调试模式
+	// 设置调试模式，调试信息和警告默认输出到标准错误，避免与查询结果混在一起
+	utils.SetDebugOutput(os.Stderr)
 	utils.SetDebugEnabled(*debug)
 
 	// 如果指定了日志文件，则将调试输出重定向到文件
@@ -30,7 +43,7 @@ func main() {
 		file, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 		if err != nil {
 			fmt.Printf("Error opening log file: %v\n", err)
-			fmt.Println("Debug output will be sent to stdout")
+			fmt.Println("Debug output will be sent to stderr")
 		} else {
 			utils.SetDebugOutput(file)
 			defer file.Close()
@@ -50,6 +63,9 @@ func main() {
 	if strings.ToLower(*mode) == "memory" {
 		searchType = db.MEMORY
 		fmt.Println("Using Memory search mode")
+	} else if strings.ToLower(*mode) == "mmap" {
+		searchType = db.MMAP
+		fmt.Println("Using MMap search mode")
 	} else {
 		searchType = db.BTREE
 		fmt.Println("Using B-tree search mode")
@@ -61,15 +77,35 @@ func main() {
 		fmt.Println("Debug mode enabled")
 	}
 	
-	dbSearcher, err := db.InitDBSearcher(*dbPath, *key, searchType)
+	dbSearcher, err := db.OpenReloadable(*dbPath, *key, &db.Options{SearchType: searchType, CacheSize: *cacheSize})
 	if err != nil {
 		fmt.Printf("Error initializing database searcher: %v\n", err)
 		os.Exit(1)
 	}
-	defer db.CloseDBSearcher(dbSearcher)
+	defer dbSearcher.Close()
 
 	// 打印数据库信息
-	db.Info(dbSearcher)
+	dbSearcher.Info()
+
+	// 收到 SIGHUP 或数据库文件变化时重新加载，提示输出到标准错误，不与查询结果混在一起
+	dbSearcher.OnReload = func(path string, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError reloading database %s: %v\n", path, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "\nDatabase reloaded from %s\n", path)
+		}
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			dbSearcher.Reload()
+		}
+	}()
+	if *watch > 0 {
+		stopWatching := dbSearcher.WatchFile(*watch)
+		defer stopWatching()
+	}
 
 	// 启动交互式查询
 	scanner := bufio.NewScanner(os.Stdin)
@@ -89,7 +125,11 @@ func main() {
 		}
 
 		// 查询IP地址
-		result, err := db.Search(input, dbSearcher)
+		result, err := dbSearcher.Search(input)
+		if errors.Is(err, db.ErrNotFound) {
+			fmt.Printf("Result for %s: not found\n", input)
+			continue
+		}
 		if err != nil {
 			fmt.Printf("Error searching for IP %s: %v\n", input, err)
 			continue
@@ -98,5 +138,10 @@ func main() {
 		fmt.Printf("Result for %s: %s\n", input, result)
 	}
 
+	if *cacheSize > 0 {
+		stats := dbSearcher.CacheStats()
+		utils.Debug("Cache: %d/%d ranges, %d hits, %d misses, %d evictions\n",
+			stats.Entries, stats.Capacity, stats.Hits, stats.Misses, stats.Evictions)
+	}
 	fmt.Println("Exiting...")
 } 
\ No newline at end of file
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+	"github.com/tagphi/czdb-search-golang/pkg/server"
+)
+
+// runServe 启动 HTTP 查询服务，收到 SIGINT 或 SIGTERM 时等待进行中的请求结束后退出
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags := addDBFlags(fs)
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	maxBatch := fs.Int("max-batch", server.DefaultMaxBatch, "Maximum number of IPs in one POST /v1/lookup request")
+	maxBody := fs.Int64("max-body", server.DefaultMaxBodySize, "Maximum size of a POST /v1/lookup request body in bytes")
+	warnDays := fs.Int("warn-days", server.DefaultWarnDays, "Report status 'expiring' on /healthz when the license expires within this many days")
+	watch := fs.Duration("watch", 0, "Poll the database file at this interval and reload it when it changes (0 disables)")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 15*time.Second, "Time to wait for in-flight requests on shutdown")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	searcher, stop, err := openServeSearcher(flags, *watch)
+	if err != nil {
+		return fatalf("initializing database searcher: %v", err)
+	}
+	defer searcher.Close()
+	defer stop()
+
+	handler := server.NewHTTPHandler(searcher, server.HTTPConfig{
+		MaxBatch:    *maxBatch,
+		MaxBodySize: *maxBody,
+		WarnDays:    *warnDays,
+	})
+	httpServer := server.NewHTTPServer(*addr, handler)
+
+	log.Printf("serving %s on %s", flags.path, *addr)
+	return serveUntilSignal(httpServer.ListenAndServe, httpServer.Shutdown, http.ErrServerClosed, *shutdownTimeout)
+}
+
+// serveUntilSignal 运行服务直到收到 SIGINT 或 SIGTERM，然后在 timeout 内优雅关闭
+//
+// 参数:
+//   - serve: 阻塞运行服务，关闭后返回 closed
+//   - shutdown: 停止接受新请求并等待进行中的请求结束
+//   - closed: serve 在正常关闭后返回的错误
+//   - timeout: 等待进行中的请求的最长时间
+//
+// 返回:
+//   - int: 进程退出码
+func serveUntilSignal(serve func() error, shutdown func(context.Context) error, closed error, timeout time.Duration) int {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serve()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fatalf("serving: %v", err)
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), timeout)
+	defer cancelShutdown()
+	if err := shutdown(shutdownCtx); err != nil {
+		return fatalf("shutting down: %v", err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, closed) {
+		return fatalf("serving: %v", err)
+	}
+	return 0
+}
+
+// openServeSearcher 打开可热加载的搜索器，收到 SIGHUP 或文件变化时重新加载
+//
+// 返回的 stop 停止监听信号和文件变化，需在关闭搜索器之前调用。
+func openServeSearcher(flags *dbFlags, watch time.Duration) (*db.ReloadableSearcher, func(), error) {
+	opts, err := flags.options()
+	if err != nil {
+		return nil, nil, err
+	}
+	searcher, err := db.OpenReloadable(flags.path, flags.key, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	searcher.OnReload = func(path string, err error) {
+		if err != nil {
+			log.Printf("reloading %s failed, still serving the previous database: %v", path, err)
+		} else {
+			log.Printf("reloaded %s", path)
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-hup:
+				searcher.Reload()
+			case <-done:
+				return
+			}
+		}
+	}()
+	stopWatching := func() {}
+	if watch > 0 {
+		stopWatching = searcher.WatchFile(watch)
+	}
+
+	stop := func() {
+		signal.Stop(hup)
+		close(done)
+		stopWatching()
+	}
+	return searcher, stop, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/tagphi/czdb-search-golang/pkg/server"
+)
+
+// runServeDNS 启动 DNS TXT 查询服务，同时监听 UDP 和 TCP，收到 SIGINT 或 SIGTERM 时等待进行中的查询结束后退出
+func runServeDNS(args []string) int {
+	fs := flag.NewFlagSet("serve-dns", flag.ContinueOnError)
+	flags := addDBFlags(fs)
+	addr := fs.String("addr", ":8053", "Address to listen on for both UDP and TCP")
+	zone := fs.String("zone", "geo.internal", "Zone the reversed IP names are queried under, e.g. 8.8.8.8.geo.internal")
+	ttl := fs.Uint("ttl", server.DefaultDNSTTL, "TTL of answers in seconds")
+	idleTimeout := fs.Duration("idle-timeout", server.DefaultDNSIdleTimeout, "Close TCP connections idle for longer than this")
+	watch := fs.Duration("watch", 0, "Poll the database file at this interval and reload it when it changes (0 disables)")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 15*time.Second, "Time to wait for in-flight queries on shutdown")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	searcher, stop, err := openServeSearcher(flags, *watch)
+	if err != nil {
+		return fatalf("initializing database searcher: %v", err)
+	}
+	defer searcher.Close()
+	defer stop()
+
+	dnsServer, err := server.NewDNSServer(searcher, server.DNSConfig{
+		Zone:        *zone,
+		TTL:         uint32(*ttl),
+		IdleTimeout: *idleTimeout,
+	})
+	if err != nil {
+		return fatalf("%v", err)
+	}
+
+	log.Printf("serving %s over DNS on %s (zone %s)", flags.path, *addr, *zone)
+	return serveUntilSignal(func() error { return dnsServer.ListenAndServe(*addr) }, dnsServer.Shutdown, server.ErrServerClosed, *shutdownTimeout)
+}
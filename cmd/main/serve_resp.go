@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/tagphi/czdb-search-golang/pkg/server"
+)
+
+// runServeRESP 启动 Redis 协议 (RESP2) 查询服务，收到 SIGINT 或 SIGTERM 时等待进行中的命令结束后退出
+func runServeRESP(args []string) int {
+	fs := flag.NewFlagSet("serve-resp", flag.ContinueOnError)
+	flags := addDBFlags(fs)
+	addr := fs.String("addr", ":6380", "Address to listen on")
+	maxBatch := fs.Int("max-batch", server.DefaultMaxBatch, "Maximum number of IPs in one GEOIP.MLOOKUP command")
+	warnDays := fs.Int("warn-days", server.DefaultWarnDays, "Report status 'expiring' in GEOIP.INFO when the license expires within this many days")
+	idleTimeout := fs.Duration("idle-timeout", 0, "Close connections idle for longer than this (0 disables)")
+	watch := fs.Duration("watch", 0, "Poll the database file at this interval and reload it when it changes (0 disables)")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 15*time.Second, "Time to wait for in-flight commands on shutdown")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	searcher, stop, err := openServeSearcher(flags, *watch)
+	if err != nil {
+		return fatalf("initializing database searcher: %v", err)
+	}
+	defer searcher.Close()
+	defer stop()
+
+	respServer := server.NewRESPServer(searcher, server.RESPConfig{
+		MaxBatch:    *maxBatch,
+		WarnDays:    *warnDays,
+		IdleTimeout: *idleTimeout,
+	})
+
+	log.Printf("serving %s over RESP on %s", flags.path, *addr)
+	return serveUntilSignal(func() error { return respServer.ListenAndServe(*addr) }, respServer.Shutdown, server.ErrServerClosed, *shutdownTimeout)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+	"github.com/tagphi/czdb-search-golang/pkg/utils"
+)
+
+// runVerify 校验数据库文件的完整性并输出报告
+//
+// 没有问题时退出码为 0，发现问题时为 1，无法校验 (参数错误、密钥错误等) 时为 2。
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	path := fs.String("p", "", "Path to CZDB database file")
+	key := fs.String("k", "", "Base64 encoded key for decryption")
+	format := fs.String("format", "text", "Report format: 'text' or 'json'")
+	debug := fs.Bool("debug", false, "Enable debug output (written to stderr)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	utils.SetDebugOutput(os.Stderr)
+	utils.SetDebugEnabled(*debug)
+	if *path == "" || *key == "" {
+		fatalf("database path (-p) and key (-k) are required")
+		return 2
+	}
+	if *format != "text" && *format != "json" {
+		fatalf("unsupported report format %q", *format)
+		return 2
+	}
+
+	report, err := db.VerifyFile(*path, *key)
+	if err != nil {
+		fatalf("%v", err)
+		return 2
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fatalf("writing report: %v", err)
+			return 2
+		}
+	} else {
+		printVerifyReport(*path, report)
+	}
+
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// printVerifyReport 以文本形式输出校验报告
+func printVerifyReport(path string, report *db.VerifyReport) {
+	fmt.Printf("File:           %s (%d bytes)\n", path, report.FileSize)
+	fmt.Printf("IP version:     IPv%d\n", report.IPVersion)
+	fmt.Printf("Header entries: %d\n", report.HeaderEntries)
+	fmt.Printf("Index records:  %d\n", report.IndexRecords)
+	fmt.Printf("Geo map size:   %d bytes\n", report.GeoMapSize)
+	if report.OK() {
+		fmt.Println("OK: no problems found")
+		return
+	}
+
+	fmt.Printf("FAILED: %d problem(s) found\n", report.IssueCount)
+	for _, issue := range report.Issues {
+		if issue.Record >= 0 {
+			fmt.Printf("  %s at offset %d (record %d): %s\n", issue.Section, issue.Offset, issue.Record, issue.Message)
+		} else {
+			fmt.Printf("  %s at offset %d: %s\n", issue.Section, issue.Offset, issue.Message)
+		}
+	}
+	if omitted := report.IssueCount - len(report.Issues); omitted > 0 {
+		fmt.Printf("  ... %d more problem(s) omitted\n", omitted)
+	}
+}
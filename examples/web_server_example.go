@@ -1,27 +1,41 @@
+//go:build ignore
+
 package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/tagphi/czdb-search-golang/pkg/db"
 )
 
 // 响应结构
 type Response struct {
-	IP     string `json:"ip"`
-	Region string `json:"region"`
-	Error  string `json:"error,omitempty"`
+	IP      string            `json:"ip"`
+	Columns map[string]string `json:"columns,omitempty"`
+	Other   string            `json:"other,omitempty"`
+	Error   string            `json:"error,omitempty"`
 }
 
 var dbSearcher *db.DBSearcher
 
+// 本示例演示如何在自己的 Web 应用中集成查询功能；
+// 需要完整的查询服务时可以直接使用 `cz88-search serve`
 func main() {
+	// 从环境变量中获取数据库路径和密钥
+	dbPath := os.Getenv("CZDB_PATH")
+	dbKey := os.Getenv("CZDB_KEY")
+	if dbPath == "" || dbKey == "" {
+		log.Fatalf("请设置 CZDB_PATH 和 CZDB_KEY 环境变量\n")
+	}
+
 	// 初始化数据库搜索器，使用内存模式以获得最佳性能
 	var err error
-	dbSearcher, err = db.InitDBSearcher("./data.db", "your-key-here", db.MEMORY)
+	dbSearcher, err = db.InitDBSearcher(dbPath, dbKey, db.MEMORY)
 	if err != nil {
 		log.Fatalf("初始化数据库搜索器失败: %v\n", err)
 	}
@@ -43,30 +57,29 @@ func main() {
 func lookupHandler(w http.ResponseWriter, r *http.Request) {
 	// 从URL路径中提取IP地址
 	ip := r.URL.Path[len("/api/ip/"):]
-	if ip == "" {
-		http.Error(w, "请提供IP地址", http.StatusBadRequest)
-		return
-	}
+	response := Response{IP: ip}
+	status := http.StatusOK
 
-	// 查询IP地址
-	region, err := db.Search(ip, dbSearcher)
-	
-	// 设置响应头
-	w.Header().Set("Content-Type", "application/json")
-	
-	// 准备响应
-	response := Response{
-		IP: ip,
+	// 查询IP地址，按错误类型返回对应的状态码
+	result, err := dbSearcher.SearchResult(ip)
+	switch {
+	case err == nil:
+		response.Columns = result.Map()
+		response.Other = result.OtherData
+	case errors.Is(err, db.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, db.ErrInvalidIP), errors.Is(err, db.ErrIPVersionMismatch):
+		status = http.StatusBadRequest
+	default:
+		status = http.StatusInternalServerError
 	}
-	
 	if err != nil {
 		response.Error = err.Error()
-		w.WriteHeader(http.StatusInternalServerError)
-	} else {
-		response.Region = region
 	}
-	
+
 	// 发送JSON响应
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("编码响应失败: %v", err)
 	}
@@ -76,4 +89,4 @@ func lookupHandler(w http.ResponseWriter, r *http.Request) {
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	fmt.Fprintf(w, `{"status": "ok"}`)
-} 
\ No newline at end of file
+}
@@ -0,0 +1,75 @@
+// Package testdb 为各个包的测试生成 IPv4 测试数据库
+package testdb
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tagphi/czdb-search-golang/pkg/builder"
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+)
+
+// Key 是测试数据库的密钥，也是各包 testdata 中数据库的密钥
+const Key = "MDEyMzQ1Njc4OWFiY2RlZg==" // "0123456789abcdef"
+
+// ClientId 是测试数据库的客户端ID
+const ClientId = 42
+
+// Range 创建一条测试记录，start 和 end 为IP地址字符串
+func Range(start, end string, columns []string, other string) builder.Range {
+	return builder.Range{Start: netip.MustParseAddr(start), End: netip.MustParseAddr(end), Columns: columns, Other: other}
+}
+
+// Build 生成包含 ranges 的 IPv4 测试数据库，返回文件内容
+//
+// 参数:
+//   - t: 当前测试，失败时终止测试
+//   - expirationDate: 授权到期日期，格式为 yyMMdd
+//   - ranges: 按地址升序排列且不重叠的记录
+//
+// 返回:
+//   - []byte: 使用 Key 加密的数据库文件内容
+func Build(t testing.TB, expirationDate int32, ranges []builder.Range) []byte {
+	t.Helper()
+
+	dbBuilder, err := builder.New(builder.Config{Key: Key, IPVersion: 4, ClientId: ClientId, ExpirationDate: expirationDate})
+	if err != nil {
+		t.Fatalf("创建数据库生成器失败: %v", err)
+	}
+	for _, r := range ranges {
+		if err := dbBuilder.Add(r); err != nil {
+			t.Fatalf("添加测试记录失败: %v", err)
+		}
+	}
+	var data bytes.Buffer
+	if _, err := dbBuilder.WriteTo(&data); err != nil {
+		t.Fatalf("生成测试数据库失败: %v", err)
+	}
+	return data.Bytes()
+}
+
+// Write 生成测试数据库并写入测试的临时目录，返回文件路径
+func Write(t testing.TB, expirationDate int32, ranges []builder.Range) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.czdb")
+	if err := os.WriteFile(path, Build(t, expirationDate, ranges), 0644); err != nil {
+		t.Fatalf("写入测试数据库失败: %v", err)
+	}
+	return path
+}
+
+// Open 生成测试数据库并以内存模式打开搜索器，测试结束时自动关闭
+func Open(t testing.TB, expirationDate int32, ranges []builder.Range) *db.DBSearcher {
+	t.Helper()
+
+	dbSearcher, err := db.OpenBytes(Build(t, expirationDate, ranges), Key, nil)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	t.Cleanup(func() { db.CloseDBSearcher(dbSearcher) })
+	return dbSearcher
+}
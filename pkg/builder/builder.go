@@ -0,0 +1,382 @@
+// Package builder 生成可由 db.InitDBSearcher 读取的加密CZDB数据库文件
+//
+// 文件布局：
+//
+//	HyperHeader (版本、客户端ID、加密块长度) | AES-ECB 加密块 | 随机填充 |
+//	SuperBlock | HeaderBlock | 数据记录 | 索引块 | 列选择 | 地理映射长度 | 异或加密的地理映射
+package builder
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+
+	"github.com/tagphi/czdb-search-golang/pkg/utils"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	superPartLength    = 17 // SuperBlock 长度
+	headerBlockLength  = 20 // 头部块长度，16 字节 IP + 4 字节索引指针
+	clientIdShift      = 20 // 加密块中客户端ID左移的位数
+	hyperHeaderVersion = 1  // HyperHeader 中的版本号
+
+	maxClientId       = 1<<12 - 1 // 客户端ID占 12 位
+	maxExpirationDate = 1<<20 - 1 // 过期日期占 20 位
+	maxGeoMapSize     = 1<<24 - 1 // 地理映射指针占 24 位
+	maxGeoEntrySize   = 1<<8 - 1  // 地理映射条目长度占 8 位
+	maxRecordSize     = 1<<8 - 1  // 索引块中的数据长度占 1 个字节
+	maxColumns        = 30        // 列选择位掩码最多表示的列数
+	maxRandomSize     = 1024      // 自动选择随机填充长度时的上限
+	defaultExpiration = 991231    // 默认过期日期 2099-12-31
+
+	// DefaultHeaderPageSize 是默认每个头部行覆盖的索引块数
+	DefaultHeaderPageSize = 256
+)
+
+// Config 数据库生成参数
+type Config struct {
+	Key            string // Base64编码的密钥，解码后为 16、24 或 32 字节
+	IPVersion      int    // 4 或 6，为 0 时由第一条记录决定
+	ClientId       int32  // 客户端ID，0 到 4095
+	ExpirationDate int32  // 过期日期，yymmdd 形式，如 301231；为 0 时使用 991231
+	RandomSize     int    // 加密块之后的随机填充长度，为 0 时随机选择 1 到 1024
+	HeaderPageSize int    // 每个头部行覆盖的索引块数，为 0 时使用 DefaultHeaderPageSize
+}
+
+// Range 表示一条待写入的记录
+type Range struct {
+	Start   netip.Addr // 区间起始IP
+	End     netip.Addr // 区间结束IP，包含在区间内
+	Columns []string   // 地理映射中的列值
+	Other   string     // 数据记录中的其他数据
+}
+
+// Builder 收集按地址升序排列的记录并生成CZDB文件
+type Builder struct {
+	config       Config
+	keyBytes     []byte
+	ranges       []Range
+	columnNumber int
+}
+
+// New 检查生成参数并创建生成器
+//
+// 参数:
+//   - config: 数据库生成参数
+//
+// 返回:
+//   - *Builder: 数据库生成器
+//   - error: 如果参数无效则返回错误
+func New(config Config) (*Builder, error) {
+	keyBytes, err := base64.StdEncoding.DecodeString(config.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %v", err)
+	}
+	if len(keyBytes) != 16 && len(keyBytes) != 24 && len(keyBytes) != 32 {
+		return nil, fmt.Errorf("invalid key length, must be 16, 24, or 32 bytes (got %d)", len(keyBytes))
+	}
+
+	if config.IPVersion != 0 && config.IPVersion != utils.IPV4 && config.IPVersion != utils.IPV6 {
+		return nil, fmt.Errorf("unsupported IP version: %d", config.IPVersion)
+	}
+	if config.ClientId < 0 || config.ClientId > maxClientId {
+		return nil, fmt.Errorf("client ID %d out of range [0, %d]", config.ClientId, maxClientId)
+	}
+	if config.ExpirationDate == 0 {
+		config.ExpirationDate = defaultExpiration
+	}
+	if config.ExpirationDate < 0 || config.ExpirationDate > maxExpirationDate {
+		return nil, fmt.Errorf("expiration date %d out of range", config.ExpirationDate)
+	}
+	if config.RandomSize < 0 {
+		return nil, fmt.Errorf("invalid random size: %d", config.RandomSize)
+	}
+	if config.HeaderPageSize < 0 {
+		return nil, fmt.Errorf("invalid header page size: %d", config.HeaderPageSize)
+	}
+	if config.HeaderPageSize == 0 {
+		config.HeaderPageSize = DefaultHeaderPageSize
+	}
+
+	return &Builder{config: config, keyBytes: keyBytes}, nil
+}
+
+// Add 追加一条记录，记录必须按地址升序排列且互不重叠
+//
+// 参数:
+//   - r: 待写入的记录
+//
+// 返回:
+//   - error: 如果记录无效、顺序错误或与数据库IP版本不符则返回错误
+func (builder *Builder) Add(r Range) error {
+	if !r.Start.IsValid() || !r.End.IsValid() {
+		return fmt.Errorf("invalid range %s-%s", r.Start, r.End)
+	}
+	r.Start, r.End = r.Start.WithZone(""), r.End.WithZone("")
+	if r.Start.Is4() != r.End.Is4() {
+		return fmt.Errorf("range %s-%s mixes IPv4 and IPv6", r.Start, r.End)
+	}
+	if r.End.Less(r.Start) {
+		return fmt.Errorf("range %s-%s ends before it starts", r.Start, r.End)
+	}
+
+	ipVersion := utils.IPV6
+	if r.Start.Is4() {
+		ipVersion = utils.IPV4
+	}
+	if builder.config.IPVersion == 0 {
+		builder.config.IPVersion = ipVersion
+	}
+	if ipVersion != builder.config.IPVersion {
+		return fmt.Errorf("range %s-%s is not IPv%d", r.Start, r.End, builder.config.IPVersion)
+	}
+
+	if n := len(builder.ranges); n > 0 && !builder.ranges[n-1].End.Less(r.Start) {
+		previous := builder.ranges[n-1]
+		return fmt.Errorf("range %s-%s is not sorted after %s-%s or overlaps it", r.Start, r.End, previous.Start, previous.End)
+	}
+	if len(r.Columns) > maxColumns {
+		return fmt.Errorf("range %s-%s has %d columns, at most %d are supported", r.Start, r.End, len(r.Columns), maxColumns)
+	}
+
+	if len(r.Columns) > builder.columnNumber {
+		builder.columnNumber = len(r.Columns)
+	}
+	builder.ranges = append(builder.ranges, r)
+	return nil
+}
+
+// Len 返回已添加的记录数
+func (builder *Builder) Len() int {
+	return len(builder.ranges)
+}
+
+// WriteFile 生成数据库并写入文件
+//
+// 先写入同目录下的临时文件再重命名，正在使用旧文件的进程可以安全地重新加载。
+//
+// 参数:
+//   - path: 数据库文件路径
+//
+// 返回:
+//   - error: 如果生成或写入失败则返回错误
+func (builder *Builder) WriteFile(path string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create database file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := builder.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write database file: %v", err)
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write database file: %v", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failed to write database file: %v", err)
+	}
+	return nil
+}
+
+// WriteTo 生成数据库并写入 w
+//
+// 参数:
+//   - w: 输出目标
+//
+// 返回:
+//   - int64: 写入的字节数
+//   - error: 如果没有记录、数据超出格式限制或写入失败则返回错误
+func (builder *Builder) WriteTo(w io.Writer) (int64, error) {
+	if len(builder.ranges) == 0 {
+		return 0, fmt.Errorf("no ranges to write")
+	}
+
+	header, err := builder.hyperHeader()
+	if err != nil {
+		return 0, err
+	}
+	body, err := builder.body()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), fmt.Errorf("failed to write database: %v", err)
+	}
+	m, err := w.Write(body)
+	if err != nil {
+		return int64(n + m), fmt.Errorf("failed to write database: %v", err)
+	}
+	return int64(n + m), nil
+}
+
+// hyperHeader 生成 HyperHeader、AES-ECB 加密块和随机填充
+func (builder *Builder) hyperHeader() ([]byte, error) {
+	randomSize := builder.config.RandomSize
+	if randomSize == 0 {
+		n, err := rand.Int(rand.Reader, big.NewInt(maxRandomSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to choose random size: %v", err)
+		}
+		randomSize = int(n.Int64()) + 1
+	}
+
+	plain := make([]byte, aes.BlockSize)
+	binary.LittleEndian.PutUint32(plain, uint32(builder.config.ClientId)<<clientIdShift|uint32(builder.config.ExpirationDate))
+	binary.LittleEndian.PutUint32(plain[4:], uint32(randomSize))
+
+	cipher, err := aes.NewCipher(builder.keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %v", err)
+	}
+	encrypted := make([]byte, aes.BlockSize)
+	cipher.Encrypt(encrypted, plain)
+
+	header := make([]byte, 0, 12+len(encrypted)+randomSize)
+	header = binary.LittleEndian.AppendUint32(header, hyperHeaderVersion)
+	header = binary.LittleEndian.AppendUint32(header, uint32(builder.config.ClientId))
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(encrypted)))
+	header = append(header, encrypted...)
+
+	padding := make([]byte, randomSize)
+	if _, err := rand.Read(padding); err != nil {
+		return nil, fmt.Errorf("failed to generate random padding: %v", err)
+	}
+	return append(header, padding...), nil
+}
+
+// body 生成 SuperBlock 开始的数据库主体，其中的指针均相对于 SuperBlock 起始位置
+func (builder *Builder) body() ([]byte, error) {
+	ipLen := 4
+	if builder.config.IPVersion == utils.IPV6 {
+		ipLen = 16
+	}
+	indexLen := ipLen*2 + 5
+	ranges := builder.ranges
+
+	// 地理映射：相同的列组合只写一次
+	var geoMap []byte
+	geoPos := map[string]uint64{}
+	records := make([][]byte, len(ranges))
+	columns := make([]string, builder.columnNumber)
+	for i, r := range ranges {
+		var pos uint64
+		if builder.columnNumber > 0 {
+			// 列数不足的记录以空值补齐
+			copy(columns, r.Columns)
+			for j := len(r.Columns); j < len(columns); j++ {
+				columns[j] = ""
+			}
+			packed, err := msgpack.Marshal(columns)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode columns of %s-%s: %v", r.Start, r.End, err)
+			}
+			if len(packed) > maxGeoEntrySize {
+				return nil, fmt.Errorf("columns of %s-%s take %d bytes, at most %d are supported", r.Start, r.End, len(packed), maxGeoEntrySize)
+			}
+
+			var ok bool
+			if pos, ok = geoPos[string(packed)]; !ok {
+				if len(geoMap)+len(packed) > maxGeoMapSize {
+					return nil, fmt.Errorf("geo map exceeds %d bytes", maxGeoMapSize)
+				}
+				pos = uint64(len(packed))<<24 | uint64(len(geoMap))
+				geoPos[string(packed)] = pos
+				geoMap = append(geoMap, packed...)
+			}
+		}
+
+		var record bytes.Buffer
+		enc := msgpack.NewEncoder(&record)
+		if err := enc.EncodeUint(pos); err != nil {
+			return nil, fmt.Errorf("failed to encode record %s-%s: %v", r.Start, r.End, err)
+		}
+		if err := enc.EncodeString(r.Other); err != nil {
+			return nil, fmt.Errorf("failed to encode record %s-%s: %v", r.Start, r.End, err)
+		}
+		if record.Len() > maxRecordSize {
+			return nil, fmt.Errorf("record %s-%s takes %d bytes, at most %d are supported", r.Start, r.End, record.Len(), maxRecordSize)
+		}
+		records[i] = record.Bytes()
+	}
+
+	// 头部行：每 HeaderPageSize 个索引块一行，最后一个索引块也单独占一行
+	pageSize := builder.config.HeaderPageSize
+	headerRows := (len(ranges)+pageSize-1)/pageSize + 1
+	headerBlockSize := headerRows * headerBlockLength
+
+	// 数据记录位于头部块之后、索引之前
+	dataStart := superPartLength + headerBlockSize
+	dataPtrs := make([]int, len(ranges))
+	dataSize := 0
+	for i, record := range records {
+		dataPtrs[i] = dataStart + dataSize
+		dataSize += len(record)
+	}
+	startIndexPtr := dataStart + dataSize
+	endIndexPtr := startIndexPtr + (len(ranges)-1)*indexLen
+	bodySize := endIndexPtr + indexLen + 8 + len(geoMap)
+	if int64(bodySize) > 1<<31-1 {
+		return nil, fmt.Errorf("database size %d exceeds the format limit", bodySize)
+	}
+
+	body := make([]byte, startIndexPtr, bodySize)
+
+	// SuperBlock
+	if ipLen == 16 {
+		body[0] = 1
+	}
+	binary.LittleEndian.PutUint32(body[1:], uint32(bodySize))
+	binary.LittleEndian.PutUint32(body[5:], uint32(startIndexPtr))
+	binary.LittleEndian.PutUint32(body[9:], uint32(headerBlockSize))
+	binary.LittleEndian.PutUint32(body[13:], uint32(endIndexPtr))
+
+	// 头部块
+	row := 0
+	for i, r := range ranges {
+		if i%pageSize != 0 && i != len(ranges)-1 {
+			continue
+		}
+		p := superPartLength + row*headerBlockLength
+		copy(body[p:p+16], r.Start.AsSlice())
+		binary.LittleEndian.PutUint32(body[p+16:], uint32(startIndexPtr+i*indexLen))
+		row++
+	}
+
+	// 数据记录
+	for i, record := range records {
+		copy(body[dataPtrs[i]:], record)
+	}
+
+	// 索引块
+	for i, r := range ranges {
+		body = append(body, r.Start.AsSlice()...)
+		body = append(body, r.End.AsSlice()...)
+		body = binary.LittleEndian.AppendUint32(body, uint32(dataPtrs[i]))
+		body = append(body, byte(len(records[i])))
+	}
+
+	// 列选择与加密的地理映射
+	columnSelection := uint32(1)<<(builder.columnNumber+1) - 2
+	body = binary.LittleEndian.AppendUint32(body, columnSelection)
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(geoMap)))
+	for i, b := range geoMap {
+		body = append(body, b^builder.keyBytes[i%len(builder.keyBytes)])
+	}
+	return body, nil
+}
@@ -0,0 +1,209 @@
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+	"github.com/tagphi/czdb-search-golang/pkg/export"
+)
+
+const testKey = "MDEyMzQ1Njc4OWFiY2RlZg==" // "0123456789abcdef"
+
+// generateRanges 生成 n 个互不相邻的区间，区间之间留有空隙
+func generateRanges(n int, ipv6 bool) []Range {
+	ranges := make([]Range, n)
+	for i := range ranges {
+		var start, end netip.Addr
+		if ipv6 {
+			start = netip.MustParseAddr(fmt.Sprintf("2001:db8:%x::", i+1))
+			end = netip.MustParseAddr(fmt.Sprintf("2001:db8:%x::ff", i+1))
+		} else {
+			start = netip.AddrFrom4([4]byte{byte(1 + i/256), byte(i % 256), 0, 0})
+			end = netip.AddrFrom4([4]byte{byte(1 + i/256), byte(i % 256), 127, 255})
+		}
+		ranges[i] = Range{
+			Start:   start,
+			End:     end,
+			Columns: []string{"中国", fmt.Sprintf("省份%d", i%7), fmt.Sprintf("城市%d", i%13)},
+			Other:   fmt.Sprintf("ISP%d", i%5),
+		}
+	}
+	// 列数不足和没有 otherData 的记录
+	ranges[0].Columns = []string{"局域网"}
+	ranges[n-1].Other = ""
+	return ranges
+}
+
+// writeDB 使用给定参数生成数据库文件
+func writeDB(t *testing.T, config Config, ranges []Range) string {
+	t.Helper()
+
+	builder, err := New(config)
+	if err != nil {
+		t.Fatalf("创建生成器失败: %v", err)
+	}
+	for _, r := range ranges {
+		if err := builder.Add(r); err != nil {
+			t.Fatalf("添加记录失败: %v", err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "test.czdb")
+	if err := builder.WriteFile(path); err != nil {
+		t.Fatalf("写入数据库失败: %v", err)
+	}
+	return path
+}
+
+// TestBuildAndSearch 测试生成的数据库在所有搜索模式下都能查到每条记录
+func TestBuildAndSearch(t *testing.T) {
+	tests := []struct {
+		ipv6     bool
+		count    int
+		pageSize int
+		clientId int32
+	}{
+		{false, 1, 0, 42},
+		{false, 600, 0, 42},
+		{false, 50, 3, 42},
+		{false, 10, 0, maxClientId}, // 客户端ID的最高位为 1
+		{true, 40, 0, 42},
+		{true, 40, 4, 42},
+	}
+
+	for _, test := range tests {
+		ranges := generateRanges(test.count, test.ipv6)
+		config := Config{Key: testKey, ClientId: test.clientId, ExpirationDate: 301231, HeaderPageSize: test.pageSize}
+		path := writeDB(t, config, ranges)
+
+		for _, searchType := range []db.SearchType{db.MEMORY, db.BTREE, db.MMAP} {
+			name := fmt.Sprintf("ipv6=%v/count=%d/page=%d/client=%d/type=%d", test.ipv6, test.count, test.pageSize, test.clientId, searchType)
+			dbSearcher, err := db.InitDBSearcher(path, testKey, searchType)
+			if err != nil {
+				t.Fatalf("%s: 初始化数据库搜索器失败: %v", name, err)
+			}
+			if dbSearcher.DecryptedBlock.ClientId != test.clientId || dbSearcher.DecryptedBlock.ExpirationDate != 301231 {
+				t.Errorf("%s: 加密块 = %+v", name, dbSearcher.DecryptedBlock)
+			}
+
+			columnNumber := 0
+			for _, r := range ranges {
+				if len(r.Columns) > columnNumber {
+					columnNumber = len(r.Columns)
+				}
+			}
+			for _, r := range ranges {
+				expected := append(append([]string(nil), r.Columns...), make([]string, columnNumber-len(r.Columns))...)
+				for _, addr := range []netip.Addr{r.Start, r.End, r.Start.Next()} {
+					result, ipRange, err := dbSearcher.SearchAddrRange(addr)
+					if err != nil {
+						t.Fatalf("%s: 查询 %s 失败: %v", name, addr, err)
+					}
+					if !reflect.DeepEqual(result.Columns, expected) || result.OtherData != r.Other {
+						t.Errorf("%s: %s = %v %q, 期望 %v %q", name, addr, result.Columns, result.OtherData, expected, r.Other)
+					}
+					if ipRange.Start != r.Start || ipRange.End != r.End {
+						t.Errorf("%s: %s 命中区间 %s, 期望 %s-%s", name, addr, ipRange, r.Start, r.End)
+					}
+				}
+				if _, err := dbSearcher.SearchAddr(r.End.Next()); !errors.Is(err, db.ErrNotFound) {
+					t.Errorf("%s: 区间之后的 %s 错误 = %v, 期望 ErrNotFound", name, r.End.Next(), err)
+				}
+			}
+			if _, err := dbSearcher.SearchAddr(ranges[0].Start.Prev()); !errors.Is(err, db.ErrNotFound) {
+				t.Errorf("%s: 第一个区间之前的地址错误 = %v, 期望 ErrNotFound", name, err)
+			}
+			db.CloseDBSearcher(dbSearcher)
+		}
+	}
+}
+
+// TestAddCSV 测试从CSV读取记录，包括 export 子命令输出的CSV
+func TestAddCSV(t *testing.T) {
+	ranges := generateRanges(20, false)
+	source := writeDB(t, Config{Key: testKey}, ranges)
+
+	dbSearcher, err := db.InitDBSearcher(source, testKey, db.MEMORY)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer db.CloseDBSearcher(dbSearcher)
+
+	for _, opts := range []export.Options{
+		{Format: export.CSV, Columns: []string{"country", "province", "city"}},
+		{Format: export.CSV, Numeric: true},
+		{Format: export.CSV, NoHeader: true},
+	} {
+		var csvData bytes.Buffer
+		if _, err := export.Export(dbSearcher, &csvData, opts); err != nil {
+			t.Fatalf("导出CSV失败: %v", err)
+		}
+
+		builder, err := New(Config{Key: testKey})
+		if err != nil {
+			t.Fatalf("创建生成器失败: %v", err)
+		}
+		count, err := builder.AddCSV(&csvData)
+		if err != nil {
+			t.Fatalf("读取CSV失败: %v", err)
+		}
+		if count != len(ranges) || builder.Len() != len(ranges) {
+			t.Fatalf("读取 %d 条记录, 期望 %d", count, len(ranges))
+		}
+		for i, r := range builder.ranges {
+			expected := ranges[i]
+			columns := append(append([]string(nil), expected.Columns...), make([]string, 3-len(expected.Columns))...)
+			if r.Start != expected.Start || r.End != expected.End || !reflect.DeepEqual(r.Columns, columns) || r.Other != expected.Other {
+				t.Errorf("%+v: 第 %d 条记录 = %+v, 期望 %+v", opts, i, r, expected)
+			}
+		}
+	}
+
+	errorTests := []string{
+		"1.0.0.0,1.0.0.255\n",
+		"1.0.0.0,bad,中国,电信\n",
+		"1.0.1.0,1.0.1.255,中国,电信\n1.0.0.0,1.0.0.255,中国,电信\n",
+		"1.0.0.0,1.0.0.255,中国,电信\n1.0.0.128,1.0.1.255,中国,电信\n",
+		"1.0.0.0,1.0.0.255,中国,电信\n2001:db8::,2001:db8::ff,中国,电信\n",
+		"start,end,country\n1.0.0.0,1.0.0.255,中国\n",
+	}
+	for _, data := range errorTests {
+		builder, _ := New(Config{Key: testKey})
+		if _, err := builder.AddCSV(strings.NewReader(data)); err == nil {
+			t.Errorf("AddCSV(%q) 应返回错误", data)
+		}
+	}
+}
+
+// TestConfigErrors 测试无效的生成参数和超出格式限制的数据
+func TestConfigErrors(t *testing.T) {
+	for _, config := range []Config{
+		{Key: "invalid"},
+		{Key: "c2hvcnQ="},
+		{Key: testKey, IPVersion: 5},
+		{Key: testKey, ClientId: 4096},
+		{Key: testKey, ExpirationDate: 1 << 20},
+		{Key: testKey, RandomSize: -1},
+	} {
+		if _, err := New(config); err == nil {
+			t.Errorf("New(%+v) 应返回错误", config)
+		}
+	}
+
+	builder, _ := New(Config{Key: testKey})
+	if _, err := builder.WriteTo(&bytes.Buffer{}); err == nil {
+		t.Errorf("没有记录时 WriteTo 应返回错误")
+	}
+
+	r := Range{Start: netip.MustParseAddr("1.0.0.0"), End: netip.MustParseAddr("1.0.0.255"), Other: strings.Repeat("x", 300)}
+	builder.Add(r)
+	if _, err := builder.WriteTo(&bytes.Buffer{}); err == nil {
+		t.Errorf("数据记录过长时 WriteTo 应返回错误")
+	}
+}
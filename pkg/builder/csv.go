@@ -0,0 +1,129 @@
+package builder
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+// CSV 中不属于地理列的字段名称
+const (
+	csvStartIP  = "start_ip"
+	csvEndIP    = "end_ip"
+	csvStartNum = "start_num"
+	csvEndNum   = "end_num"
+	csvOther    = "other"
+)
+
+// AddCSV 从CSV读取按地址升序排列的记录并逐条添加
+//
+// 每行的格式为 start_ip,end_ip,<地理列...>,other，与 export 子命令的CSV输出相同。
+// 第一行的首个字段不是IP地址时视为表头，此时按名称识别 start_ip、end_ip、other，
+// 并忽略 start_num 和 end_num，其余字段按顺序作为地理列。
+//
+// 参数:
+//   - r: CSV数据
+//
+// 返回:
+//   - int: 添加的记录数
+//   - error: 如果CSV格式错误或记录无效则返回带行号的错误
+func (builder *Builder) AddCSV(r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	// 默认布局：前两列为起止IP，最后一列为 otherData
+	startField, endField, otherField := 0, 1, -1
+	var columnFields []int
+
+	count := 0
+	for line := 1; ; line++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("line %d: %v", line, err)
+		}
+		if line == 1 && len(fields) > 0 && !isIP(fields[0]) {
+			startField, endField, otherField, columnFields, err = parseCSVHeader(fields)
+			if err != nil {
+				return count, fmt.Errorf("line %d: %v", line, err)
+			}
+			continue
+		}
+		if columnFields == nil && otherField < 0 {
+			// 没有表头时，中间的字段均为地理列
+			if len(fields) < 3 {
+				return count, fmt.Errorf("line %d: expected at least 3 fields (start_ip,end_ip,...,other), got %d", line, len(fields))
+			}
+			otherField = len(fields) - 1
+			for i := 2; i < otherField; i++ {
+				columnFields = append(columnFields, i)
+			}
+		}
+
+		maxField := otherField
+		for _, field := range append([]int{startField, endField}, columnFields...) {
+			if field > maxField {
+				maxField = field
+			}
+		}
+		if maxField >= len(fields) {
+			return count, fmt.Errorf("line %d: expected %d fields, got %d", line, maxField+1, len(fields))
+		}
+
+		start, err := netip.ParseAddr(strings.TrimSpace(fields[startField]))
+		if err != nil {
+			return count, fmt.Errorf("line %d: invalid start IP: %v", line, err)
+		}
+		end, err := netip.ParseAddr(strings.TrimSpace(fields[endField]))
+		if err != nil {
+			return count, fmt.Errorf("line %d: invalid end IP: %v", line, err)
+		}
+
+		r := Range{Start: start, End: end, Columns: make([]string, len(columnFields))}
+		for i, field := range columnFields {
+			r.Columns[i] = fields[field]
+		}
+		if otherField >= 0 {
+			r.Other = fields[otherField]
+		}
+		if err := builder.Add(r); err != nil {
+			return count, fmt.Errorf("line %d: %v", line, err)
+		}
+		count++
+	}
+}
+
+// parseCSVHeader 按表头中的字段名称确定各字段的位置
+func parseCSVHeader(header []string) (startField, endField, otherField int, columnFields []int, err error) {
+	startField, endField, otherField = -1, -1, -1
+	columnFields = []int{}
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case csvStartIP:
+			startField = i
+		case csvEndIP:
+			endField = i
+		case csvOther:
+			otherField = i
+		case csvStartNum, csvEndNum:
+		default:
+			columnFields = append(columnFields, i)
+		}
+	}
+	if startField < 0 || endField < 0 {
+		return 0, 0, 0, nil, fmt.Errorf("header must contain %s and %s", csvStartIP, csvEndIP)
+	}
+	return startField, endField, otherField, columnFields, nil
+}
+
+// isIP 判断字段是否为IP地址
+func isIP(field string) bool {
+	_, err := netip.ParseAddr(strings.TrimSpace(field))
+	return err == nil
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"sort"
+
+	"github.com/tagphi/czdb-search-golang/pkg/utils"
+)
+
+// batchQuery 是批量查询中的一个IP及其在输入中的位置
+//
+// 使用定长数组而不是切片，排序时交换元素不涉及指针
+type batchQuery struct {
+	ip    [16]byte // 规范化后的IP字节，IPv4只使用前 4 字节
+	index int      // 在输入中的位置
+}
+
+// SearchBatch 批量查询一组IP地址的地理位置信息，结果按输入顺序返回
+//
+// 查询先按IP排序，然后按顺序一次性遍历头部块和索引块：头部行只向前移动，
+// 每个索引页最多读取一次，落在同一区间或指向同一数据记录的IP共用解码结果。
+// 大批量查询时比逐个调用 SearchAddr 少做大量二分查找、文件读取和解码。
+//
+// 共用解码结果的 GeoResult 共享 Columns 等切片，调用方不得修改。
+//
+// 参数:
+//   - ips: 要查询的IP地址，IPv4映射的IPv6地址按IPv4处理，区域标识会被忽略
+//
+// 返回:
+//   - []GeoResult: 与 ips 一一对应的地理位置信息，查询失败的位置为零值
+//   - []error: 与 ips 一一对应的错误，成功时为 nil，未找到时为 ErrNotFound
+func (dbSearcher *DBSearcher) SearchBatch(ips []netip.Addr) ([]GeoResult, []error) {
+	results := make([]GeoResult, len(ips))
+	errs := make([]error, len(ips))
+	fail := func(err error) ([]GeoResult, []error) {
+		for i := range errs {
+			errs[i] = err
+		}
+		return results, errs
+	}
+
+	if dbSearcher == nil {
+		return fail(fmt.Errorf("dbSearcher is nil"))
+	}
+	if err := dbSearcher.acquire(); err != nil {
+		return fail(err)
+	}
+	defer dbSearcher.release()
+	memoryMode, err := dbSearcher.memoryMode()
+	if err != nil {
+		return fail(err)
+	}
+	if memoryMode {
+		if err := dbSearcher.ensureDBBin(); err != nil {
+			return fail(fmt.Errorf("failed to load database into memory: %w", err))
+		}
+	}
+
+	queries := make([]batchQuery, 0, len(ips))
+	for i, addr := range ips {
+		query := batchQuery{index: i}
+		if err := dbSearcher.normalizeAddr(addr, &query.ip); err != nil {
+			errs[i] = err
+			continue
+		}
+		queries = append(queries, query)
+	}
+	sort.Slice(queries, func(a, b int) bool {
+		return bytes.Compare(queries[a].ip[:], queries[b].ip[:]) < 0
+	})
+
+	walker := &batchWalker{
+		dbSearcher: dbSearcher,
+		memoryMode: memoryMode,
+		pagePtr:    -1,
+		decoded:    make(map[uint32]*GeoResult),
+	}
+	for i := range queries {
+		query := &queries[i]
+		result, err := walker.search(query.ip[:dbSearcher.IPBytesLength])
+		if err != nil {
+			errs[query.index] = err
+			continue
+		}
+		results[query.index] = *result
+	}
+	return results, errs
+}
+
+// normalizeAddr 将地址按数据库的IP类型写入 ip，与 normalizeIPBytes 的规则一致但不分配内存
+func (dbSearcher *DBSearcher) normalizeAddr(addr netip.Addr, ip *[16]byte) error {
+	if !addr.IsValid() {
+		return fmt.Errorf("%w: zero netip.Addr", ErrInvalidIP)
+	}
+	unmapped := addr.Unmap()
+	switch {
+	case dbSearcher.IPType == int32(utils.IPV4) && unmapped.Is4():
+		ip4 := unmapped.As4()
+		copy(ip[:], ip4[:])
+		return nil
+	case dbSearcher.IPType == int32(utils.IPV6) && !unmapped.Is4():
+		*ip = addr.As16()
+		return nil
+	}
+	// 不匹配时使用 normalizeIPBytes 生成与单个查询相同的错误
+	_, err := dbSearcher.normalizeIPBytes(addr.AsSlice())
+	return err
+}
+
+// batchWalker 按IP升序遍历头部块和索引块，保存遍历位置和已解码的结果
+type batchWalker struct {
+	dbSearcher *DBSearcher
+	memoryMode bool
+
+	header  int    // 当前头部行，只向前移动
+	pagePtr int32  // 已读取索引页的起始指针，-1 表示尚未读取
+	page    []byte // 已读取的索引页
+	pageErr error  // 读取索引页的错误
+
+	record  *indexRecord          // 上一次命中的索引块
+	result  *GeoResult            // 上一次命中的结果
+	decoded map[uint32]*GeoResult // 按数据指针缓存的解码结果
+}
+
+// search 查找不小于上一次查询的IP，未找到时返回 ErrNotFound
+func (walker *batchWalker) search(ipBytes []byte) (*GeoResult, error) {
+	dbSearcher := walker.dbSearcher
+	ipLen := dbSearcher.IPBytesLength
+
+	// 与上一个IP落在同一区间时直接复用结果
+	if walker.record != nil &&
+		utils.CompareBytes(ipBytes, walker.record.StartIP, ipLen) >= 0 &&
+		utils.CompareBytes(ipBytes, walker.record.EndIP, ipLen) <= 0 {
+		return walker.result, nil
+	}
+
+	// 头部行前移到起始IP不大于该IP的最后一行
+	param := dbSearcher.BtreeModeParam
+	if param.HeaderLength == 0 {
+		return nil, ErrNotFound
+	}
+	for walker.header+1 < param.HeaderLength &&
+		utils.CompareBytes(param.HeaderSip[walker.header+1], ipBytes, ipLen) <= 0 {
+		walker.header++
+	}
+	if utils.CompareBytes(ipBytes, param.HeaderSip[walker.header], ipLen) < 0 {
+		return nil, ErrNotFound
+	}
+
+	blen := dbSearcher.IndexLength
+	sptr := param.HeaderPtr[walker.header]
+	eptr := sptr + blen
+	if walker.header+1 < param.HeaderLength {
+		eptr = param.HeaderPtr[walker.header+1]
+	}
+	if sptr == 0 {
+		return nil, ErrNotFound
+	}
+
+	// 每个索引页只读取一次，与 searchIndexRecord 一样多读一个索引块
+	if sptr != walker.pagePtr {
+		readLen := eptr - sptr + blen
+		if limit := dbSearcher.EndIndexPtr + blen - sptr; readLen > limit {
+			readLen = limit
+		}
+		walker.pagePtr = sptr
+		walker.page, walker.pageErr = dbSearcher.readDBBytes(int64(sptr), int(readLen), walker.memoryMode)
+		if walker.pageErr != nil {
+			walker.pageErr = newCorruptError(SectionIndex, dbSearcher.FileOffset+int64(sptr), "failed to read index buffer: %v", walker.pageErr)
+		}
+	}
+	if walker.pageErr != nil {
+		return nil, walker.pageErr
+	}
+
+	record, err := searchIndexPage(dbSearcher, walker.page, int((eptr-sptr)/blen), ipBytes, sptr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 不同区间可能指向同一条数据记录
+	result, ok := walker.decoded[record.DataPtr]
+	if !ok {
+		result, err = decodeIndexRecord(dbSearcher, record, walker.memoryMode)
+		if err != nil {
+			return nil, err
+		}
+		walker.decoded[record.DataPtr] = result
+	}
+	walker.record, walker.result = record, result
+	return result, nil
+}
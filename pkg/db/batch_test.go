@@ -0,0 +1,206 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+// batchTestAddrs 返回覆盖区间边界、空隙、重复IP和随机IP的查询，顺序被打乱
+func batchTestAddrs(ranges []testRange, random int) []netip.Addr {
+	var addrs []netip.Addr
+	for _, r := range ranges {
+		start, end := netip.MustParseAddr(r.start), netip.MustParseAddr(r.end)
+		addrs = append(addrs, start, end, start.Prev(), end.Next(), start.Next(), start)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	first := netip.MustParseAddr(ranges[0].start)
+	for i := 0; i < random; i++ {
+		if first.Is4() {
+			var ip [4]byte
+			binary.BigEndian.PutUint32(ip[:], rng.Uint32())
+			addrs = append(addrs, netip.AddrFrom4(ip))
+		} else {
+			// 只改变低位，使随机IP落在测试区间附近
+			ip := netip.MustParseAddr(ranges[rng.Intn(len(ranges))].start).As16()
+			binary.BigEndian.PutUint32(ip[12:], rng.Uint32()>>rng.Intn(32))
+			addrs = append(addrs, netip.AddrFrom16(ip))
+		}
+	}
+	rng.Shuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+	return addrs
+}
+
+// checkSearchBatch 比较批量查询和逐个 SearchAddr 的结果
+func checkSearchBatch(t *testing.T, dbSearcher *DBSearcher, addrs []netip.Addr) {
+	t.Helper()
+
+	results, errs := dbSearcher.SearchBatch(addrs)
+	if len(results) != len(addrs) || len(errs) != len(addrs) {
+		t.Fatalf("结果数 = %d, 错误数 = %d, 期望 %d", len(results), len(errs), len(addrs))
+	}
+	for i, addr := range addrs {
+		expected, expectedErr := dbSearcher.SearchAddr(addr)
+		if expectedErr != nil {
+			if errs[i] == nil || errs[i].Error() != expectedErr.Error() {
+				t.Errorf("%s: 错误 = %v, 期望 %v", addr, errs[i], expectedErr)
+			}
+			if !reflect.DeepEqual(results[i], GeoResult{}) {
+				t.Errorf("%s: 失败的查询结果应为零值: %+v", addr, results[i])
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Errorf("%s: 返回错误 %v", addr, errs[i])
+			continue
+		}
+		if !reflect.DeepEqual(results[i], *expected) {
+			t.Errorf("%s: 结果 = %+v, 期望 %+v", addr, results[i], *expected)
+		}
+	}
+}
+
+// TestSearchBatch 测试三种模式下批量查询的结果与逐个查询一致
+func TestSearchBatch(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		ipv6   bool
+		ranges []testRange
+	}{
+		{"IPv4", false, testRanges},
+		{"IPv6", true, testRangesV6},
+	} {
+		path := writeTestDB(t, tc.ipv6, tc.ranges)
+		addrs := batchTestAddrs(tc.ranges, 200)
+		for _, searchType := range []SearchType{MEMORY, BTREE, MMAP} {
+			t.Run(fmt.Sprintf("%s/%d", tc.name, searchType), func(t *testing.T) {
+				dbSearcher, err := InitDBSearcher(path, testDBKey, searchType)
+				if err != nil {
+					t.Fatalf("初始化数据库搜索器失败: %v", err)
+				}
+				defer CloseDBSearcher(dbSearcher)
+				checkSearchBatch(t, dbSearcher, addrs)
+			})
+		}
+	}
+}
+
+// TestSearchBatchErrors 测试无效IP、IP类型不同、空输入和已关闭的搜索器
+func TestSearchBatchErrors(t *testing.T) {
+	dbSearcher, err := OpenBytes(buildTestDB(t, false, testRanges), testDBKey, nil)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+
+	addrs := []netip.Addr{
+		netip.MustParseAddr("8.8.8.8"),
+		{},
+		netip.MustParseAddr("2400:3200::1"),
+		netip.MustParseAddr("::ffff:1.0.1.1"),
+		netip.MustParseAddr("9.9.9.9"),
+		netip.MustParseAddr("8.8.8.8"),
+	}
+	results, errs := dbSearcher.SearchBatch(addrs)
+	expectedErrs := []error{nil, ErrInvalidIP, ErrIPVersionMismatch, nil, ErrNotFound, nil}
+	for i, expected := range expectedErrs {
+		if expected == nil && errs[i] != nil || expected != nil && !errors.Is(errs[i], expected) {
+			t.Errorf("%s: 错误 = %v, 期望 %v", addrs[i], errs[i], expected)
+		}
+	}
+	if results[0].String() != "美国\tnull\tnull\tGoogle" || results[3].String() != "中国\t福建\t福州\t电信" {
+		t.Errorf("结果 = %q, %q", results[0].String(), results[3].String())
+	}
+	checkSearchBatch(t, dbSearcher, addrs)
+
+	if results, errs := dbSearcher.SearchBatch(nil); len(results) != 0 || len(errs) != 0 {
+		t.Errorf("空输入返回了 %d 个结果", len(results))
+	}
+
+	CloseDBSearcher(dbSearcher)
+	_, errs = dbSearcher.SearchBatch(addrs[:2])
+	for _, err := range errs {
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("已关闭的搜索器返回 %v, 期望 %v", err, ErrClosed)
+		}
+	}
+}
+
+// benchmarkRanges 生成 count 个相邻的 /24 区间，地理信息按区间循环重复
+func benchmarkRanges(count int) []testRange {
+	cities := []string{"北京", "上海", "广州", "深圳", "杭州", "成都"}
+	ranges := make([]testRange, count)
+	for i := range ranges {
+		start := netip.AddrFrom4([4]byte{byte(1 + i>>16), byte(i >> 8), byte(i), 0})
+		end := netip.AddrFrom4([4]byte{byte(1 + i>>16), byte(i >> 8), byte(i), 255})
+		ranges[i] = testRange{start.String(), end.String(), []string{"中国", "", cities[i%len(cities)]}, "电信"}
+	}
+	return ranges
+}
+
+// benchmarkAddrs 生成 count 个落在 benchmarkRanges 中的随机IP，从 distinct 个不同的IP中抽取
+func benchmarkAddrs(ranges, count, distinct int) []netip.Addr {
+	rng := rand.New(rand.NewSource(1))
+	pool := make([]netip.Addr, distinct)
+	for i := range pool {
+		r := rng.Intn(ranges)
+		pool[i] = netip.AddrFrom4([4]byte{byte(1 + r>>16), byte(r >> 8), byte(r), byte(rng.Intn(256))})
+	}
+	addrs := make([]netip.Addr, count)
+	for i := range addrs {
+		addrs[i] = pool[rng.Intn(distinct)]
+	}
+	return addrs
+}
+
+// benchmarkSearch 在三种模式下运行批量查询基准测试
+//
+// unique 中每个IP基本只出现一次；repeated 模拟访问日志，10000 次查询只涉及 500 个IP。
+func benchmarkSearch(b *testing.B, search func(dbSearcher *DBSearcher, addrs []netip.Addr)) {
+	const rangeCount, batchSize = 20000, 10000
+	path := writeTestDB(b, false, benchmarkRanges(rangeCount))
+	workloads := []struct {
+		name  string
+		addrs []netip.Addr
+	}{
+		{"unique", benchmarkAddrs(rangeCount, batchSize, batchSize)},
+		{"repeated", benchmarkAddrs(rangeCount, batchSize, 500)},
+	}
+
+	for _, searchType := range []SearchType{MEMORY, BTREE, MMAP} {
+		dbSearcher, err := InitDBSearcher(path, testDBKey, searchType)
+		if err != nil {
+			b.Fatalf("初始化数据库搜索器失败: %v", err)
+		}
+		for _, workload := range workloads {
+			name := map[SearchType]string{MEMORY: "memory", BTREE: "btree", MMAP: "mmap"}[searchType] + "/" + workload.name
+			b.Run(name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					search(dbSearcher, workload.addrs)
+				}
+			})
+		}
+		CloseDBSearcher(dbSearcher)
+	}
+}
+
+// BenchmarkSearchBatch 测试 SearchBatch 的吞吐量
+func BenchmarkSearchBatch(b *testing.B) {
+	benchmarkSearch(b, func(dbSearcher *DBSearcher, addrs []netip.Addr) {
+		dbSearcher.SearchBatch(addrs)
+	})
+}
+
+// BenchmarkSearchLoop 测试逐个调用 SearchAddr 的吞吐量，作为 SearchBatch 的对照
+func BenchmarkSearchLoop(b *testing.B) {
+	benchmarkSearch(b, func(dbSearcher *DBSearcher, addrs []netip.Addr) {
+		for _, addr := range addrs {
+			dbSearcher.SearchAddr(addr)
+		}
+	})
+}
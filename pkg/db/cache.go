@@ -0,0 +1,210 @@
+package db
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// CacheStats 是查询结果缓存的统计信息
+type CacheStats struct {
+	Capacity  int    `json:"capacity"`  // 最多缓存的区间数，0 表示未启用缓存
+	Entries   int    `json:"entries"`   // 当前缓存的区间数
+	Hits      uint64 `json:"hits"`      // 命中次数
+	Misses    uint64 `json:"misses"`    // 未命中次数，包括数据库中没有的IP
+	Evictions uint64 `json:"evictions"` // 因缓存已满而淘汰的区间数
+}
+
+// HitRatio 返回命中率，没有查询时返回 0
+func (stats CacheStats) HitRatio() float64 {
+	total := stats.Hits + stats.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(stats.Hits) / float64(total)
+}
+
+// rangeCache 按命中的区间缓存查询结果，区间内的任意IP都可以命中
+//
+// 区间按起始IP排序保存，查询时二分查找；缓存已满时使用 CLOCK 算法淘汰最近未被
+// 命中的区间。命中只需要读锁，插入和淘汰需要写锁。
+type rangeCache struct {
+	capacity int
+
+	mu      sync.RWMutex
+	entries []*cacheEntry // 按起始IP排序
+	clock   []*cacheEntry // CLOCK 淘汰使用的环形缓冲区
+	hand    int           // CLOCK 指针
+	closed  bool          // 搜索器关闭后不再缓存新的结果
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// cacheEntry 是一个缓存的区间及其查询结果
+type cacheEntry struct {
+	record     *indexRecord
+	result     *GeoResult
+	referenced atomic.Bool // 上次被 CLOCK 指针经过后是否被命中
+}
+
+// newRangeCache 创建最多缓存 capacity 个区间的缓存
+func newRangeCache(capacity int) *rangeCache {
+	return &rangeCache{capacity: capacity}
+}
+
+// search 返回 entries 中起始IP大于 ipBytes 的第一个位置
+func (cache *rangeCache) search(ipBytes []byte) int {
+	return sort.Search(len(cache.entries), func(i int) bool {
+		return bytes.Compare(cache.entries[i].record.StartIP, ipBytes) > 0
+	})
+}
+
+// get 查找包含该IP的缓存区间
+func (cache *rangeCache) get(ipBytes []byte) (*indexRecord, *GeoResult, bool) {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	if i := cache.search(ipBytes) - 1; i >= 0 {
+		entry := cache.entries[i]
+		if bytes.Compare(ipBytes, entry.record.EndIP) <= 0 {
+			entry.referenced.Store(true)
+			cache.hits.Add(1)
+			return entry.record, entry.result, true
+		}
+	}
+	cache.misses.Add(1)
+	return nil, nil, false
+}
+
+// put 缓存一个区间的查询结果，缓存已满时先淘汰一个区间
+func (cache *rangeCache) put(record *indexRecord, result *GeoResult) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.closed {
+		return
+	}
+
+	// 并发查询可能已经缓存了同一个区间
+	i := cache.search(record.StartIP)
+	if i > 0 && bytes.Equal(cache.entries[i-1].record.StartIP, record.StartIP) {
+		return
+	}
+
+	entry := &cacheEntry{record: record, result: result}
+	if len(cache.clock) < cache.capacity {
+		cache.clock = append(cache.clock, entry)
+	} else {
+		// 跳过最近被命中的区间并清除其标记，淘汰第一个未被命中的区间
+		for cache.clock[cache.hand].referenced.Swap(false) {
+			cache.hand = (cache.hand + 1) % len(cache.clock)
+		}
+		evicted := cache.clock[cache.hand]
+		cache.clock[cache.hand] = entry
+		cache.hand = (cache.hand + 1) % len(cache.clock)
+		cache.evictions.Add(1)
+
+		j := cache.search(evicted.record.StartIP) - 1
+		cache.entries = append(cache.entries[:j], cache.entries[j+1:]...)
+		if j < i {
+			i--
+		}
+	}
+
+	cache.entries = append(cache.entries, nil)
+	copy(cache.entries[i+1:], cache.entries[i:])
+	cache.entries[i] = entry
+}
+
+// purge 清空缓存，统计信息保留
+func (cache *rangeCache) purge() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries = nil
+	cache.clock = nil
+	cache.hand = 0
+}
+
+// close 清空缓存，并拒绝之后与关闭并发的查询写入的结果
+func (cache *rangeCache) close() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries = nil
+	cache.clock = nil
+	cache.hand = 0
+	cache.closed = true
+}
+
+// stats 返回当前的统计信息
+func (cache *rangeCache) stats() CacheStats {
+	cache.mu.RLock()
+	entries := len(cache.entries)
+	cache.mu.RUnlock()
+	return CacheStats{
+		Capacity:  cache.capacity,
+		Entries:   entries,
+		Hits:      cache.hits.Load(),
+		Misses:    cache.misses.Load(),
+		Evictions: cache.evictions.Load(),
+	}
+}
+
+// CacheStats 返回查询结果缓存的统计信息，未启用缓存时返回零值
+//
+// 返回:
+//   - CacheStats: 缓存的容量、区间数及命中、未命中和淘汰次数
+func (dbSearcher *DBSearcher) CacheStats() CacheStats {
+	if dbSearcher == nil || dbSearcher.cache == nil {
+		return CacheStats{}
+	}
+	return dbSearcher.cache.stats()
+}
+
+// PurgeCache 清空查询结果缓存，统计信息保留，未启用缓存时不做任何事
+func (dbSearcher *DBSearcher) PurgeCache() {
+	if dbSearcher != nil && dbSearcher.cache != nil {
+		dbSearcher.cache.purge()
+	}
+}
+
+// searchRecordCached 查找包含该IP的索引块并解码数据记录，启用缓存时先查找缓存
+//
+// 缓存的结果被多个查询共享，这里返回包括 Columns 和 ColumnIndexes 在内的副本，调用方可以任意修改。
+func searchRecordCached(dbSearcher *DBSearcher, ipBytes []byte, memoryMode bool) (*indexRecord, *GeoResult, error) {
+	if err := dbSearcher.acquire(); err != nil {
+		return nil, nil, err
+	}
+	defer dbSearcher.release()
+
+	cache := dbSearcher.cache
+	if cache != nil {
+		if record, result, ok := cache.get(ipBytes); ok {
+			return record, copyGeoResult(result), nil
+		}
+	}
+
+	record, err := searchIndexRecord(dbSearcher, ipBytes, memoryMode)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := decodeIndexRecord(dbSearcher, record, memoryMode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cache != nil {
+		cache.put(record, result)
+		result = copyGeoResult(result)
+	}
+	return record, result, nil
+}
+
+// copyGeoResult 复制缓存的结果，Schema 属于搜索器，仍然共享
+func copyGeoResult(result *GeoResult) *GeoResult {
+	copied := *result
+	copied.Columns = append([]string(nil), result.Columns...)
+	copied.ColumnIndexes = append([]int(nil), result.ColumnIndexes...)
+	return &copied
+}
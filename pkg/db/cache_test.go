@@ -0,0 +1,161 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestRangeCache 测试按区间命中、CLOCK 淘汰和统计信息
+func TestRangeCache(t *testing.T) {
+	dbSearcher, err := OpenFile(writeTestDB(t, false, testRanges), testDBKey, &Options{SearchType: BTREE, CacheSize: 2})
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(dbSearcher)
+
+	search := func(ip string) string {
+		t.Helper()
+		region, err := Search(ip, dbSearcher)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			t.Fatalf("查询 %s 失败: %v", ip, err)
+		}
+		return region
+	}
+	checkStats := func(expected CacheStats) {
+		t.Helper()
+		if stats := dbSearcher.CacheStats(); stats != expected {
+			t.Errorf("统计信息 = %+v, 期望 %+v", stats, expected)
+		}
+	}
+
+	// 同一区间内的其他IP直接命中
+	search("1.0.1.1")
+	if region := search("1.0.3.200"); region != "中国\t福建\t福州\t电信" {
+		t.Errorf("命中缓存的结果 = %q", region)
+	}
+	result, ipRange, err := dbSearcher.SearchAddrRange(netip.MustParseAddr("1.0.2.0"))
+	if err != nil || ipRange.String() != "1.0.1.0-1.0.3.255" || result.String() != "中国\t福建\t福州\t电信" {
+		t.Errorf("SearchAddrRange = %v, %v, %v", result, ipRange, err)
+	}
+	checkStats(CacheStats{Capacity: 2, Entries: 1, Hits: 2, Misses: 1})
+
+	// 未找到的IP不缓存
+	search("9.9.9.9")
+	checkStats(CacheStats{Capacity: 2, Entries: 1, Hits: 2, Misses: 2})
+
+	// 缓存已满时淘汰最近未被命中的 8.8.8.0/24，保留被命中过的 1.0.1.0-1.0.3.255
+	search("8.8.8.8")
+	search("114.114.114.114")
+	checkStats(CacheStats{Capacity: 2, Entries: 2, Hits: 2, Misses: 4, Evictions: 1})
+	search("1.0.1.1")
+	search("8.8.4.4")
+	search("8.8.8.8")
+	checkStats(CacheStats{Capacity: 2, Entries: 2, Hits: 3, Misses: 6, Evictions: 2})
+
+	// 修改返回的结果不影响缓存
+	result, _ = dbSearcher.SearchAddr(netip.MustParseAddr("8.8.8.8"))
+	result.OtherData = "modified"
+	result.Columns[0] = "modified"
+	result.ColumnIndexes[0] = 2
+	if region := search("8.8.8.1"); region != "美国\tnull\tnull\tGoogle" {
+		t.Errorf("修改结果后缓存的结果 = %q", region)
+	}
+
+	dbSearcher.PurgeCache()
+	if stats := dbSearcher.CacheStats(); stats.Entries != 0 || stats.Hits != 5 {
+		t.Errorf("清空后的统计信息 = %+v", stats)
+	}
+
+	CloseDBSearcher(dbSearcher)
+	if _, err := dbSearcher.SearchAddr(netip.MustParseAddr("8.8.8.8")); !errors.Is(err, ErrClosed) {
+		t.Errorf("关闭后查询返回 %v, 期望 %v", err, ErrClosed)
+	}
+	if stats := dbSearcher.CacheStats(); stats.Entries != 0 {
+		t.Errorf("关闭后仍缓存了 %d 个区间", stats.Entries)
+	}
+}
+
+// TestRangeCacheConsistency 测试并发查询时缓存的结果与不使用缓存时一致，且区间保持有序
+func TestRangeCacheConsistency(t *testing.T) {
+	path := writeTestDB(t, false, testRanges)
+	for _, searchType := range []SearchType{MEMORY, BTREE, MMAP} {
+		t.Run(searchTypeToString(searchType), func(t *testing.T) {
+			dbSearcher, err := OpenFile(path, testDBKey, &Options{SearchType: searchType, CacheSize: 3})
+			if err != nil {
+				t.Fatalf("初始化数据库搜索器失败: %v", err)
+			}
+			defer CloseDBSearcher(dbSearcher)
+
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 200; i++ {
+						query := concurrentQueries[(g+i)%len(concurrentQueries)]
+						region, err := Search(query.ip, dbSearcher)
+						if query.expected == "" {
+							if !errors.Is(err, ErrNotFound) {
+								t.Errorf("%s: 期望 ErrNotFound, 实际 %q, %v", query.ip, region, err)
+							}
+						} else if err != nil || region != query.expected {
+							t.Errorf("%s: 结果 = %q, %v, 期望 %q", query.ip, region, err, query.expected)
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			cache := dbSearcher.cache
+			if len(cache.entries) != 3 || len(cache.clock) != 3 {
+				t.Fatalf("缓存了 %d 个区间, CLOCK 中有 %d 个", len(cache.entries), len(cache.clock))
+			}
+			for i := 1; i < len(cache.entries); i++ {
+				if bytes.Compare(cache.entries[i-1].record.EndIP, cache.entries[i].record.StartIP) >= 0 {
+					t.Errorf("缓存的区间未按顺序排列")
+				}
+			}
+			stats := dbSearcher.CacheStats()
+			if stats.Hits+stats.Misses != 8*200 || stats.Hits == 0 || stats.Evictions == 0 {
+				t.Errorf("统计信息 = %+v", stats)
+			}
+		})
+	}
+}
+
+// TestReloadableCache 测试重新加载后使用新的空缓存
+func TestReloadableCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.czdb")
+	if err := os.WriteFile(path, buildTestDB(t, false, testRanges), 0644); err != nil {
+		t.Fatalf("写入测试数据库失败: %v", err)
+	}
+	reloadable, err := OpenReloadable(path, testDBKey, &Options{SearchType: BTREE, CacheSize: 16})
+	if err != nil {
+		t.Fatalf("初始化可热加载搜索器失败: %v", err)
+	}
+	defer reloadable.Close()
+
+	reloadable.Search("8.8.8.8")
+	reloadable.Search("8.8.8.9")
+	if stats := reloadable.CacheStats(); stats.Entries != 1 || stats.Hits != 1 {
+		t.Errorf("统计信息 = %+v", stats)
+	}
+
+	if err := os.WriteFile(path, buildTestDB(t, false, testRangesUpdated), 0644); err != nil {
+		t.Fatalf("写入测试数据库失败: %v", err)
+	}
+	if err := reloadable.Reload(); err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	if stats := reloadable.CacheStats(); stats.Capacity != 16 || stats.Entries != 0 || stats.Hits != 0 {
+		t.Errorf("重新加载后的统计信息 = %+v", stats)
+	}
+	if region, err := reloadable.Search("8.8.8.9"); err != nil || region != "美国\t加利福尼亚\tnull\tGoogle LLC" {
+		t.Errorf("重新加载后的结果 = %q, %v", region, err)
+	}
+}
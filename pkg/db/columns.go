@@ -0,0 +1,169 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// DefaultColumnSchema 是纯真 (cz88) 数据库地理映射的默认列布局，按原始列索引排列
+var DefaultColumnSchema = []string{"country", "province", "city", "district", "isp"}
+
+// ColumnName 返回原始列索引对应的列名称，schema 中没有该列时返回 "column_<索引>"
+//
+// 参数:
+//   - schema: 列名称，按原始列索引排列
+//   - index: 地理映射中的原始列索引
+//
+// 返回:
+//   - string: 列名称
+func ColumnName(schema []string, index int) string {
+	if index >= 0 && index < len(schema) && schema[index] != "" {
+		return schema[index]
+	}
+	return "column_" + strconv.Itoa(index)
+}
+
+// columnIndex 返回列名称对应的原始列索引，也接受 "column_<索引>" 形式
+func columnIndex(schema []string, name string) (int, bool) {
+	for i, columnName := range schema {
+		if columnName == name {
+			return i, true
+		}
+	}
+	if suffix := strings.TrimPrefix(name, "column_"); suffix != name {
+		if index, err := strconv.Atoi(suffix); err == nil && index >= 0 && strconv.Itoa(index) == suffix {
+			return index, true
+		}
+	}
+	return 0, false
+}
+
+// geoMapColumns 返回地理映射中每条记录包含的列数，即第一条记录的数组长度
+func geoMapColumns(geoMapData []byte) int {
+	if len(geoMapData) == 0 {
+		return 0
+	}
+	columnNumber, err := msgpack.NewDecoder(bytes.NewReader(geoMapData)).DecodeArrayLen()
+	if err != nil || columnNumber < 0 {
+		return 0
+	}
+	return columnNumber
+}
+
+// AvailableColumns 返回地理映射中实际包含的列名称，按原始列索引排列
+//
+// 文件中的 ColumnSelection 只决定默认返回哪些列，地理映射中的其他列也可以通过
+// SelectColumns 选择。
+//
+// 返回:
+//   - []string: 列名称
+func (dbSearcher *DBSearcher) AvailableColumns() []string {
+	names := make([]string, dbSearcher.geoColumns)
+	for i := range names {
+		names[i] = ColumnName(dbSearcher.Schema, i)
+	}
+	return names
+}
+
+// SelectColumns 将列名称转换为列选择位掩码，可用于 Options.Columns 和 SearchAddrColumns
+//
+// 参数:
+//   - names: 列名称，按 Schema 解析，也可以使用 "column_<索引>"
+//
+// 返回:
+//   - int32: 列选择位掩码，第 i 列对应第 i+1 位
+//   - error: 如果列名称未知或地理映射中没有该列则返回错误
+func (dbSearcher *DBSearcher) SelectColumns(names ...string) (int32, error) {
+	var selection int32
+	for _, name := range names {
+		index, err := dbSearcher.ColumnIndex(name)
+		if err != nil {
+			return 0, err
+		}
+		selection |= 1 << (index + 1)
+	}
+	return selection, nil
+}
+
+// ColumnIndex 返回列名称对应的原始列索引
+//
+// 参数:
+//   - name: 列名称，按 Schema 解析，也可以使用 "column_<索引>"
+//
+// 返回:
+//   - int: 地理映射中的原始列索引
+//   - error: 如果列名称未知或地理映射中没有该列则返回错误
+func (dbSearcher *DBSearcher) ColumnIndex(name string) (int, error) {
+	index, ok := columnIndex(dbSearcher.Schema, name)
+	if !ok {
+		return 0, fmt.Errorf("unknown column %q", name)
+	}
+	if index >= dbSearcher.geoColumns {
+		return 0, fmt.Errorf("column %q (index %d) is not in the geo map, which has %d columns", name, index, dbSearcher.geoColumns)
+	}
+	return index, nil
+}
+
+// checkSelection 检查列选择位掩码只选择了地理映射中存在的列
+func (dbSearcher *DBSearcher) checkSelection(selection int32) error {
+	for _, index := range SelectedColumns(selection) {
+		if index >= dbSearcher.geoColumns {
+			return fmt.Errorf("column selection %#x includes column %d, but the geo map has %d columns", uint32(selection), index, dbSearcher.geoColumns)
+		}
+	}
+	return nil
+}
+
+// Selection 返回查询默认使用的列选择位掩码
+//
+// 未通过 Options.Columns 指定时与文件中的 ColumnSelection 相同。
+//
+// 返回:
+//   - int32: 列选择位掩码
+func (dbSearcher *DBSearcher) Selection() int32 {
+	return dbSearcher.selection
+}
+
+// SearchAddrColumns 使用指定的列选择查询地理位置信息，不影响其他查询
+//
+// 参数:
+//   - addr: 要查询的IP地址
+//   - selection: SelectColumns 返回的列选择位掩码
+//
+// 返回:
+//   - *GeoResult: 只包含选中列的地理位置信息
+//   - error: 如果选择了地理映射中不存在的列或搜索失败则返回错误，未找到时返回 ErrNotFound
+func (dbSearcher *DBSearcher) SearchAddrColumns(addr netip.Addr, selection int32) (*GeoResult, error) {
+	if dbSearcher == nil {
+		return nil, fmt.Errorf("dbSearcher is nil")
+	}
+	if err := dbSearcher.checkSelection(selection); err != nil {
+		return nil, err
+	}
+	if !addr.IsValid() {
+		return nil, fmt.Errorf("%w: zero netip.Addr", ErrInvalidIP)
+	}
+
+	ipBytes, err := dbSearcher.normalizeIPBytes(addr.AsSlice())
+	if err != nil {
+		return nil, err
+	}
+	memoryMode, err := dbSearcher.memoryMode()
+	if err != nil {
+		return nil, err
+	}
+	if err := dbSearcher.acquire(); err != nil {
+		return nil, err
+	}
+	defer dbSearcher.release()
+	record, err := searchIndexRecord(dbSearcher, ipBytes, memoryMode)
+	if err != nil {
+		return nil, err
+	}
+	return decodeIndexRecordColumns(dbSearcher, record, memoryMode, selection)
+}
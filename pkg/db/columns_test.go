@@ -0,0 +1,125 @@
+package db
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+// TestColumnSchema 测试按名称读取列值和自定义列名称
+func TestColumnSchema(t *testing.T) {
+	data := buildTestDB(t, false, testRanges)
+	dbSearcher, err := OpenBytes(data, testDBKey, nil)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(dbSearcher)
+
+	result, err := dbSearcher.SearchAddr(netip.MustParseAddr("1.0.1.1"))
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if value, ok := result.Get("city"); !ok || value != "福州" {
+		t.Errorf("Get(city) = %q, %v", value, ok)
+	}
+	if _, ok := result.Get("district"); ok {
+		t.Errorf("未选中的列 Get(district) 应返回 false")
+	}
+	if value, ok := result.Get("column_1"); !ok || value != "福建" {
+		t.Errorf("Get(column_1) = %q, %v", value, ok)
+	}
+	expected := map[string]string{"country": "中国", "province": "福建", "city": "福州"}
+	if !reflect.DeepEqual(result.Map(), expected) {
+		t.Errorf("Map = %v, 期望 %v", result.Map(), expected)
+	}
+	if !reflect.DeepEqual(dbSearcher.AvailableColumns(), []string{"country", "province", "city"}) {
+		t.Errorf("AvailableColumns = %v", dbSearcher.AvailableColumns())
+	}
+	if index, err := dbSearcher.ColumnIndex("province"); err != nil || index != 1 {
+		t.Errorf("ColumnIndex(province) = %d, %v", index, err)
+	}
+	for _, name := range []string{"district", "unknown"} {
+		if _, err := dbSearcher.ColumnIndex(name); err == nil {
+			t.Errorf("ColumnIndex(%s) 应返回错误", name)
+		}
+	}
+
+	custom, err := OpenBytes(data, testDBKey, &Options{Schema: []string{"国家", "省份"}})
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(custom)
+	result, _ = custom.SearchAddr(netip.MustParseAddr("1.0.1.1"))
+	expected = map[string]string{"国家": "中国", "省份": "福建", "column_2": "福州"}
+	if !reflect.DeepEqual(result.Map(), expected) {
+		t.Errorf("自定义列名称 Map = %v, 期望 %v", result.Map(), expected)
+	}
+}
+
+// TestColumnSelection 测试覆盖文件中的列选择，且只能选择地理映射中存在的列
+func TestColumnSelection(t *testing.T) {
+	data := buildTestDB(t, false, testRanges)
+	probe, err := OpenBytes(data, testDBKey, nil)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	// 将文件中的列选择改为只有国家
+	selectionOffset := probe.FileOffset + int64(probe.EndIndexPtr) + int64(probe.IndexLength)
+	CloseDBSearcher(probe)
+	binary.LittleEndian.PutUint32(data[selectionOffset:], 1<<1)
+
+	dbSearcher, err := OpenBytes(data, testDBKey, nil)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(dbSearcher)
+	addr := netip.MustParseAddr("1.0.1.1")
+
+	result, err := dbSearcher.SearchAddr(addr)
+	if err != nil || !reflect.DeepEqual(result.Columns, []string{"中国"}) {
+		t.Fatalf("默认列选择结果 = %v, %v", result, err)
+	}
+
+	// 单次查询选择文件未选中、但地理映射中存在的列
+	selection, err := dbSearcher.SelectColumns("city", "country")
+	if err != nil {
+		t.Fatalf("SelectColumns 返回错误: %v", err)
+	}
+	result, err = dbSearcher.SearchAddrColumns(addr, selection)
+	if err != nil || !reflect.DeepEqual(result.Columns, []string{"中国", "福州"}) || !reflect.DeepEqual(result.ColumnIndexes, []int{0, 2}) {
+		t.Errorf("SearchAddrColumns 结果 = %+v, %v", result, err)
+	}
+	if result, _ := dbSearcher.SearchAddr(addr); len(result.Columns) != 1 {
+		t.Errorf("单次查询的列选择影响了其他查询: %v", result.Columns)
+	}
+
+	// 直接构造的位掩码不能超出地理映射中的列
+	for _, selection := range []int32{1 << 4, 1<<1 | 1<<5, -1 << 1} {
+		if _, err := dbSearcher.SearchAddrColumns(addr, selection); err == nil {
+			t.Errorf("SearchAddrColumns(%#x) 应返回错误", uint32(selection))
+		}
+	}
+
+	for _, names := range [][]string{{"district"}, {"isp"}, {"unknown"}, {"column_3"}} {
+		if _, err := dbSearcher.SelectColumns(names...); err == nil {
+			t.Errorf("SelectColumns(%v) 应返回错误", names)
+		}
+	}
+
+	// 搜索器级别的列选择同时作用于所有查询接口
+	override, err := OpenBytes(data, testDBKey, &Options{SearchType: BTREE, Columns: []string{"province"}})
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(override)
+	if region, err := Search("1.0.1.1", override); err != nil || region != "福建\t电信" {
+		t.Errorf("Search = %q, %v", region, err)
+	}
+	if override.Selection() != 1<<2 || override.ColumnSelection != 1<<1 {
+		t.Errorf("Selection = %d, ColumnSelection = %d", override.Selection(), override.ColumnSelection)
+	}
+	if _, err := OpenBytes(data, testDBKey, &Options{Columns: []string{"district"}}); err == nil {
+		t.Errorf("选择地理映射中不存在的列时打开应失败")
+	}
+}
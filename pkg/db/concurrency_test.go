@@ -0,0 +1,190 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"testing"
+)
+
+// 测试用的查询及期望结果 (旧版字符串格式)，空字符串表示未找到
+var concurrentQueries = []struct {
+	ip       string
+	expected string
+}{
+	{"1.0.0.0", "澳大利亚\tnull\tnull\tAPNIC"},
+	{"1.0.0.1", "澳大利亚\tnull\tnull\tAPNIC"},
+	{"1.0.2.3", "中国\t福建\t福州\t电信"},
+	{"8.8.8.8", "美国\tnull\tnull\tGoogle"},
+	{"10.0.0.0", "局域网\tnull\tnull\t"},
+	{"10.1.2.3", "局域网\tnull\tnull\t"},
+	{"114.114.114.114", "中国\t江苏\t南京\t信风"},
+	{"192.168.255.255", "局域网\tnull\tnull\t"},
+	{"223.5.5.5", "中国\t浙江\t杭州\t阿里云"},
+	{"223.5.5.0", "中国\t浙江\t杭州\t阿里云"},
+	{"0.0.0.1", ""},
+	{"9.9.9.9", ""},
+	{"255.255.255.255", ""},
+}
+
+// TestSearchModes 测试内存模式与B树模式的查询结果
+func TestSearchModes(t *testing.T) {
+	path := writeTestDB(t, false, testRanges)
+
+	for _, searchType := range []SearchType{MEMORY, BTREE, MMAP} {
+		dbSearcher, err := InitDBSearcher(path, testDBKey, searchType)
+		if err != nil {
+			t.Fatalf("初始化数据库搜索器失败: %v", err)
+		}
+
+		for _, query := range concurrentQueries {
+			region, err := Search(query.ip, dbSearcher)
+			if query.expected == "" && errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				t.Errorf("[%d] 搜索IP %s 失败: %v", searchType, query.ip, err)
+				continue
+			}
+			if region != query.expected {
+				t.Errorf("[%d] Search(%s) = %q, 期望 %q", searchType, query.ip, region, query.expected)
+			}
+		}
+		CloseDBSearcher(dbSearcher)
+	}
+}
+
+// TestSearchModesIPv6 测试IPv6数据库的查询结果
+func TestSearchModesIPv6(t *testing.T) {
+	path := writeTestDB(t, true, testRangesV6)
+
+	queries := map[string]string{
+		"2001:db8::1":    "文档\tnull\tnull\t",
+		"2400:3200::1":   "中国\t浙江\t杭州\t阿里云",
+		"2606:4700::abc": "美国\tnull\tnull\tCloudflare",
+		"2606:4701::":    "",
+	}
+
+	for _, searchType := range []SearchType{MEMORY, BTREE, MMAP} {
+		dbSearcher, err := InitDBSearcher(path, testDBKey, searchType)
+		if err != nil {
+			t.Fatalf("初始化数据库搜索器失败: %v", err)
+		}
+
+		for ip, expected := range queries {
+			region, err := Search(ip, dbSearcher)
+			if expected == "" && errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				t.Errorf("[%d] 搜索IP %s 失败: %v", searchType, ip, err)
+			} else if region != expected {
+				t.Errorf("[%d] Search(%s) = %q, 期望 %q", searchType, ip, region, expected)
+			}
+		}
+		CloseDBSearcher(dbSearcher)
+	}
+}
+
+// TestConcurrentSearch 使用多个goroutine并发查询同一个搜索器，配合 go test -race 运行
+func TestConcurrentSearch(t *testing.T) {
+	path := writeTestDB(t, false, testRanges)
+
+	for _, searchType := range []SearchType{MEMORY, BTREE, MMAP} {
+		t.Run(searchTypeToString(searchType), func(t *testing.T) {
+			dbSearcher, err := InitDBSearcher(path, testDBKey, searchType)
+			if err != nil {
+				t.Fatalf("初始化数据库搜索器失败: %v", err)
+			}
+			defer CloseDBSearcher(dbSearcher)
+
+			const goroutines = 32
+			const iterations = 200
+
+			var wg sync.WaitGroup
+			errs := make(chan error, goroutines)
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < iterations; i++ {
+						query := concurrentQueries[(g+i)%len(concurrentQueries)]
+						region, err := Search(query.ip, dbSearcher)
+						if query.expected == "" && errors.Is(err, ErrNotFound) {
+							continue
+						}
+						if err != nil {
+							errs <- fmt.Errorf("搜索IP %s 失败: %v", query.ip, err)
+							return
+						}
+						if region != query.expected {
+							errs <- fmt.Errorf("Search(%s) = %q, 期望 %q", query.ip, region, query.expected)
+							return
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestCloseDuringSearch 测试查询进行中关闭搜索器，查询只返回结果或 ErrClosed，
+// 内存映射模式下不会访问已释放的映射，需配合 -race 运行
+func TestCloseDuringSearch(t *testing.T) {
+	path := writeTestDB(t, false, testRanges)
+
+	for _, searchType := range []SearchType{MEMORY, BTREE, MMAP} {
+		dbSearcher, err := InitDBSearcher(path, testDBKey, searchType)
+		if err != nil {
+			t.Fatalf("初始化数据库搜索器失败: %v", err)
+		}
+		addrs := []netip.Addr{netip.MustParseAddr("1.0.2.3"), netip.MustParseAddr("223.5.5.5")}
+
+		var wg sync.WaitGroup
+		started := make(chan struct{})
+		errs := make(chan error, 8)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for n := 0; ; n++ {
+					if i == 0 && n == 100 {
+						close(started)
+					}
+					var err error
+					switch n % 3 {
+					case 0:
+						_, err = dbSearcher.SearchAddr(addrs[n%2])
+					case 1:
+						_, batchErrs := dbSearcher.SearchBatch(addrs)
+						err = batchErrs[0]
+					case 2:
+						err = dbSearcher.Records(func(Record) bool { return true })
+					}
+					if errors.Is(err, ErrClosed) {
+						return
+					}
+					if err != nil {
+						errs <- fmt.Errorf("[%d] 查询失败: %w", searchType, err)
+						return
+					}
+				}
+			}(i)
+		}
+
+		<-started
+		CloseDBSearcher(dbSearcher)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Error(err)
+		}
+	}
+}
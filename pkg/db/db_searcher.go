@@ -1,15 +1,16 @@
 package db
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/tagphi/czdb-search-golang/pkg/utils"
-	"github.com/vmihailenco/msgpack/v5"
 )
 
 const (
@@ -27,6 +28,8 @@ const (
 	MEMORY SearchType = iota
 	// BTREE 表示B树模式，按需从数据库文件读取数据
 	BTREE
+	// MMAP 表示内存映射模式，只读映射数据库文件，多个进程共享页缓存
+	MMAP
 )
 
 // SuperBlock 表示CZDB文件的超级块结构
@@ -48,8 +51,10 @@ type BtreeModeParam struct {
 // DBSearcher 是CZDB文件的搜索器，包含了搜索所需的所有状态
 type DBSearcher struct {
 	IPType          int32       // IP地址类型 (IPv4 或 IPv6)
-	SearchType      SearchType  // 搜索类型 (BTREE 或 MEMORY)
+	SearchType      SearchType  // 搜索类型 (BTREE、MEMORY 或 MMAP)
 	File            *os.File    // 数据库文件
+	ReaderAt        io.ReaderAt // 位置读取的数据源 (B树模式使用，并发安全)
+	FileSize        int64       // 数据源总大小
 	DBBin           []byte      // 数据库二进制数据 (内存模式使用)
 	DataSize        int32       // 数据大小
 	DBKey           string      // 数据库密钥
@@ -62,6 +67,7 @@ type DBSearcher struct {
 	IndexLength       int32      // 索引长度
 	ColumnSelection   int32      // 列选择
 	GeoMapData        []byte     // 地理映射数据
+	Schema            []string   // 列名称，按原始列索引排列，默认为 DefaultColumnSchema
 	
 	// 新增字段
 	HyperHeader       *HyperHeaderBlock // 超级头部
@@ -70,12 +76,27 @@ type DBSearcher struct {
 	BtreeModeParam    *BtreeModeParam   // B-tree模式参数
 	HeaderBlock       []byte            // 头部块数据
 	HeaderBlockSize   int32             // 头部块大小
+	
+	// 内存模式下的延迟加载，保证并发查询只加载一次
+	loadOnce sync.Once
+	loadErr  error
+	
+	// 内存映射模式下映射的完整文件
+	mmapData []byte
+	
+	closer       io.Closer    // 由搜索器打开、需在关闭时释放的数据源
+	geoMapOffset int64        // 加密地理映射在文件中的偏移量
+	closed       atomic.Bool  // 是否已经调用 CloseDBSearcher
+	inFlight     sync.RWMutex // 进行中的查询持有读锁，CloseDBSearcher 获取写锁等待其结束后才释放文件映射
+	selection    int32        // 查询默认使用的列选择，可由 Options.Columns 覆盖
+	geoColumns   int          // 地理映射中每条记录的列数
+	cache        *rangeCache  // 按区间缓存的查询结果，Options.CacheSize 为 0 时为 nil
 }
 
 // 解析SuperBlock
 func parseSuperBlock(data []byte) (*SuperBlock, error) {
 	if len(data) < SuperPartLength {
-		return nil, fmt.Errorf("SuperBlock data too short: %d bytes, expected at least %d bytes", len(data), SuperPartLength)
+		return nil, newCorruptError(SectionSuperBlock, 0, "SuperBlock data too short: %d bytes, expected at least %d bytes", len(data), SuperPartLength)
 	}
 	
 	// 按照白皮书格式解析
@@ -100,36 +121,25 @@ func parseSuperBlock(data []byte) (*SuperBlock, error) {
 }
 
 // 初始化B-tree模式参数
-func initBtreeModeParam(file *os.File, offset int64, superBlock *SuperBlock) (*BtreeModeParam, error) {
+func initBtreeModeParam(reader io.ReaderAt, fileSize int64, offset int64, superBlock *SuperBlock) (*BtreeModeParam, error) {
 	// 不再重复读取和解析SuperBlock，直接使用传入的superBlock参数
-	
-	// 获取文件大小
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get file info: %v", err)
-	}
-	realFileSize := fileInfo.Size() - offset
+	realFileSize := fileSize - offset
 	
 	// 检查文件大小是否匹配
 	if int64(superBlock.DbSize) != realFileSize {
 		utils.Warning("db file size mismatch, expected [%d], real [%d]\n", superBlock.DbSize, realFileSize)
 	}
 	
-	// 读取HeaderBlock
-	_, err = file.Seek(offset+SuperPartLength, io.SeekStart)
-	if err != nil {
-		return nil, fmt.Errorf("failed to seek to HeaderBlock position: %v", err)
-	}
-	
 	headerBlockSize := superBlock.HeaderBlockSize
 	if headerBlockSize <= 0 {
-		return nil, fmt.Errorf("invalid HeaderBlockSize: %d", headerBlockSize)
+		return nil, newCorruptError(SectionSuperBlock, offset, "invalid HeaderBlockSize: %d", headerBlockSize)
 	}
 	
+	// 读取HeaderBlock
 	b := make([]byte, headerBlockSize)
-	bytesRead, err := file.Read(b)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read HeaderBlock: %v", err)
+	bytesRead, err := reader.ReadAt(b, offset+SuperPartLength)
+	if err != nil && !(err == io.EOF && bytesRead > 0) {
+		return nil, newCorruptError(SectionHeaderBlock, offset+SuperPartLength, "failed to read HeaderBlock: %v", err)
 	}
 	if bytesRead < int(headerBlockSize) {
 		utils.Warning("incomplete HeaderBlock read: %d of %d bytes\n", bytesRead, headerBlockSize)
@@ -172,30 +182,21 @@ func initBtreeModeParam(file *os.File, offset int64, superBlock *SuperBlock) (*B
 
 // 加载地理数据映射
 func loadGeoMapping(dbSearcher *DBSearcher, offset int64) error {
-	file := dbSearcher.File
+	reader := dbSearcher.ReaderAt
 	endIndexPtr := dbSearcher.EndIndexPtr
 	
 	// 检查 endIndexPtr 是否有效
 	if endIndexPtr <= 0 {
-		return fmt.Errorf("invalid end index pointer: %d", endIndexPtr)
+		return newCorruptError(SectionSuperBlock, offset, "invalid end index pointer: %d", endIndexPtr)
 	}
 	
 	// 计算 ColumnSelection 的位置
 	columnSelectionPtr := offset + int64(endIndexPtr) + int64(dbSearcher.IPBytesLength*2+5)
 	
 	// 读取 ColumnSelection
-	_, err := file.Seek(columnSelectionPtr, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("failed to seek to column selection position: %v", err)
-	}
-	
 	columnSelectionBytes := make([]byte, 4)
-	bytesRead, err := file.Read(columnSelectionBytes)
-	if err != nil {
-		return fmt.Errorf("failed to read column selection: %v", err)
-	}
-	if bytesRead < 4 {
-		return fmt.Errorf("incomplete column selection read: %d of 4 bytes", bytesRead)
+	if _, err := reader.ReadAt(columnSelectionBytes, columnSelectionPtr); err != nil {
+		return newCorruptError(SectionGeoMap, columnSelectionPtr, "failed to read column selection: %v", err)
 	}
 	
 	// 设置 ColumnSelection
@@ -214,26 +215,17 @@ func loadGeoMapping(dbSearcher *DBSearcher, offset int64) error {
 	geoDataStart := columnSelectionPtr + 4
 	utils.Debug("Debug: Geo data start position: %d\n", geoDataStart)
 	
-	// 跳转到地理数据起始位置
-	_, err = file.Seek(geoDataStart, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("failed to seek to geo data position: %v", err)
-	}
-	
 	// 读取地理数据大小
 	geoSizeBytes := make([]byte, 4)
-	bytesRead, err = file.Read(geoSizeBytes)
-	if err != nil {
-		return fmt.Errorf("failed to read geo size: %v", err)
-	}
-	if bytesRead < 4 {
-		return fmt.Errorf("incomplete geo size read: %d of 4 bytes", bytesRead)
+	if _, err := reader.ReadAt(geoSizeBytes, geoDataStart); err != nil {
+		return newCorruptError(SectionGeoMap, geoDataStart, "failed to read geo size: %v", err)
 	}
 	
 	geoSize := utils.GetIntLong(geoSizeBytes, 0)
 	utils.Debug("Debug: Geo map size: %d bytes\n", geoSize)
 	
 	// 检查地理数据大小
+	dbSearcher.geoMapOffset = geoDataStart + 4
 	if geoSize <= 0 {
 		utils.Warning("No geo data available\n")
 		dbSearcher.GeoMapData = make([]byte, 0)
@@ -248,9 +240,9 @@ func loadGeoMapping(dbSearcher *DBSearcher, offset int64) error {
 	
 	// 读取加密的地理数据
 	encryptedGeoBytes := make([]byte, geoSize)
-	bytesRead, err = file.Read(encryptedGeoBytes)
-	if err != nil {
-		return fmt.Errorf("failed to read geo data: %v", err)
+	bytesRead, err := reader.ReadAt(encryptedGeoBytes, geoDataStart+4)
+	if err != nil && !(err == io.EOF && bytesRead > 0) {
+		return newCorruptError(SectionGeoMap, geoDataStart+4, "failed to read geo data: %v", err)
 	}
 	if bytesRead < int(geoSize) {
 		utils.Warning("Read %d of %d bytes for geo data\n", bytesRead, geoSize)
@@ -263,7 +255,7 @@ func loadGeoMapping(dbSearcher *DBSearcher, offset int64) error {
 	// 使用工具函数进行解密
 	decryptedGeoBytes := utils.DecryptWithBase64Key(encryptedGeoBytes, dbSearcher.DBKey)
 	if decryptedGeoBytes == nil {
-		return fmt.Errorf("failed to decrypt geo data")
+		return fmt.Errorf("%w: failed to decrypt geo data", ErrWrongKey)
 	}
 	
 	utils.Debug("Debug: Loaded and decrypted %d bytes of geo data\n", len(decryptedGeoBytes))
@@ -278,70 +270,58 @@ func loadGeoMapping(dbSearcher *DBSearcher, offset int64) error {
 // 参数:
 //   - dbPath: 数据库文件路径
 //   - key: 数据库解密密钥
-//   - searchType: 搜索类型 (MEMORY 或 BTREE)
+//   - searchType: 搜索类型 (MEMORY、BTREE 或 MMAP)
 //
 // 返回:
 //   - *DBSearcher: 初始化后的数据库搜索器
 //   - error: 如果初始化失败则返回错误
 func InitDBSearcher(dbPath string, key string, searchType SearchType) (*DBSearcher, error) {
-	// 打开数据库文件
-	file, err := os.Open(dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database file: %v", err)
-	}
-	
-	// 获取文件大小
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get file info: %v", err)
+	return OpenFile(dbPath, key, &Options{SearchType: searchType})
+}
+
+// newDBSearcher 从支持位置读取的数据源解析数据库并创建搜索器，出错时由调用方关闭数据源
+func newDBSearcher(reader io.ReaderAt, size int64, key string, opts *Options) (*DBSearcher, error) {
+	if opts == nil {
+		opts = &Options{}
 	}
-	fileSize := fileInfo.Size()
-	utils.Debug("Database file size: %d bytes\n", fileSize)
 	
 	// 创建数据库搜索器
 	dbSearcher := &DBSearcher{
-		File:       file,
-		SearchType: searchType,
+		ReaderAt:   reader,
+		FileSize:   size,
+		SearchType: opts.SearchType,
 		DBKey:      key,
 	}
 	
 	// 解密HyperHeaderBlock
-	hyperHeader, err := DecryptHyperHeaderBlock(file, key)
+	hyperHeader, err := DecryptHyperHeaderBlock(io.NewSectionReader(reader, 0, size), key)
 	if err != nil {
-		file.Close()
 		return nil, err
 	}
 	
 	dbSearcher.HyperHeader = hyperHeader
 	dbSearcher.DecryptedBlock = hyperHeader.DecryptedBlock
+	if err := checkRandomSize(hyperHeader, size); err != nil {
+		return nil, err
+	}
+	if err := checkExpiry(dbSearcher, opts.ExpiryPolicy); err != nil {
+		return nil, err
+	}
 	
 	// 计算文件偏移量，包括随机填充数据的大小
 	offset := int64(GetHyperHeaderBlockSize(hyperHeader)) + int64(hyperHeader.DecryptedBlock.RandomSize)
 	dbSearcher.FileOffset = offset
 	
-	// 跳过随机数据
-	_, err = file.Seek(offset, io.SeekStart)
-	if err != nil {
-		file.Close()
-		return nil, fmt.Errorf("failed to seek past random data: %v", err)
-	}
-	
-	// 读取SuperBlock
+	// 跳过随机数据，读取SuperBlock
 	superBytes := make([]byte, SuperPartLength)
-	bytesRead, err := file.Read(superBytes)
-	if err != nil {
-		file.Close()
-		return nil, fmt.Errorf("failed to read SuperBlock: %v", err)
-	}
+	bytesRead, err := reader.ReadAt(superBytes, offset)
 	if bytesRead < SuperPartLength {
-		file.Close()
-		return nil, fmt.Errorf("incomplete SuperBlock read: %d of %d bytes", bytesRead, SuperPartLength)
+		return nil, newCorruptError(SectionSuperBlock, offset, "failed to read SuperBlock: %v", err)
 	}
 	
 	// 解析SuperBlock
 	superBlock, err := parseSuperBlock(superBytes)
 	if err != nil {
-		file.Close()
 		return nil, err
 	}
 	
@@ -367,10 +347,9 @@ func InitDBSearcher(dbPath string, key string, searchType SearchType) (*DBSearch
 	utils.Debug("Debug: StartIndexPtr: %d, EndIndexPtr: %d\n", dbSearcher.StartIndexPtr, dbSearcher.EndIndexPtr)
 	
 	// 初始化B-tree模式参数，传递已解析的SuperBlock
-	btreeModeParam, err := initBtreeModeParam(file, offset, superBlock)
+	btreeModeParam, err := initBtreeModeParam(reader, size, offset, superBlock)
 	if err != nil {
-		file.Close()
-		return nil, fmt.Errorf("failed to initialize btree mode parameters: %v", err)
+		return nil, fmt.Errorf("failed to initialize btree mode parameters: %w", err)
 	}
 	
 	dbSearcher.BtreeModeParam = btreeModeParam
@@ -378,8 +357,38 @@ func InitDBSearcher(dbPath string, key string, searchType SearchType) (*DBSearch
 	// 加载地理数据映射
 	err = loadGeoMapping(dbSearcher, offset)
 	if err != nil {
-		file.Close()
-		return nil, fmt.Errorf("failed to load geo mapping: %v", err)
+		return nil, fmt.Errorf("failed to load geo mapping: %w", err)
+	}
+	
+	// 列名称及列选择
+	dbSearcher.Schema = DefaultColumnSchema
+	if opts.Schema != nil {
+		dbSearcher.Schema = opts.Schema
+	}
+	dbSearcher.geoColumns = geoMapColumns(dbSearcher.GeoMapData)
+	dbSearcher.selection = dbSearcher.ColumnSelection
+	if opts.Columns != nil {
+		if dbSearcher.selection, err = dbSearcher.SelectColumns(opts.Columns...); err != nil {
+			return nil, err
+		}
+	}
+	
+	if opts.CacheSize > 0 {
+		dbSearcher.cache = newRangeCache(opts.CacheSize)
+	}
+	
+	// 内存映射模式下直接在映射上查找，跳过 HyperHeader 及随机数据
+	if dbSearcher.SearchType == MMAP {
+		file, ok := reader.(*os.File)
+		if !ok {
+			return nil, fmt.Errorf("mmap search type requires a database file, got %T", reader)
+		}
+		mmapData, err := mmapFile(file, size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mmap database file: %v", err)
+		}
+		dbSearcher.mmapData = mmapData
+		dbSearcher.DBBin = mmapData[offset:]
 	}
 	
 	return dbSearcher, nil
@@ -393,20 +402,53 @@ func InitDBSearcher(dbPath string, key string, searchType SearchType) (*DBSearch
 //
 // 返回:
 //   - string: 地理位置信息
-//   - error: 如果搜索失败则返回错误
+//   - error: 如果搜索失败则返回错误，未找到时返回 ErrNotFound
 func Search(ip string, dbSearcher *DBSearcher) (string, error) {
 	if dbSearcher == nil {
 		return "", fmt.Errorf("dbSearcher is nil")
 	}
 	
 	// 根据搜索类型调用对应的搜索方法
-	if dbSearcher.SearchType == MEMORY {
-		return TreeSearch(dbSearcher, ip, true)
-	} else if dbSearcher.SearchType == BTREE {
-		return TreeSearch(dbSearcher, ip, false)
+	memoryMode, err := dbSearcher.memoryMode()
+	if err != nil {
+		return "", err
+	}
+	return TreeSearch(dbSearcher, ip, memoryMode)
+}
+
+// SearchResult 搜索IP地址对应的结构化地理位置信息
+//
+// 参数:
+//   - ip: 要查询的IP地址字符串
+//
+// 返回:
+//   - *GeoResult: 地理位置信息
+//   - error: 如果搜索失败则返回错误，未找到时返回 ErrNotFound
+func (dbSearcher *DBSearcher) SearchResult(ip string) (*GeoResult, error) {
+	if dbSearcher == nil {
+		return nil, fmt.Errorf("dbSearcher is nil")
 	}
 	
-	return "", fmt.Errorf("unsupported search type")
+	// 根据搜索类型调用对应的搜索方法
+	memoryMode, err := dbSearcher.memoryMode()
+	if err != nil {
+		return nil, err
+	}
+	return treeSearchResult(dbSearcher, ip, memoryMode)
+}
+
+// memoryMode 返回当前搜索类型是否直接在 DBBin 上查找
+//
+// MEMORY 与 MMAP 模式下 DBBin 分别指向内存副本和文件映射，BTREE 模式按需读取文件
+func (dbSearcher *DBSearcher) memoryMode() (bool, error) {
+	switch dbSearcher.SearchType {
+	case MEMORY, MMAP:
+		return true, nil
+	case BTREE:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unsupported search type")
+	}
 }
 
 // TreeSearch 执行树搜索算法查找IP地址
@@ -418,29 +460,67 @@ func Search(ip string, dbSearcher *DBSearcher) (string, error) {
 //
 // 返回:
 //   - string: 地理位置信息
-//   - error: 如果搜索失败则返回错误
+//   - error: 如果搜索失败则返回错误，未找到时返回 ErrNotFound
 func TreeSearch(dbSearcher *DBSearcher, ip string, memoryMode bool) (string, error) {
-	// 验证IP地址格式
-	if err := validateIPFormat(ip, dbSearcher.IPType); err != nil {
+	result, err := treeSearchResult(dbSearcher, ip, memoryMode)
+	if err != nil {
 		return "", err
 	}
+	return result.String(), nil
+}
+
+// treeSearchResult 执行树搜索，未找到时返回 ErrNotFound
+func treeSearchResult(dbSearcher *DBSearcher, ip string, memoryMode bool) (*GeoResult, error) {
+	// 解析IP地址，只解析一次
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIP, ip)
+	}
 	
-	// 准备IP字节
-	ipBytes, err := utils.GetIPBytes(ip, int(dbSearcher.IPType))
+	// 准备IP字节，并检查是否符合数据库类型
+	ipBytes, err := dbSearcher.normalizeIPBytes(parsedIP)
 	if err != nil {
-		return "", fmt.Errorf("invalid IP address: %s, error: %v", ip, err)
+		return nil, err
 	}
 	
-	// 如果是内存模式，且DBBin为空，则加载数据库到内存
-	if memoryMode && (dbSearcher.DBBin == nil || len(dbSearcher.DBBin) == 0) {
-		err = loadDBIntoMemory(dbSearcher)
-		if err != nil {
-			return "", fmt.Errorf("failed to load database into memory: %v", err)
+	return searchIPBytes(dbSearcher, ipBytes, memoryMode)
+}
+
+// searchIPBytes 按IP字节执行树搜索，未找到时返回 ErrNotFound
+//
+// 查询过程只读取 DBSearcher 的状态，B树模式下使用 ReadAt 位置读取，
+// 因此同一个 DBSearcher 可以被任意多个goroutine并发使用
+func searchIPBytes(dbSearcher *DBSearcher, ipBytes []byte, memoryMode bool) (*GeoResult, error) {
+	_, result, err := searchRecordCached(dbSearcher, ipBytes, memoryMode)
+	return result, err
+}
+
+// indexRecord 表示一个索引块：区间的起止IP及数据记录的位置
+type indexRecord struct {
+	StartIP []byte // 区间起始IP
+	EndIP   []byte // 区间结束IP
+	DataPtr uint32 // 数据记录指针 (相对于 FileOffset)
+	DataLen uint8  // 数据记录长度
+}
+
+// searchIndexRecord 在头部块和索引块中查找包含该IP的索引块，未找到时返回 ErrNotFound
+func searchIndexRecord(dbSearcher *DBSearcher, ipBytes []byte, memoryMode bool) (*indexRecord, error) {
+	if dbSearcher.closed.Load() {
+		return nil, ErrClosed
+	}
+	
+	// 如果是内存模式，确保数据库已加载到内存
+	if memoryMode {
+		if err := dbSearcher.ensureDBBin(); err != nil {
+			return nil, fmt.Errorf("failed to load database into memory: %w", err)
 		}
 	}
 	
 	// 初始化B-tree搜索
 	param := dbSearcher.BtreeModeParam
+	if param.HeaderLength == 0 {
+		return nil, ErrNotFound
+	}
 	l, h := 0, param.HeaderLength-1
 	sptr, eptr := int32(0), int32(0)
 	
@@ -467,7 +547,9 @@ func TreeSearch(dbSearcher *DBSearcher, ip string, memoryMode bool) (string, err
 	
 	// 如果没有精确匹配，确定包含该IP的区间
 	if l > h {
-		if l < param.HeaderLength {
+		if l == 0 { // IP小于第一个头部行，不在数据库范围内
+			return nil, ErrNotFound
+		} else if l < param.HeaderLength {
 			sptr = param.HeaderPtr[l-1]
 			eptr = param.HeaderPtr[l]
 		} else if h >= 0 && h+1 < param.HeaderLength {
@@ -475,49 +557,39 @@ func TreeSearch(dbSearcher *DBSearcher, ip string, memoryMode bool) (string, err
 			eptr = param.HeaderPtr[h+1]
 		} else { // 搜索到最后一个头部行，可能在最后一个索引块
 			sptr = param.HeaderPtr[param.HeaderLength-1]
-			blockLen := int32(dbSearcher.IPBytesLength*2 + 5) // 索引块长度
-			eptr = sptr + blockLen
+			eptr = sptr + dbSearcher.IndexLength
 		}
 	}
 	
 	if sptr == 0 {
-		return "IP not found", nil
+		return nil, ErrNotFound
 	}
 	
-	// 准备索引缓冲区
+	// 准备索引缓冲区，与Java实现一致多读一个索引块，使区间末尾的索引块也参与查找
 	blockLen := eptr - sptr
 	blen := dbSearcher.IndexLength
+	readLen := blockLen + blen
+	if limit := dbSearcher.EndIndexPtr + blen - sptr; readLen > limit {
+		readLen = limit
+	}
 	
-	var indexBuffer []byte
-	
-	// 根据模式选择从内存或文件读取索引数据
-	if memoryMode {
-		// 从内存中读取
-		if int(sptr) >= len(dbSearcher.DBBin) {
-			return "", fmt.Errorf("index pointer out of bounds: %d", sptr)
-		}
-		indexBuffer = dbSearcher.DBBin[sptr:sptr+blockLen]
-	} else {
-		// 从文件读取索引
-		_, err = dbSearcher.File.Seek(int64(sptr)+dbSearcher.FileOffset, io.SeekStart)
-		if err != nil {
-			return "", fmt.Errorf("failed to seek to index position: %v", err)
-		}
-		
-		indexBuffer = make([]byte, blockLen)
-		bytesRead, err := dbSearcher.File.Read(indexBuffer)
-		if err != nil {
-			return "", fmt.Errorf("failed to read index buffer: %v", err)
-		}
-		if bytesRead < int(blockLen) {
-			return "", fmt.Errorf("incomplete index buffer read: %d of %d bytes", bytesRead, blockLen)
-		}
+	indexBuffer, err := dbSearcher.readDBBytes(int64(sptr), int(readLen), memoryMode)
+	if err != nil {
+		return nil, newCorruptError(SectionIndex, dbSearcher.FileOffset+int64(sptr), "failed to read index buffer: %v", err)
 	}
 	
+	return searchIndexPage(dbSearcher, indexBuffer, int(blockLen/blen), ipBytes, sptr)
+}
+
+// searchIndexPage 在从 sptr 开始读取的索引缓冲区中二分查找包含该IP的索引块，
+// last 是参与查找的最后一个索引块的序号，未找到时返回 ErrNotFound
+func searchIndexPage(dbSearcher *DBSearcher, indexBuffer []byte, last int, ipBytes []byte, sptr int32) (*indexRecord, error) {
 	// 二分查找索引块
-	l, h = 0, int(blockLen/blen)
+	l, h := 0, last
+	blen := dbSearcher.IndexLength
 	var dataPtr uint32
 	var dataLen uint8
+	var startIP, endIP []byte
 	found := false
 	
 	for l <= h {
@@ -529,8 +601,8 @@ func TreeSearch(dbSearcher *DBSearcher, ip string, memoryMode bool) (string, err
 		}
 		
 		// 读取起始IP和结束IP
-		startIP := indexBuffer[offset:offset+dbSearcher.IPBytesLength]
-		endIP := indexBuffer[offset+dbSearcher.IPBytesLength:offset+dbSearcher.IPBytesLength*2]
+		startIP = indexBuffer[offset:offset+dbSearcher.IPBytesLength]
+		endIP = indexBuffer[offset+dbSearcher.IPBytesLength:offset+dbSearcher.IPBytesLength*2]
 		
 		// 使用统一的比较方法，无论是IPv4还是IPv6
 		cmpStart := utils.CompareBytes(ipBytes, startIP, dbSearcher.IPBytesLength)
@@ -564,43 +636,89 @@ func TreeSearch(dbSearcher *DBSearcher, ip string, memoryMode bool) (string, err
 	}
 	
 	if !found {
-		return "IP not found", nil
+		return nil, ErrNotFound
 	}
 	
 	// 检查数据指针和长度
 	if dataPtr == 0 || dataLen == 0 {
-		return "", fmt.Errorf("invalid data pointer or length: ptr=%d, len=%d", dataPtr, dataLen)
+		return nil, newCorruptError(SectionIndex, dbSearcher.FileOffset+int64(sptr), "invalid data pointer or length: ptr=%d, len=%d", dataPtr, dataLen)
 	}
 	
+	return &indexRecord{
+		StartIP: append([]byte(nil), startIP...),
+		EndIP:   append([]byte(nil), endIP...),
+		DataPtr: dataPtr,
+		DataLen: dataLen,
+	}, nil
+}
+
+// decodeIndexRecord 读取并解码索引块指向的数据记录
+func decodeIndexRecord(dbSearcher *DBSearcher, record *indexRecord, memoryMode bool) (*GeoResult, error) {
+	return decodeIndexRecordColumns(dbSearcher, record, memoryMode, dbSearcher.selection)
+}
+
+// decodeIndexRecordColumns 读取并解码索引块指向的数据记录，只取出 selection 选中的列
+func decodeIndexRecordColumns(dbSearcher *DBSearcher, record *indexRecord, memoryMode bool, selection int32) (*GeoResult, error) {
+	dataPtr, dataLen := record.DataPtr, record.DataLen
+	
 	// 读取数据
-	data := make([]byte, dataLen)
+	data, err := dbSearcher.readDBBytes(int64(dataPtr), int(dataLen), memoryMode)
+	if err != nil {
+		return nil, newCorruptError(SectionData, dbSearcher.FileOffset+int64(dataPtr), "failed to read data: %v", err)
+	}
 	
-	// 根据模式选择从内存或文件读取数据
-	if memoryMode {
-		// 从内存中读取数据
-		if int(dataPtr) >= len(dbSearcher.DBBin) {
-			return "", fmt.Errorf("data pointer out of bounds: %d", dataPtr)
-		}
-		copy(data, dbSearcher.DBBin[dataPtr:dataPtr+uint32(dataLen)])
-	} else {
-		// 从文件读取数据
-		_, err = dbSearcher.File.Seek(int64(dataPtr)+dbSearcher.FileOffset, io.SeekStart)
-		if err != nil {
-			return "", fmt.Errorf("failed to seek to data position: %v", err)
+	// 获取地理信息
+	result, err := DecodeGeoResult(dbSearcher.GeoMapData, selection, data)
+	if err != nil {
+		return nil, dbSearcher.locateCorruptError(err, int64(dataPtr))
+	}
+	result.Schema = dbSearcher.Schema
+	
+	return result, nil
+}
+
+// locateCorruptError 将 DecodeGeoResult 返回的相对偏移转换为文件偏移
+func (dbSearcher *DBSearcher) locateCorruptError(err error, dataPtr int64) error {
+	var corrupt *CorruptDatabaseError
+	if errors.As(err, &corrupt) {
+		located := *corrupt
+		switch located.Section {
+		case SectionData:
+			located.Offset += dbSearcher.FileOffset + dataPtr
+		case SectionGeoMap:
+			located.Offset += dbSearcher.geoMapOffset
 		}
-		_, err = dbSearcher.File.Read(data)
-		if err != nil {
-			return "", fmt.Errorf("failed to read data: %v", err)
+		return &located
+	}
+	return err
+}
+
+// readDBBytes 读取数据区 [ptr, ptr+length) 的字节 (ptr 相对于 FileOffset)
+//
+// 内存模式下直接返回 DBBin 的切片，调用方不得修改；B树模式下使用 ReadAt
+// 位置读取，不依赖也不改变共享文件句柄的读写位置
+func (dbSearcher *DBSearcher) readDBBytes(ptr int64, length int, memoryMode bool) ([]byte, error) {
+	if ptr < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid read range: ptr=%d, len=%d", ptr, length)
+	}
+	
+	if memoryMode {
+		if ptr+int64(length) > int64(len(dbSearcher.DBBin)) {
+			return nil, fmt.Errorf("pointer out of bounds: %d+%d > %d", ptr, length, len(dbSearcher.DBBin))
 		}
+		return dbSearcher.DBBin[ptr : ptr+int64(length)], nil
 	}
 	
-	// 获取地理信息
-	geoData, err := GetActualGeo(dbSearcher.GeoMapData, dbSearcher.ColumnSelection, data)
-	if err != nil {
-		return "", fmt.Errorf("failed to get geo data: %v", err)
+	if dbSearcher.ReaderAt == nil {
+		return nil, fmt.Errorf("no reader available")
 	}
 	
-	return geoData, nil
+	buf := make([]byte, length)
+	bytesRead, err := dbSearcher.ReaderAt.ReadAt(buf, dbSearcher.FileOffset+ptr)
+	if bytesRead < length {
+		return nil, fmt.Errorf("incomplete read at %d: %d of %d bytes: %v", ptr, bytesRead, length, err)
+	}
+	return buf, nil
 }
 
 // MemorySearch 在内存模式下搜索IP地址
@@ -631,37 +749,38 @@ func BTreeSearch(dbSearcher *DBSearcher, ip string) (string, error) {
 	return TreeSearch(dbSearcher, ip, false)
 }
 
+// ensureDBBin 确保数据库已加载到内存，并发调用时只加载一次
+func (dbSearcher *DBSearcher) ensureDBBin() error {
+	dbSearcher.loadOnce.Do(func() {
+		if len(dbSearcher.DBBin) == 0 {
+			dbSearcher.loadErr = loadDBIntoMemory(dbSearcher)
+		}
+	})
+	return dbSearcher.loadErr
+}
+
 // 将数据库文件加载到内存
 func loadDBIntoMemory(dbSearcher *DBSearcher) error {
-	// 获取文件大小
-	fileInfo, err := dbSearcher.File.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to get file info: %v", err)
+	if dbSearcher.ReaderAt == nil {
+		return fmt.Errorf("no reader available")
 	}
-	fileSize := fileInfo.Size()
+	size := dbSearcher.FileSize - dbSearcher.FileOffset
 	
-	utils.Debug("Loading database into memory (size: %d bytes)...\n", fileSize - dbSearcher.FileOffset)
+	utils.Debug("Loading database into memory (size: %d bytes)...\n", size)
 	
 	// 从文件偏移位置开始读取数据
-	_, err = dbSearcher.File.Seek(dbSearcher.FileOffset, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("failed to seek to file offset: %v", err)
-	}
-	
-	// 分配内存
-	dbSearcher.DBBin = make([]byte, fileSize - dbSearcher.FileOffset)
-	
-	// 读取数据
-	bytesRead, err := dbSearcher.File.Read(dbSearcher.DBBin)
+	dbBin := make([]byte, size)
+	bytesRead, err := dbSearcher.ReaderAt.ReadAt(dbBin, dbSearcher.FileOffset)
 	if err != nil && err != io.EOF {
 		return fmt.Errorf("failed to read file into memory: %v", err)
 	}
 	
-	if int64(bytesRead) < fileSize - dbSearcher.FileOffset {
-		utils.Warning("Read %d of %d bytes into memory\n", bytesRead, fileSize - dbSearcher.FileOffset)
-		dbSearcher.DBBin = dbSearcher.DBBin[:bytesRead]
+	if int64(bytesRead) < size {
+		utils.Warning("Read %d of %d bytes into memory\n", bytesRead, size)
+		dbBin = dbBin[:bytesRead]
 	}
 	
+	dbSearcher.DBBin = dbBin
 	utils.Debug("Database loaded into memory successfully (%d bytes)\n", bytesRead)
 	return nil
 }
@@ -677,7 +796,26 @@ func cleanString(s string) string {
 	return result.String()
 }
 
-// CloseDBSearcher 关闭数据库搜索器并释放相关资源
+// acquire 开始一次查询，搜索器已关闭时返回 ErrClosed，成功时调用方必须在查询结束后调用 release
+//
+// 同一次查询中不得重复调用，否则在 CloseDBSearcher 等待时会死锁。
+func (dbSearcher *DBSearcher) acquire() error {
+	dbSearcher.inFlight.RLock()
+	if dbSearcher.closed.Load() {
+		dbSearcher.inFlight.RUnlock()
+		return ErrClosed
+	}
+	return nil
+}
+
+// release 结束一次查询
+func (dbSearcher *DBSearcher) release() {
+	dbSearcher.inFlight.RUnlock()
+}
+
+// CloseDBSearcher 关闭数据库搜索器并释放相关资源，之后的查询返回 ErrClosed
+//
+// 关闭时等待进行中的查询结束后再释放文件映射和文件句柄，因此可以与查询并发调用。
 //
 // 参数:
 //   - dbSearcher: 要关闭的数据库搜索器实例
@@ -685,9 +823,25 @@ func CloseDBSearcher(dbSearcher *DBSearcher) {
 	if dbSearcher == nil {
 		return
 	}
+	dbSearcher.closed.Store(true)
+	dbSearcher.inFlight.Lock()
+	defer dbSearcher.inFlight.Unlock()
+	if dbSearcher.cache != nil {
+		dbSearcher.cache.close()
+	}
+	if dbSearcher.mmapData != nil {
+		if err := munmapFile(dbSearcher.mmapData); err != nil {
+			utils.Warning("failed to unmap database file: %v\n", err)
+		}
+		dbSearcher.mmapData = nil
+		dbSearcher.DBBin = nil
+	}
 	if dbSearcher.File != nil {
 		dbSearcher.File.Close()
 	}
+	if dbSearcher.closer != nil {
+		dbSearcher.closer.Close()
+	}
 }
 
 // Info 打印数据库信息到标准输出
@@ -704,6 +858,9 @@ func Info(dbSearcher *DBSearcher) {
 	utils.Debug("Search Type: %s\n", searchTypeToString(dbSearcher.SearchType))
 	utils.Debug("BTree Header Length: %d\n", dbSearcher.BtreeModeParam.HeaderLength)
 	utils.Debug("Geo Map Data Size: %d bytes\n", len(dbSearcher.GeoMapData))
+	if expiresAt := dbSearcher.ExpiresAt(); !expiresAt.IsZero() {
+		utils.Debug("Expiration Date: %s (%d days left)\n", expiresAt.AddDate(0, 0, -1).Format("2006-01-02"), dbSearcher.DaysUntilExpiry())
+	}
 }
 
 // searchTypeToString 将搜索类型转换为字符串
@@ -712,7 +869,9 @@ func searchTypeToString(searchType SearchType) string {
 	case MEMORY:
 		return "Memory"
 	case BTREE:
-		return "B-tree"
+		return "BTree"
+	case MMAP:
+		return "MMap"
 	default:
 		return "Unknown"
 	}
@@ -720,107 +879,17 @@ func searchTypeToString(searchType SearchType) string {
 
 // 获取地理信息
 func GetActualGeo(geoMapData []byte, columnSelection int32, data []byte) (string, error) {
-	// 使用msgpack直接解码，类似Java实现
-	dec := msgpack.NewDecoder(bytes.NewReader(data))
-	
-	// 解包第一个值：geoPosMixSize (uint64)
-	geoPosMixSize, err := dec.DecodeUint64()
-	if err != nil {
-		return "", fmt.Errorf("failed to decode geoPosMixSize: %v", err)
-	}
-	
-	// 解包第二个值：otherData (string)
-	otherData, err := dec.DecodeString()
-	if err != nil {
-		return "", fmt.Errorf("failed to decode otherData: %v", err)
-	}
-	
-	// 如果geoPosMixSize为0，直接返回otherData
-	if geoPosMixSize == 0 {
-		return otherData, nil
-	}
-	
-	// 提取地理指针和长度（来自 msgpack 记录，非索引中的 DB 偏移）
-	geoLen := int((geoPosMixSize >> 24) & 0xFF)
-	geoPtr := int(geoPosMixSize & 0x00FFFFFF)
-	
-	// 检查索引是否有效
-	if geoPtr < 0 || geoPtr+geoLen > len(geoMapData) {
-		return otherData, nil // 索引无效时返回otherData
+	result, err := DecodeGeoResult(geoMapData, columnSelection, data)
+	if result == nil {
+		return "", err
 	}
-	
-	// 从geoMapData中读取地理数据
-	regionData := geoMapData[geoPtr : geoPtr+geoLen]
-	
-	// 使用新的解码器解包地理数据
-	geoDec := msgpack.NewDecoder(bytes.NewReader(regionData))
-	
-	// 读取数组头，获取列数
-	columnNumber, err := geoDec.DecodeArrayLen()
 	if err != nil {
-		return otherData, fmt.Errorf("failed to decode column array: %v", err)
-	}
-	
-	// 构建结果
-	var sb strings.Builder
-	
-	// 遍历所有列
-	for i := 0; i < columnNumber; i++ {
-		// 检查列是否被选中
-		columnSelected := (columnSelection >> (i + 1) & 1) == 1
-		
-		// 解码列值（字符串）
-		value, err := geoDec.DecodeString()
-		if err != nil {
-			return otherData, fmt.Errorf("failed to decode column %d: %v", i, err)
-		}
-		
-		// 处理空值
-		if value == "" {
-			value = "null"
-		}
-		
-		// 如果列被选中，添加到结果中
-		if columnSelected {
-			sb.WriteString(value)
-			sb.WriteString("\t")
-		}
+		return result.OtherData, err
 	}
-	
-	// 将地理数据和其他数据合并
-	return sb.String() + otherData, nil
+	return result.String(), nil
 }
 
 // 解包MessagePack数据
 func Unpack(geoMapData []byte, columnSelection int32, data []byte) (string, error) {
 	return GetActualGeo(geoMapData, columnSelection, data)
 }
-
-// validateIPFormat 验证IP地址格式是否符合指定类型
-// 参数:
-//   - ip: IP地址字符串
-//   - ipType: IP地址类型 (IPv4=4 或 IPv6=6)
-//
-// 返回:
-//   - error: 如果格式不符合则返回错误，否则返回nil
-func validateIPFormat(ip string, ipType int32) error {
-	parsedIP := net.ParseIP(ip)
-	if parsedIP == nil {
-		return fmt.Errorf("invalid IP address format: %s", ip)
-	}
-
-	if ipType == int32(utils.IPV4) {
-		if parsedIP.To4() == nil {
-			return fmt.Errorf("expected IPv4 address but got IPv6: %s", ip)
-		}
-	} else if ipType == int32(utils.IPV6) {
-		// For IPv6, To4() will return nil if it's a true IPv6 address
-		if parsedIP.To4() != nil {
-			return fmt.Errorf("expected IPv6 address but got IPv4: %s", ip)
-		}
-	} else {
-		return fmt.Errorf("unsupported IP type: %d", ipType)
-	}
-
-	return nil
-} 
\ No newline at end of file
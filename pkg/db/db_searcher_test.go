@@ -3,6 +3,8 @@ package db
 import (
 	"os"
 	"testing"
+
+	"github.com/tagphi/czdb-search-golang/pkg/utils"
 )
 
 // TestIPToUint32 测试IP地址到uint32的转换
@@ -68,7 +70,7 @@ func TestCompareBytes(t *testing.T) {
 		{[]byte{1, 2, 4}, []byte{1, 2, 3}, 3, 1},
 		{[]byte{1, 2, 3, 4}, []byte{1, 2, 3}, 3, 0},
 		{[]byte{1, 2}, []byte{1, 2, 3}, 2, 0},
-		{[]byte{1, 2, 3}, []byte{1, 2}, 3, 1}, // a更长
+		{[]byte{1, 2, 3}, []byte{1, 2}, 3, 0}, // 只比较共同前缀，长度由调用方保证
 	}
 
 	for _, test := range tests {
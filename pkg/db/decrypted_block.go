@@ -34,7 +34,7 @@ func AESECBDecrypt(encryptedData []byte, key []byte) ([]byte, error) {
 	}
 	
 	if len(encryptedData)%aes.BlockSize != 0 {
-		return nil, fmt.Errorf("encrypted data length %d is not a multiple of AES block size", len(encryptedData))
+		return nil, newCorruptError(SectionHyperHeader, 12, "encrypted data length %d is not a multiple of AES block size", len(encryptedData))
 	}
 	
 	cipher, err := aes.NewCipher(key)
@@ -56,12 +56,12 @@ func AESECBDecrypt(encryptedData []byte, key []byte) ([]byte, error) {
 func DecryptEncryptedBytes(encryptedBytes []byte, key string) ([]byte, error) {
 	keyBytes, err := Base64Decode(key)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrWrongKey, err)
 	}
 	
 	// 检查key长度
 	if len(keyBytes) != 16 && len(keyBytes) != 24 && len(keyBytes) != 32 {
-		return nil, fmt.Errorf("invalid key length, must be 16, 24, or 32 bytes (got %d)", len(keyBytes))
+		return nil, fmt.Errorf("%w: invalid key length, must be 16, 24, or 32 bytes (got %d)", ErrWrongKey, len(keyBytes))
 	}
 	
 	return AESECBDecrypt(encryptedBytes, keyBytes)
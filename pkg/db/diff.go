@@ -0,0 +1,276 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"sort"
+)
+
+// DiffKind 表示两个数据库版本之间一个区间的变化类型
+type DiffKind int
+
+const (
+	DiffAdded   DiffKind = iota // 只在新数据库中存在
+	DiffRemoved                 // 只在旧数据库中存在
+	DiffChanged                 // 两个数据库中都存在但地理信息不同
+)
+
+// String 返回变化类型的名称
+func (kind DiffKind) String() string {
+	switch kind {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	default:
+		return fmt.Sprintf("DiffKind(%d)", int(kind))
+	}
+}
+
+// DiffEntry 表示一个发生变化的区间
+type DiffEntry struct {
+	Kind  DiffKind
+	Range IPRange
+	Old   *GeoResult // 旧数据库中的地理信息，新增的区间为 nil
+	New   *GeoResult // 新数据库中的地理信息，删除的区间为 nil
+}
+
+// Diff 按地址升序同时遍历两个数据库，对每个新增、删除或地理信息改变的区间调用 fn
+//
+// 区间按两个数据库的记录边界切分，相邻且变化相同的区间会合并为一个，因此只是
+// 记录被拆分或合并而地理信息不变的地址不会出现在结果中。fn 返回 false 时提前结束。
+//
+// 参数:
+//   - oldSearcher: 旧版本数据库
+//   - newSearcher: 新版本数据库，IP类型必须与旧版本相同
+//   - fn: 处理每个变化区间的回调函数
+//
+// 返回:
+//   - error: 如果IP类型不同、读取或解码失败则返回错误
+func Diff(oldSearcher, newSearcher *DBSearcher, fn func(entry DiffEntry) bool) error {
+	if oldSearcher == nil || newSearcher == nil {
+		return fmt.Errorf("dbSearcher is nil")
+	}
+	if oldSearcher.IPType != newSearcher.IPType {
+		return fmt.Errorf("%w: cannot diff an IPv%d database against an IPv%d database", ErrIPVersionMismatch, oldSearcher.IPType, newSearcher.IPType)
+	}
+
+	d := &differ{
+		oldIt: oldSearcher.RecordIterator(),
+		newIt: newSearcher.RecordIterator(),
+		fn:    fn,
+	}
+	d.oldOk = d.next(d.oldIt, &d.old)
+	d.newOk = d.next(d.newIt, &d.new)
+
+	for (d.oldOk || d.newOk) && !d.stopped {
+		switch {
+		case !d.newOk || (d.oldOk && d.old.Range.Start.Less(d.new.Range.Start)):
+			// 只有旧记录覆盖的部分，到新记录开始前为止
+			end := d.old.Range.End
+			if d.newOk && d.new.Range.Start.Compare(end) <= 0 {
+				end = d.new.Range.Start.Prev()
+			}
+			d.emit(DiffEntry{Kind: DiffRemoved, Range: IPRange{Start: d.old.Range.Start, End: end}, Old: d.old.Result})
+			d.oldOk = d.consume(d.oldIt, &d.old, end)
+		case !d.oldOk || d.new.Range.Start.Less(d.old.Range.Start):
+			// 只有新记录覆盖的部分，到旧记录开始前为止
+			end := d.new.Range.End
+			if d.oldOk && d.old.Range.Start.Compare(end) <= 0 {
+				end = d.old.Range.Start.Prev()
+			}
+			d.emit(DiffEntry{Kind: DiffAdded, Range: IPRange{Start: d.new.Range.Start, End: end}, New: d.new.Result})
+			d.newOk = d.consume(d.newIt, &d.new, end)
+		default:
+			// 两条记录起点相同，比较到较早结束的一条为止
+			end := d.old.Range.End
+			if d.new.Range.End.Less(end) {
+				end = d.new.Range.End
+			}
+			if !sameGeoResult(d.old.Result, d.new.Result) {
+				d.emit(DiffEntry{Kind: DiffChanged, Range: IPRange{Start: d.old.Range.Start, End: end}, Old: d.old.Result, New: d.new.Result})
+			}
+			d.oldOk = d.consume(d.oldIt, &d.old, end)
+			d.newOk = d.consume(d.newIt, &d.new, end)
+		}
+	}
+
+	if err := d.oldIt.Err(); err != nil {
+		return fmt.Errorf("reading old database: %w", err)
+	}
+	if err := d.newIt.Err(); err != nil {
+		return fmt.Errorf("reading new database: %w", err)
+	}
+	d.flush()
+	return nil
+}
+
+// differ 保存 Diff 的遍历状态
+type differ struct {
+	oldIt, newIt *RecordIterator
+	old, new     Record // 两个数据库中尚未比较的剩余部分
+	oldOk, newOk bool
+	fn           func(entry DiffEntry) bool
+	pending      *DiffEntry // 等待与后续区间合并的变化
+	stopped      bool
+}
+
+// next 读取下一条记录，读取出错时停止遍历，以免把另一侧剩余的记录当作新增或删除输出
+func (d *differ) next(it *RecordIterator, record *Record) bool {
+	if !it.Next() {
+		if it.Err() != nil {
+			d.stopped = true
+		}
+		return false
+	}
+	*record = it.Record()
+	return true
+}
+
+// consume 丢弃记录中 end 及之前的部分，整条记录比较完时读取下一条
+func (d *differ) consume(it *RecordIterator, record *Record, end netip.Addr) bool {
+	if end.Less(record.Range.End) {
+		record.Range.Start = end.Next()
+		return true
+	}
+	return d.next(it, record)
+}
+
+// emit 输出一个变化区间，与上一个相邻且变化相同时合并
+func (d *differ) emit(entry DiffEntry) {
+	pending := d.pending
+	if pending != nil && pending.Kind == entry.Kind && pending.Range.End.Next() == entry.Range.Start &&
+		sameGeoResult(pending.Old, entry.Old) && sameGeoResult(pending.New, entry.New) {
+		pending.Range.End = entry.Range.End
+		return
+	}
+	d.flush()
+	d.pending = &entry
+}
+
+// flush 输出等待合并的变化
+func (d *differ) flush() {
+	if d.pending == nil || d.stopped {
+		return
+	}
+	if !d.fn(*d.pending) {
+		d.stopped = true
+	}
+	d.pending = nil
+}
+
+// sameGeoResult 判断两个结果的列值和 OtherData 是否相同
+func sameGeoResult(a, b *GeoResult) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.OtherData != b.OtherData || len(a.Columns) != len(b.Columns) {
+		return false
+	}
+	for i := range a.Columns {
+		if a.Columns[i] != b.Columns[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// DiffSummary 按某一列的值统计受变化影响的地址数量
+type DiffSummary struct {
+	Column int              // 用于分组的原始列索引
+	Counts map[DiffKind]int // 各类变化的区间数
+	Total  DiffSummaryRow   // 所有分组的合计，Key 为空
+	rows   map[string]*DiffSummaryRow
+}
+
+// DiffSummaryRow 是某一列值受影响的地址数量
+type DiffSummaryRow struct {
+	Key     string   `json:"key"`     // 列值，没有该列时为空字符串
+	Added   *big.Int `json:"added"`   // 新增且属于该值的地址数
+	Removed *big.Int `json:"removed"` // 删除且原属于该值的地址数
+	Changed *big.Int `json:"changed"` // 变化前或变化后属于该值的地址数
+}
+
+// NewDiffSummary 创建按指定列分组的统计
+//
+// 参数:
+//   - column: 地理映射中的原始列索引，例如 0 为国家，1 为省份
+//
+// 返回:
+//   - *DiffSummary: 空的统计
+func NewDiffSummary(column int) *DiffSummary {
+	return &DiffSummary{
+		Column: column,
+		Counts: map[DiffKind]int{},
+		Total:  newDiffSummaryRow(""),
+		rows:   map[string]*DiffSummaryRow{},
+	}
+}
+
+// newDiffSummaryRow 创建计数均为 0 的统计行
+func newDiffSummaryRow(key string) DiffSummaryRow {
+	return DiffSummaryRow{Key: key, Added: new(big.Int), Removed: new(big.Int), Changed: new(big.Int)}
+}
+
+// Add 将一个变化区间计入统计
+func (summary *DiffSummary) Add(entry DiffEntry) {
+	summary.Counts[entry.Kind]++
+	size := entry.Range.Size()
+
+	switch entry.Kind {
+	case DiffAdded:
+		row := summary.row(entry.New)
+		row.Added.Add(row.Added, size)
+		summary.Total.Added.Add(summary.Total.Added, size)
+	case DiffRemoved:
+		row := summary.row(entry.Old)
+		row.Removed.Add(row.Removed, size)
+		summary.Total.Removed.Add(summary.Total.Removed, size)
+	case DiffChanged:
+		oldRow, newRow := summary.row(entry.Old), summary.row(entry.New)
+		oldRow.Changed.Add(oldRow.Changed, size)
+		if newRow != oldRow {
+			newRow.Changed.Add(newRow.Changed, size)
+		}
+		summary.Total.Changed.Add(summary.Total.Changed, size)
+	}
+}
+
+// row 返回结果所属分组的统计行
+func (summary *DiffSummary) row(result *GeoResult) *DiffSummaryRow {
+	var key string
+	if result != nil {
+		key, _ = result.Column(summary.Column)
+	}
+	row, ok := summary.rows[key]
+	if !ok {
+		newRow := newDiffSummaryRow(key)
+		row = &newRow
+		summary.rows[key] = row
+	}
+	return row
+}
+
+// Rows 返回各分组的统计，按受影响的地址总数降序排列
+//
+// 返回:
+//   - []*DiffSummaryRow: 统计行
+func (summary *DiffSummary) Rows() []*DiffSummaryRow {
+	rows := make([]*DiffSummaryRow, 0, len(summary.rows))
+	totals := make(map[*DiffSummaryRow]*big.Int, len(summary.rows))
+	for _, row := range summary.rows {
+		total := new(big.Int).Add(row.Added, row.Removed)
+		totals[row] = total.Add(total, row.Changed)
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if cmp := totals[rows[i]].Cmp(totals[rows[j]]); cmp != 0 {
+			return cmp > 0
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	return rows
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testRangesNext 是 testRanges 的新版本，包含删除、拆分、新增、移动和修改
+var testRangesNext = []testRange{
+	{"1.0.1.0", "1.0.1.255", []string{"中国", "福建", "福州"}, "电信"},
+	{"1.0.2.0", "1.0.3.255", []string{"中国", "福建", "厦门"}, "电信"},
+	{"8.8.8.0", "8.8.8.255", []string{"美国", "", ""}, "Google"},
+	{"9.9.9.0", "9.9.9.255", []string{"美国", "", ""}, "Quad9"},
+	{"10.0.0.0", "10.255.255.255", []string{"局域网", "", ""}, ""},
+	{"11.0.0.0", "11.0.0.255", []string{"局域网", "", ""}, ""},
+	{"114.114.114.128", "114.114.115.255", []string{"中国", "江苏", "南京"}, "信风"},
+	{"192.168.0.0", "192.168.255.255", []string{"局域网", "", ""}, ""},
+	{"223.5.5.0", "223.5.5.255", []string{"中国", "浙江", "杭州"}, "阿里巴巴"},
+}
+
+// TestDiff 测试两个版本之间的变化区间和按国家的统计
+func TestDiff(t *testing.T) {
+	oldSearcher, err := InitDBSearcher(writeTestDB(t, false, testRanges), testDBKey, MEMORY)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(oldSearcher)
+	newSearcher, err := InitDBSearcher(writeTestDB(t, false, testRangesNext), testDBKey, BTREE)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(newSearcher)
+
+	var entries []string
+	summary := NewDiffSummary(0)
+	err = Diff(oldSearcher, newSearcher, func(entry DiffEntry) bool {
+		entries = append(entries, fmt.Sprintf("%s %s %q %q", entry.Kind, entry.Range, entry.Old.String(), entry.New.String()))
+		summary.Add(entry)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Diff 返回错误: %v", err)
+	}
+
+	expected := []string{
+		"removed 1.0.0.0-1.0.0.255 \"澳大利亚\\tnull\\tnull\\tAPNIC\" \"\"",
+		"changed 1.0.2.0-1.0.3.255 \"中国\\t福建\\t福州\\t电信\" \"中国\\t福建\\t厦门\\t电信\"",
+		"added 9.9.9.0-9.9.9.255 \"\" \"美国\\tnull\\tnull\\tQuad9\"",
+		"added 11.0.0.0-11.0.0.255 \"\" \"局域网\\tnull\\tnull\\t\"",
+		"removed 114.114.114.0-114.114.114.127 \"中国\\t江苏\\t南京\\t信风\" \"\"",
+		"added 114.114.115.0-114.114.115.255 \"\" \"中国\\t江苏\\t南京\\t信风\"",
+		"changed 223.5.5.0-223.5.5.255 \"中国\\t浙江\\t杭州\\t阿里云\" \"中国\\t浙江\\t杭州\\t阿里巴巴\"",
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Diff 结果:\n%s\n期望:\n%s", joinLines(entries), joinLines(expected))
+	}
+
+	var rows []string
+	for _, row := range summary.Rows() {
+		rows = append(rows, fmt.Sprintf("%s +%s -%s ~%s", row.Key, row.Added, row.Removed, row.Changed))
+	}
+	expectedRows := []string{"中国 +256 -128 ~768", "局域网 +256 -0 ~0", "澳大利亚 +0 -256 ~0", "美国 +256 -0 ~0"}
+	if !reflect.DeepEqual(rows, expectedRows) {
+		t.Errorf("统计 = %v, 期望 %v", rows, expectedRows)
+	}
+	if summary.Counts[DiffAdded] != 3 || summary.Counts[DiffRemoved] != 2 || summary.Counts[DiffChanged] != 2 {
+		t.Errorf("区间数 = %v", summary.Counts)
+	}
+	if summary.Total.Added.Int64() != 768 || summary.Total.Removed.Int64() != 384 || summary.Total.Changed.Int64() != 768 {
+		t.Errorf("合计 = %+v", summary.Total)
+	}
+
+	// 反向比较时新增和删除互换
+	var reversed []DiffKind
+	Diff(newSearcher, oldSearcher, func(entry DiffEntry) bool {
+		reversed = append(reversed, entry.Kind)
+		return true
+	})
+	if !reflect.DeepEqual(reversed, []DiffKind{DiffAdded, DiffChanged, DiffRemoved, DiffRemoved, DiffAdded, DiffRemoved, DiffChanged}) {
+		t.Errorf("反向比较结果 = %v", reversed)
+	}
+}
+
+// TestDiffEdgeCases 测试相同数据库、提前结束和IP类型不同
+func TestDiffEdgeCases(t *testing.T) {
+	path := writeTestDB(t, false, testRanges)
+	a, err := InitDBSearcher(path, testDBKey, BTREE)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(a)
+	b, err := InitDBSearcher(path, testDBKey, MEMORY)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(b)
+
+	if err := Diff(a, b, func(entry DiffEntry) bool {
+		t.Errorf("相同的数据库不应有变化: %+v", entry)
+		return true
+	}); err != nil {
+		t.Fatalf("Diff 返回错误: %v", err)
+	}
+
+	empty, err := InitDBSearcher(writeTestDB(t, false, testRanges[2:3]), testDBKey, MEMORY)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(empty)
+	count := 0
+	Diff(a, empty, func(entry DiffEntry) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Errorf("提前结束后回调了 %d 次, 期望 1", count)
+	}
+
+	v6, err := InitDBSearcher(writeTestDB(t, true, testRangesV6), testDBKey, MEMORY)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(v6)
+	if err := Diff(a, v6, func(DiffEntry) bool { return true }); !errors.Is(err, ErrIPVersionMismatch) {
+		t.Errorf("IP类型不同的错误 = %v, 期望 %v", err, ErrIPVersionMismatch)
+	}
+}
+
+// TestDiffReadError 测试遍历中途读取失败时立即停止，不把另一侧剩余的记录当作变化输出
+func TestDiffReadError(t *testing.T) {
+	data := buildTestDB(t, false, testRanges)
+	oldSearcher, err := OpenBytes(data, testDBKey, &Options{SearchType: MEMORY})
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(oldSearcher)
+
+	// 破坏新数据库中第5条记录 (114.114.114.0) 的 msgpack 类型字节
+	corrupt := append([]byte(nil), data...)
+	offset := int(oldSearcher.FileOffset)
+	indexOffset := offset + int(oldSearcher.StartIndexPtr) + 4*int(oldSearcher.IndexLength)
+	dataPtr := int(binary.LittleEndian.Uint32(corrupt[indexOffset+8:]))
+	corrupt[offset+dataPtr] = 0xc1
+	newSearcher, err := OpenBytes(corrupt, testDBKey, &Options{SearchType: MEMORY})
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(newSearcher)
+
+	err = Diff(oldSearcher, newSearcher, func(entry DiffEntry) bool {
+		t.Errorf("读取失败时不应输出变化: %s %s", entry.Kind, entry.Range)
+		return true
+	})
+	if !errors.Is(err, ErrCorruptDatabase) {
+		t.Errorf("Diff 错误 = %v, 期望 %v", err, ErrCorruptDatabase)
+	}
+}
+
+// joinLines 将每个元素放在单独的行中
+func joinLines(lines []string) string {
+	var out string
+	for _, line := range lines {
+		out += "  " + line + "\n"
+	}
+	return out
+}
@@ -0,0 +1,240 @@
+package db
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/tagphi/czdb-search-golang/pkg/utils"
+)
+
+// DualStackConfig 描述双栈搜索器中单个数据库的打开参数
+type DualStackConfig struct {
+	Path       string     // 数据库文件路径，为空表示不加载该地址族
+	Key        string     // 数据库解密密钥
+	SearchType SearchType // 搜索类型
+	Options    *Options   // 其他打开选项 (过期策略、列名称、列选择、缓存大小等)，为 nil 时使用默认值，其中的 SearchType 被忽略
+}
+
+// DualStackSearcher 同时持有IPv4和IPv6数据库，按地址族将查询路由到对应的搜索器
+type DualStackSearcher struct {
+	V4 *DBSearcher // IPv4数据库搜索器
+	V6 *DBSearcher // IPv6数据库搜索器
+}
+
+// InitDualStackSearcher 初始化双栈搜索器
+//
+// 参数:
+//   - v4: IPv4数据库的打开参数
+//   - v6: IPv6数据库的打开参数
+//
+// 返回:
+//   - *DualStackSearcher: 初始化后的双栈搜索器
+//   - error: 如果任一数据库初始化失败或类型不符则返回错误
+func InitDualStackSearcher(v4 DualStackConfig, v6 DualStackConfig) (*DualStackSearcher, error) {
+	if v4.Path == "" && v6.Path == "" {
+		return nil, fmt.Errorf("at least one of IPv4 and IPv6 database paths is required")
+	}
+
+	dualStack := &DualStackSearcher{}
+
+	if v4.Path != "" {
+		searcher, err := openDualStackMember(v4, utils.IPV4)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open IPv4 database: %w", err)
+		}
+		dualStack.V4 = searcher
+	}
+
+	if v6.Path != "" {
+		searcher, err := openDualStackMember(v6, utils.IPV6)
+		if err != nil {
+			dualStack.Close()
+			return nil, fmt.Errorf("failed to open IPv6 database: %w", err)
+		}
+		dualStack.V6 = searcher
+	}
+
+	return dualStack, nil
+}
+
+// openDualStackMember 打开数据库并检查其IP类型
+func openDualStackMember(config DualStackConfig, ipType int) (*DBSearcher, error) {
+	opts := Options{}
+	if config.Options != nil {
+		opts = *config.Options
+	}
+	opts.SearchType = config.SearchType
+
+	searcher, err := OpenFile(config.Path, config.Key, &opts)
+	if err != nil {
+		return nil, err
+	}
+	if searcher.IPType != int32(ipType) {
+		CloseDBSearcher(searcher)
+		return nil, fmt.Errorf("%w: %s is an IPv%d database", ErrIPVersionMismatch, config.Path, searcher.IPType)
+	}
+	return searcher, nil
+}
+
+// Route 返回负责查询该IP的搜索器，IPv4映射的IPv6地址按IPv4处理
+//
+// 参数:
+//   - ip: IP地址字符串
+//
+// 返回:
+//   - *DBSearcher: 对应地址族的搜索器
+//   - error: 如果IP无效或对应地址族未加载则返回错误
+func (dualStack *DualStackSearcher) Route(ip string) (*DBSearcher, error) {
+	addr, err := parseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+	return dualStack.RouteAddr(addr)
+}
+
+// RouteAddr 返回负责查询该地址的搜索器，IPv4映射的IPv6地址按IPv4处理
+//
+// 参数:
+//   - addr: IP地址
+//
+// 返回:
+//   - *DBSearcher: 对应地址族的搜索器
+//   - error: 如果地址无效或对应地址族未加载则返回错误
+func (dualStack *DualStackSearcher) RouteAddr(addr netip.Addr) (*DBSearcher, error) {
+	if !addr.IsValid() {
+		return nil, fmt.Errorf("%w: zero netip.Addr", ErrInvalidIP)
+	}
+
+	if addr.Unmap().Is4() {
+		if dualStack.V4 == nil {
+			return nil, fmt.Errorf("%w: no IPv4 database loaded for %s", ErrIPVersionMismatch, addr)
+		}
+		return dualStack.V4, nil
+	}
+
+	if dualStack.V6 == nil {
+		return nil, fmt.Errorf("%w: no IPv6 database loaded for %s", ErrIPVersionMismatch, addr)
+	}
+	return dualStack.V6, nil
+}
+
+// parseAddr 解析IP地址字符串，无效时返回 ErrInvalidIP
+func parseAddr(ip string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%w: %s", ErrInvalidIP, ip)
+	}
+	return addr, nil
+}
+
+// Search 搜索IP地址对应的地理位置信息，返回格式与 db.Search 相同
+//
+// 参数:
+//   - ip: 要查询的IPv4或IPv6地址字符串
+//
+// 返回:
+//   - string: 地理位置信息
+//   - error: 如果搜索失败则返回错误，未找到时返回 ErrNotFound
+func (dualStack *DualStackSearcher) Search(ip string) (string, error) {
+	result, err := dualStack.SearchResult(ip)
+	if err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+// SearchResult 搜索IP地址对应的结构化地理位置信息
+//
+// 参数:
+//   - ip: 要查询的IPv4或IPv6地址字符串
+//
+// 返回:
+//   - *GeoResult: 地理位置信息
+//   - error: 如果搜索失败则返回错误，未找到时返回 ErrNotFound
+func (dualStack *DualStackSearcher) SearchResult(ip string) (*GeoResult, error) {
+	addr, err := parseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+	return dualStack.SearchAddr(addr)
+}
+
+// SearchAddr 使用 netip.Addr 查询地理位置信息，按地址族路由到对应的搜索器
+//
+// 参数:
+//   - addr: 要查询的IP地址，IPv4映射的IPv6地址按IPv4处理
+//
+// 返回:
+//   - *GeoResult: 地理位置信息
+//   - error: 如果搜索失败则返回错误，未找到时返回 ErrNotFound
+func (dualStack *DualStackSearcher) SearchAddr(addr netip.Addr) (*GeoResult, error) {
+	searcher, err := dualStack.RouteAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	return searcher.SearchAddr(addr)
+}
+
+// SearchBatch 批量查询多个IP地址，按地址族分组后分别调用两个搜索器的 SearchBatch
+//
+// 参数:
+//   - ips: 要查询的IP地址，顺序任意
+//
+// 返回:
+//   - []GeoResult: 与 ips 一一对应的地理位置信息，查询失败的位置为零值
+//   - []error: 与 ips 一一对应的错误，成功时为 nil，未找到时为 ErrNotFound
+func (dualStack *DualStackSearcher) SearchBatch(ips []netip.Addr) ([]GeoResult, []error) {
+	results := make([]GeoResult, len(ips))
+	errs := make([]error, len(ips))
+
+	// 按搜索器分组，positions 记录每个地址在 ips 中的位置
+	var groups [2]struct {
+		searcher  *DBSearcher
+		addrs     []netip.Addr
+		positions []int
+	}
+	for i, addr := range ips {
+		searcher, err := dualStack.RouteAddr(addr)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		group := &groups[0]
+		if searcher == dualStack.V6 {
+			group = &groups[1]
+		}
+		group.searcher = searcher
+		group.addrs = append(group.addrs, addr)
+		group.positions = append(group.positions, i)
+	}
+
+	for _, group := range groups {
+		if len(group.addrs) == 0 {
+			continue
+		}
+		groupResults, groupErrs := group.searcher.SearchBatch(group.addrs)
+		for j, i := range group.positions {
+			results[i], errs[i] = groupResults[j], groupErrs[j]
+		}
+	}
+	return results, errs
+}
+
+// Info 打印两个数据库的信息
+func (dualStack *DualStackSearcher) Info() {
+	if dualStack.V4 != nil {
+		utils.Debugln("\n=========== IPv4 Database ===========")
+		Info(dualStack.V4)
+	}
+	if dualStack.V6 != nil {
+		utils.Debugln("\n=========== IPv6 Database ===========")
+		Info(dualStack.V6)
+	}
+}
+
+// Close 关闭两个数据库搜索器
+func (dualStack *DualStackSearcher) Close() {
+	CloseDBSearcher(dualStack.V4)
+	CloseDBSearcher(dualStack.V6)
+}
+
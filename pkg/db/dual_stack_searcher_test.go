@@ -0,0 +1,156 @@
+package db
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+// TestDualStackSearcher 测试按地址族路由查询
+func TestDualStackSearcher(t *testing.T) {
+	v4Path := writeTestDB(t, false, testRanges)
+	v6Path := writeTestDB(t, true, testRangesV6)
+
+	dualStack, err := InitDualStackSearcher(
+		DualStackConfig{Path: v4Path, Key: testDBKey, SearchType: MEMORY},
+		DualStackConfig{Path: v6Path, Key: testDBKey, SearchType: BTREE},
+	)
+	if err != nil {
+		t.Fatalf("初始化双栈搜索器失败: %v", err)
+	}
+	defer dualStack.Close()
+
+	queries := map[string]string{
+		"8.8.8.8":         "美国\tnull\tnull\tGoogle",
+		"::ffff:8.8.8.8":  "美国\tnull\tnull\tGoogle",
+		"2400:3200::1":    "中国\t浙江\t杭州\t阿里云",
+		"2606:4700::1":    "美国\tnull\tnull\tCloudflare",
+		"114.114.114.114": "中国\t江苏\t南京\t信风",
+	}
+	for ip, expected := range queries {
+		region, err := dualStack.Search(ip)
+		if err != nil {
+			t.Errorf("搜索IP %s 失败: %v", ip, err)
+		} else if region != expected {
+			t.Errorf("Search(%s) = %q, 期望 %q", ip, region, expected)
+		}
+	}
+
+	if _, err := dualStack.Search("not-an-ip"); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("无效IP的错误 = %v, 期望 %v", err, ErrInvalidIP)
+	}
+	if _, err := dualStack.SearchResult("2606:4701::"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("未收录IP的错误 = %v, 期望 %v", err, ErrNotFound)
+	}
+
+	result, err := dualStack.SearchAddr(netip.MustParseAddr("::ffff:114.114.114.114"))
+	if err != nil || result.String() != "中国\t江苏\t南京\t信风" {
+		t.Errorf("SearchAddr(::ffff:114.114.114.114) = %v, %v", result, err)
+	}
+	if _, err := dualStack.SearchAddr(netip.Addr{}); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("零值地址的错误 = %v, 期望 %v", err, ErrInvalidIP)
+	}
+}
+
+// TestDualStackSearchBatch 测试批量查询混合地址族时结果保持输入顺序
+func TestDualStackSearchBatch(t *testing.T) {
+	v4Path := writeTestDB(t, false, testRanges)
+	v6Path := writeTestDB(t, true, testRangesV6)
+
+	dualStack, err := InitDualStackSearcher(
+		DualStackConfig{Path: v4Path, Key: testDBKey, SearchType: BTREE},
+		DualStackConfig{Path: v6Path, Key: testDBKey, SearchType: MEMORY},
+	)
+	if err != nil {
+		t.Fatalf("初始化双栈搜索器失败: %v", err)
+	}
+	defer dualStack.Close()
+
+	tests := []struct {
+		addr     netip.Addr
+		expected string
+		err      error
+	}{
+		{netip.MustParseAddr("2400:3200::1"), "中国\t浙江\t杭州\t阿里云", nil},
+		{netip.MustParseAddr("8.8.8.8"), "美国\tnull\tnull\tGoogle", nil},
+		{netip.Addr{}, "", ErrInvalidIP},
+		{netip.MustParseAddr("::ffff:114.114.114.114"), "中国\t江苏\t南京\t信风", nil},
+		{netip.MustParseAddr("2606:4701::"), "", ErrNotFound},
+		{netip.MustParseAddr("2606:4700::1"), "美国\tnull\tnull\tCloudflare", nil},
+	}
+	addrs := make([]netip.Addr, len(tests))
+	for i, test := range tests {
+		addrs[i] = test.addr
+	}
+
+	results, errs := dualStack.SearchBatch(addrs)
+	if len(results) != len(tests) || len(errs) != len(tests) {
+		t.Fatalf("SearchBatch 返回 %d 个结果和 %d 个错误, 期望 %d 个", len(results), len(errs), len(tests))
+	}
+	for i, test := range tests {
+		if test.err != nil {
+			if !errors.Is(errs[i], test.err) {
+				t.Errorf("SearchBatch 第 %d 个地址 %v 的错误 = %v, 期望 %v", i, test.addr, errs[i], test.err)
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Errorf("SearchBatch 第 %d 个地址 %v 返回错误: %v", i, test.addr, errs[i])
+		} else if got := results[i].String(); got != test.expected {
+			t.Errorf("SearchBatch 第 %d 个地址 %v = %q, 期望 %q", i, test.addr, got, test.expected)
+		}
+	}
+
+	// 只加载IPv4数据库时，IPv6地址返回地址族不匹配，IPv4地址正常查询
+	v4Only, err := InitDualStackSearcher(DualStackConfig{Path: v4Path, Key: testDBKey, SearchType: BTREE}, DualStackConfig{})
+	if err != nil {
+		t.Fatalf("初始化双栈搜索器失败: %v", err)
+	}
+	defer v4Only.Close()
+	results, errs = v4Only.SearchBatch([]netip.Addr{netip.MustParseAddr("2400:3200::1"), netip.MustParseAddr("8.8.8.8")})
+	if !errors.Is(errs[0], ErrIPVersionMismatch) {
+		t.Errorf("IPv6地址的错误 = %v, 期望 %v", errs[0], ErrIPVersionMismatch)
+	}
+	if errs[1] != nil || results[1].String() != "美国\tnull\tnull\tGoogle" {
+		t.Errorf("IPv4地址结果 = %q, %v", results[1].String(), errs[1])
+	}
+}
+
+// TestDualStackSearcherMismatch 测试数据库类型与配置的地址族不一致
+func TestDualStackSearcherMismatch(t *testing.T) {
+	v6Path := writeTestDB(t, true, testRangesV6)
+
+	_, err := InitDualStackSearcher(DualStackConfig{Path: v6Path, Key: testDBKey, SearchType: BTREE}, DualStackConfig{})
+	if !errors.Is(err, ErrIPVersionMismatch) {
+		t.Errorf("错误 = %v, 期望 %v", err, ErrIPVersionMismatch)
+	}
+
+	// 每个地址族使用各自的选项
+	dualStack, err := InitDualStackSearcher(
+		DualStackConfig{Path: writeTestDB(t, false, testRanges), Key: testDBKey, SearchType: BTREE, Options: &Options{Columns: []string{"city"}, CacheSize: 4}},
+		DualStackConfig{Path: v6Path, Key: testDBKey, SearchType: MEMORY, Options: &Options{SearchType: MMAP, ExpiryPolicy: ExpiryRefuse}},
+	)
+	if err != nil {
+		t.Fatalf("初始化双栈搜索器失败: %v", err)
+	}
+	if region, err := dualStack.Search("114.114.114.114"); err != nil || region != "南京\t信风" {
+		t.Errorf("选择 city 列后的结果 = %q, %v", region, err)
+	}
+	if dualStack.V4.CacheStats().Capacity != 4 || dualStack.V6.CacheStats().Capacity != 0 {
+		t.Errorf("缓存容量 = %d, %d", dualStack.V4.CacheStats().Capacity, dualStack.V6.CacheStats().Capacity)
+	}
+	if dualStack.V6.SearchType != MEMORY {
+		t.Errorf("IPv6数据库的搜索类型 = %v, 期望 DualStackConfig.SearchType", dualStack.V6.SearchType)
+	}
+	dualStack.Close()
+
+	// 只加载IPv6数据库时，IPv4查询返回地址族不匹配
+	dualStack, err = InitDualStackSearcher(DualStackConfig{}, DualStackConfig{Path: v6Path, Key: testDBKey, SearchType: MMAP})
+	if err != nil {
+		t.Fatalf("初始化双栈搜索器失败: %v", err)
+	}
+	defer dualStack.Close()
+	if _, err := dualStack.Search("8.8.8.8"); !errors.Is(err, ErrIPVersionMismatch) {
+		t.Errorf("错误 = %v, 期望 %v", err, ErrIPVersionMismatch)
+	}
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 可以通过 errors.Is 判断的错误
+var (
+	// ErrNotFound 表示数据库中没有包含该IP的区间
+	ErrNotFound = errors.New("ip not found")
+	// ErrInvalidIP 表示IP地址格式无效
+	ErrInvalidIP = errors.New("invalid ip address")
+	// ErrIPVersionMismatch 表示IP地址版本与数据库类型不一致
+	ErrIPVersionMismatch = errors.New("ip version mismatch")
+	// ErrCorruptDatabase 表示数据库文件损坏或被截断，具体位置见 CorruptDatabaseError
+	ErrCorruptDatabase = errors.New("corrupt database")
+	// ErrWrongKey 表示密钥无效或与数据库文件不匹配
+	ErrWrongKey = errors.New("wrong database key")
+	// ErrClosed 表示搜索器已经关闭
+	ErrClosed = errors.New("searcher closed")
+	// ErrExpired 表示数据库授权已过期，仅在使用 ExpiryRefuse 打开时返回
+	ErrExpired = errors.New("database license expired")
+)
+
+// 数据库文件中的区段名称，用于 CorruptDatabaseError
+const (
+	SectionHyperHeader = "HyperHeader"
+	SectionSuperBlock  = "SuperBlock"
+	SectionHeaderBlock = "HeaderBlock"
+	SectionIndex       = "index"
+	SectionData        = "data"
+	SectionGeoMap      = "geo map"
+)
+
+// CorruptDatabaseError 描述数据库解码失败的位置
+type CorruptDatabaseError struct {
+	Section string // 解码失败的区段 (SuperBlock、HeaderBlock、index、data、geo map 等)
+	Offset  int64  // 解码失败的文件偏移量
+	Err     error  // 底层错误
+}
+
+// Error 实现 error 接口
+func (e *CorruptDatabaseError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("corrupt database: %s at offset %d", e.Section, e.Offset)
+	}
+	return fmt.Sprintf("corrupt database: %s at offset %d: %v", e.Section, e.Offset, e.Err)
+}
+
+// Unwrap 返回底层错误
+func (e *CorruptDatabaseError) Unwrap() error {
+	return e.Err
+}
+
+// Is 使 errors.Is(err, ErrCorruptDatabase) 成立
+func (e *CorruptDatabaseError) Is(target error) bool {
+	return target == ErrCorruptDatabase
+}
+
+// newCorruptError 创建一个 CorruptDatabaseError
+func newCorruptError(section string, offset int64, format string, args ...interface{}) error {
+	return &CorruptDatabaseError{
+		Section: section,
+		Offset:  offset,
+		Err:     fmt.Errorf(format, args...),
+	}
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tagphi/czdb-search-golang/pkg/builder"
+)
+
+// TestSearchErrors 测试查询返回的错误可以通过 errors.Is 判断
+func TestSearchErrors(t *testing.T) {
+	path := writeTestDB(t, false, testRanges)
+
+	dbSearcher, err := InitDBSearcher(path, testDBKey, BTREE)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+
+	tests := []struct {
+		ip       string
+		expected error
+	}{
+		{"9.9.9.9", ErrNotFound},
+		{"0.0.0.1", ErrNotFound},
+		{"invalid", ErrInvalidIP},
+		{"256.1.1.1", ErrInvalidIP},
+		{"2001:db8::1", ErrIPVersionMismatch},
+	}
+
+	for _, test := range tests {
+		if _, err := Search(test.ip, dbSearcher); !errors.Is(err, test.expected) {
+			t.Errorf("Search(%s) 错误 = %v, 期望 %v", test.ip, err, test.expected)
+		}
+		if _, err := dbSearcher.SearchResult(test.ip); !errors.Is(err, test.expected) {
+			t.Errorf("SearchResult(%s) 错误 = %v, 期望 %v", test.ip, err, test.expected)
+		}
+	}
+
+	CloseDBSearcher(dbSearcher)
+	if _, err := Search("8.8.8.8", dbSearcher); !errors.Is(err, ErrClosed) {
+		t.Errorf("关闭后查询错误 = %v, 期望 %v", err, ErrClosed)
+	}
+}
+
+// TestInitErrors 测试初始化时的密钥错误和文件损坏
+func TestInitErrors(t *testing.T) {
+	data := buildTestDB(t, false, testRanges)
+	dir := t.TempDir()
+
+	if _, err := InitDBSearcher(writeTestDB(t, false, testRanges), "c2hvcnQ=", BTREE); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("无效密钥的错误 = %v, 期望 %v", err, ErrWrongKey)
+	}
+
+	// 截断在 SuperBlock 之后 (截断在 SuperBlock 内时无法与错误的随机数据大小区分，返回 ErrWrongKey)
+	truncated := filepath.Join(dir, "truncated.czdb")
+	if err := os.WriteFile(truncated, data[:12+16+testRandomSize+SuperPartLength], 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	_, err := InitDBSearcher(truncated, testDBKey, BTREE)
+	if !errors.Is(err, ErrCorruptDatabase) {
+		t.Fatalf("截断文件的错误 = %v, 期望 %v", err, ErrCorruptDatabase)
+	}
+	var corrupt *CorruptDatabaseError
+	if !errors.As(err, &corrupt) || corrupt.Section != SectionHeaderBlock {
+		t.Errorf("截断文件的错误区段 = %v, 期望 %s", err, SectionHeaderBlock)
+	}
+}
+
+// TestWrongKey 测试长度有效但不匹配的密钥和被篡改的客户端ID都返回 ErrWrongKey
+func TestWrongKey(t *testing.T) {
+	data := buildTestDB(t, false, testRanges)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.czdb")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+
+	// 明文中的客户端ID被篡改
+	tampered := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(tampered[4:], testClientId+1)
+	tamperedPath := filepath.Join(dir, "tampered.czdb")
+	if err := os.WriteFile(tamperedPath, tampered, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		key      string
+		expected error
+	}{
+		{path, testDBKey, nil},
+		{path, "ZmVkY2JhOTg3NjU0MzIxMA==", ErrWrongKey}, // "fedcba9876543210"
+		{path, "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=", ErrWrongKey},
+		{path, "c2hvcnQ=", ErrWrongKey},
+		{tamperedPath, testDBKey, ErrWrongKey},
+	}
+
+	for _, test := range tests {
+		if err := CheckKey(test.path, test.key); !errors.Is(err, test.expected) {
+			t.Errorf("CheckKey(%s, %s) = %v, 期望 %v", filepath.Base(test.path), test.key, err, test.expected)
+		}
+		dbSearcher, err := InitDBSearcher(test.path, test.key, MEMORY)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("InitDBSearcher(%s, %s) 错误 = %v, 期望 %v", filepath.Base(test.path), test.key, err, test.expected)
+		}
+		if err == nil {
+			CloseDBSearcher(dbSearcher)
+		}
+	}
+
+	if err := CheckKey(filepath.Join(dir, "missing.czdb"), testDBKey); err == nil || errors.Is(err, ErrWrongKey) {
+		t.Errorf("文件不存在时 CheckKey = %v, 期望非 ErrWrongKey 的错误", err)
+	}
+}
+
+// TestImplausibleRandomSize 测试随机数据之后放不下 SuperBlock 时返回 ErrWrongKey
+func TestImplausibleRandomSize(t *testing.T) {
+	dbBuilder, err := builder.New(builder.Config{Key: testDBKey, IPVersion: 4, ClientId: testClientId, ExpirationDate: testExpirationDate, RandomSize: 512})
+	if err != nil {
+		t.Fatalf("创建数据库生成器失败: %v", err)
+	}
+	for _, r := range testRanges {
+		if err := dbBuilder.Add(builder.Range{Start: netip.MustParseAddr(r.start), End: netip.MustParseAddr(r.end), Columns: r.columns, Other: r.other}); err != nil {
+			t.Fatalf("添加测试记录失败: %v", err)
+		}
+	}
+	var buf bytes.Buffer
+	if _, err := dbBuilder.WriteTo(&buf); err != nil {
+		t.Fatalf("生成测试数据库失败: %v", err)
+	}
+	dbSearcher, err := OpenBytes(buf.Bytes(), testDBKey, nil)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	superBlockEnd := int(dbSearcher.FileOffset) + SuperPartLength
+	CloseDBSearcher(dbSearcher)
+
+	// 随机数据本身没有超出文件，但之后放不下 SuperBlock
+	if _, err := OpenBytes(buf.Bytes()[:superBlockEnd-1], testDBKey, nil); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("放不下 SuperBlock 时的错误 = %v, 期望 %v", err, ErrWrongKey)
+	}
+	// 放得下 SuperBlock 时是截断的文件，而不是密钥错误
+	if _, err := OpenBytes(buf.Bytes()[:superBlockEnd], testDBKey, nil); err == nil || errors.Is(err, ErrWrongKey) {
+		t.Errorf("截断在 SuperBlock 之后的错误 = %v, 期望非 ErrWrongKey 的错误", err)
+	}
+}
+
+// TestHighClientId 测试最高位为 1 的客户端ID (2048 到 4095) 能被正确解密，不会被当作错误的密钥
+func TestHighClientId(t *testing.T) {
+	for _, clientId := range []int32{2047, 2048, 4095} {
+		dbBuilder, err := builder.New(builder.Config{
+			Key:            testDBKey,
+			IPVersion:      4,
+			ClientId:       clientId,
+			ExpirationDate: testExpirationDate,
+		})
+		if err != nil {
+			t.Fatalf("创建数据库生成器失败: %v", err)
+		}
+		if err := dbBuilder.Add(builder.Range{Start: netip.MustParseAddr("1.0.1.0"), End: netip.MustParseAddr("1.0.3.255"), Columns: []string{"中国"}}); err != nil {
+			t.Fatalf("添加测试记录失败: %v", err)
+		}
+		var buf bytes.Buffer
+		if _, err := dbBuilder.WriteTo(&buf); err != nil {
+			t.Fatalf("生成测试数据库失败: %v", err)
+		}
+
+		dbSearcher, err := OpenBytes(buf.Bytes(), testDBKey, nil)
+		if err != nil {
+			t.Errorf("客户端ID %d: 初始化数据库搜索器失败: %v", clientId, err)
+			continue
+		}
+		if dbSearcher.DecryptedBlock.ClientId != clientId || dbSearcher.DecryptedBlock.ExpirationDate != testExpirationDate {
+			t.Errorf("客户端ID %d: 加密块 = %+v", clientId, dbSearcher.DecryptedBlock)
+		}
+		CloseDBSearcher(dbSearcher)
+	}
+}
+
+// TestCorruptDataRecord 测试数据记录损坏时返回带偏移量的错误
+func TestCorruptDataRecord(t *testing.T) {
+	dbSearcher, err := InitDBSearcher(writeTestDB(t, false, testRanges), testDBKey, MEMORY)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(dbSearcher)
+
+	// 破坏第一条数据记录的 msgpack 类型字节
+	dataPtr := SuperPartLength + int(dbSearcher.HeaderBlockSize)
+	if err := dbSearcher.ensureDBBin(); err != nil {
+		t.Fatalf("加载数据库失败: %v", err)
+	}
+	corruptBin := append([]byte(nil), dbSearcher.DBBin...)
+	corruptBin[dataPtr] = 0xc1 // msgpack 保留字节，永远无效
+	dbSearcher.DBBin = corruptBin
+
+	_, err = Search("1.0.0.1", dbSearcher)
+	var corrupt *CorruptDatabaseError
+	if !errors.As(err, &corrupt) {
+		t.Fatalf("损坏记录的错误 = %v, 期望 CorruptDatabaseError", err)
+	}
+	if corrupt.Section != SectionData || corrupt.Offset != dbSearcher.FileOffset+int64(dataPtr) {
+		t.Errorf("错误位置 = %s@%d, 期望 %s@%d", corrupt.Section, corrupt.Offset, SectionData, dbSearcher.FileOffset+int64(dataPtr))
+	}
+	if !errors.Is(err, ErrCorruptDatabase) {
+		t.Errorf("errors.Is(err, ErrCorruptDatabase) 应该成立")
+	}
+}
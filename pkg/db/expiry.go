@@ -0,0 +1,121 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/tagphi/czdb-search-golang/pkg/utils"
+)
+
+// ExpiryPolicy 打开数据库时对已过期授权的处理方式
+type ExpiryPolicy int
+
+const (
+	ExpiryIgnore ExpiryPolicy = iota // 忽略过期日期 (默认)
+	ExpiryWarn                       // 已过期时输出警告，仍然打开数据库
+	ExpiryRefuse                     // 已过期时拒绝打开，返回 ErrExpired
+)
+
+// timeNow 返回当前时间，测试中可以替换
+var timeNow = time.Now
+
+// String 返回处理方式的名称
+func (policy ExpiryPolicy) String() string {
+	switch policy {
+	case ExpiryIgnore:
+		return "ignore"
+	case ExpiryWarn:
+		return "warn"
+	case ExpiryRefuse:
+		return "refuse"
+	default:
+		return fmt.Sprintf("ExpiryPolicy(%d)", int(policy))
+	}
+}
+
+// ParseExpiryPolicy 解析过期处理方式的名称
+//
+// 参数:
+//   - name: ignore、warn 或 refuse，不区分大小写
+//
+// 返回:
+//   - ExpiryPolicy: 过期处理方式
+//   - error: 如果名称无效则返回错误
+func ParseExpiryPolicy(name string) (ExpiryPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "ignore":
+		return ExpiryIgnore, nil
+	case "warn":
+		return ExpiryWarn, nil
+	case "refuse":
+		return ExpiryRefuse, nil
+	default:
+		return 0, fmt.Errorf("invalid expiry policy %q: must be ignore, warn or refuse", name)
+	}
+}
+
+// expirationDay 将 yymmdd 形式的过期日期转换为当天零点 (本地时间)
+func expirationDay(date int32) (time.Time, bool) {
+	year, month, day := int(date/10000), time.Month(date/100%100), int(date%100)
+	t := time.Date(2000+year, month, day, 0, 0, 0, 0, time.Local)
+	if date <= 0 || t.Month() != month || t.Day() != day {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ExpiresAt 返回数据库授权失效的时刻，即过期日期次日零点 (本地时间)
+//
+// 过期日期当天仍然有效。加密块中的日期不是有效的 yymmdd 时返回零值。
+//
+// 返回:
+//   - time.Time: 授权失效的时刻
+func (dbSearcher *DBSearcher) ExpiresAt() time.Time {
+	if dbSearcher.DecryptedBlock == nil {
+		return time.Time{}
+	}
+	day, ok := expirationDay(dbSearcher.DecryptedBlock.ExpirationDate)
+	if !ok {
+		return time.Time{}
+	}
+	return day.AddDate(0, 0, 1)
+}
+
+// DaysUntilExpiry 返回距离过期日期的天数
+//
+// 0 表示今天是最后一个有效日，负数表示已经过期的天数。没有有效的过期日期时
+// 返回 math.MaxInt32。
+//
+// 返回:
+//   - int: 剩余天数
+func (dbSearcher *DBSearcher) DaysUntilExpiry() int {
+	expiresAt := dbSearcher.ExpiresAt()
+	if expiresAt.IsZero() {
+		return math.MaxInt32
+	}
+	// 按日历日计算，避免夏令时切换导致的误差
+	now := timeNow().In(time.Local)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	last := time.Date(expiresAt.Year(), expiresAt.Month(), expiresAt.Day()-1, 0, 0, 0, 0, time.UTC)
+	return int(last.Sub(today).Hours() / 24)
+}
+
+// Expired 判断数据库授权是否已经过期
+func (dbSearcher *DBSearcher) Expired() bool {
+	return dbSearcher.DaysUntilExpiry() < 0
+}
+
+// checkExpiry 按处理方式检查授权是否过期
+func checkExpiry(dbSearcher *DBSearcher, policy ExpiryPolicy) error {
+	if policy == ExpiryIgnore || !dbSearcher.Expired() {
+		return nil
+	}
+	expiredOn := dbSearcher.ExpiresAt().AddDate(0, 0, -1).Format("2006-01-02")
+	if policy == ExpiryRefuse {
+		return fmt.Errorf("%w: license expired on %s", ErrExpired, expiredOn)
+	}
+	utils.Warning("database license expired on %s (%d days ago)\n", expiredOn, -dbSearcher.DaysUntilExpiry())
+	return nil
+}
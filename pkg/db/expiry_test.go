@@ -0,0 +1,96 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/tagphi/czdb-search-golang/pkg/builder"
+)
+
+// buildExpiringDB 构造指定过期日期的测试数据库
+func buildExpiringDB(t *testing.T, expirationDate int32) []byte {
+	t.Helper()
+
+	dbBuilder, err := builder.New(builder.Config{Key: testDBKey, ClientId: testClientId, ExpirationDate: expirationDate})
+	if err != nil {
+		t.Fatalf("创建数据库生成器失败: %v", err)
+	}
+	dbBuilder.Add(builder.Range{Start: netip.MustParseAddr("1.0.0.0"), End: netip.MustParseAddr("1.0.0.255"), Columns: []string{"中国"}})
+	var buf bytes.Buffer
+	if _, err := dbBuilder.WriteTo(&buf); err != nil {
+		t.Fatalf("生成测试数据库失败: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestExpiresAt 测试过期日期的解析和剩余天数
+func TestExpiresAt(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return time.Date(2025, 3, 1, 15, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		date      int32
+		expiresAt time.Time
+		days      int
+	}{
+		{250301, time.Date(2025, 3, 2, 0, 0, 0, 0, time.Local), 0},
+		{250228, time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local), -1},
+		{251231, time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local), 305},
+		{240229, time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local), -366},
+		{250230, time.Time{}, math.MaxInt32},
+		{991300, time.Time{}, math.MaxInt32},
+	}
+
+	for _, test := range tests {
+		dbSearcher := &DBSearcher{DecryptedBlock: &DecryptedBlock{ExpirationDate: test.date}}
+		if expiresAt := dbSearcher.ExpiresAt(); !expiresAt.Equal(test.expiresAt) {
+			t.Errorf("%d: ExpiresAt = %v, 期望 %v", test.date, expiresAt, test.expiresAt)
+		}
+		if days := dbSearcher.DaysUntilExpiry(); days != test.days {
+			t.Errorf("%d: DaysUntilExpiry = %d, 期望 %d", test.date, days, test.days)
+		}
+		if dbSearcher.Expired() != (test.days < 0) {
+			t.Errorf("%d: Expired = %v", test.date, dbSearcher.Expired())
+		}
+	}
+}
+
+// TestExpiryPolicy 测试打开已过期的数据库时各处理方式的行为
+func TestExpiryPolicy(t *testing.T) {
+	expired := buildExpiringDB(t, 200101)
+	valid := buildExpiringDB(t, 991231)
+
+	tests := []struct {
+		data     []byte
+		policy   ExpiryPolicy
+		expected error
+	}{
+		{expired, ExpiryIgnore, nil},
+		{expired, ExpiryWarn, nil},
+		{expired, ExpiryRefuse, ErrExpired},
+		{valid, ExpiryRefuse, nil},
+	}
+
+	for _, test := range tests {
+		dbSearcher, err := OpenBytes(test.data, testDBKey, &Options{ExpiryPolicy: test.policy})
+		if !errors.Is(err, test.expected) {
+			t.Errorf("%v: 错误 = %v, 期望 %v", test.policy, err, test.expected)
+		}
+		if err == nil {
+			CloseDBSearcher(dbSearcher)
+		}
+	}
+
+	for _, name := range []string{"ignore", "WARN", "refuse"} {
+		if _, err := ParseExpiryPolicy(name); err != nil {
+			t.Errorf("ParseExpiryPolicy(%q) 返回错误: %v", name, err)
+		}
+	}
+	if _, err := ParseExpiryPolicy("deny"); err == nil {
+		t.Errorf("ParseExpiryPolicy(\"deny\") 应返回错误")
+	}
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tagphi/czdb-search-golang/pkg/builder"
+)
+
+const (
+	testDBKey          = "MDEyMzQ1Njc4OWFiY2RlZg==" // "0123456789abcdef"
+	testClientId       = 42
+	testExpirationDate = 301231
+	testRandomSize     = 7
+	testHeaderPageSize = 3 // 每个头部行覆盖的索引块数，取小值以覆盖多个头部行
+)
+
+// testRange 描述测试数据库中的一条记录
+type testRange struct {
+	start   string
+	end     string
+	columns []string
+	other   string
+}
+
+// testRanges 是默认的IPv4测试数据，区间之间留有空隙
+var testRanges = []testRange{
+	{"1.0.0.0", "1.0.0.255", []string{"澳大利亚", "", ""}, "APNIC"},
+	{"1.0.1.0", "1.0.3.255", []string{"中国", "福建", "福州"}, "电信"},
+	{"8.8.8.0", "8.8.8.255", []string{"美国", "", ""}, "Google"},
+	{"10.0.0.0", "10.255.255.255", []string{"局域网", "", ""}, ""},
+	{"114.114.114.0", "114.114.114.255", []string{"中国", "江苏", "南京"}, "信风"},
+	{"192.168.0.0", "192.168.255.255", []string{"局域网", "", ""}, ""},
+	{"223.5.5.0", "223.5.5.255", []string{"中国", "浙江", "杭州"}, "阿里云"},
+}
+
+// testRangesV6 是默认的IPv6测试数据
+var testRangesV6 = []testRange{
+	{"2001:db8::", "2001:db8::ffff", []string{"文档", "", ""}, ""},
+	{"2400:3200::", "2400:3200:ffff:ffff:ffff:ffff:ffff:ffff", []string{"中国", "浙江", "杭州"}, "阿里云"},
+	{"2606:4700::", "2606:4700::ffff", []string{"美国", "", ""}, "Cloudflare"},
+}
+
+// buildTestDB 使用 builder 包构造一个完整的加密数据库文件
+func buildTestDB(t testing.TB, ipv6 bool, ranges []testRange) []byte {
+	t.Helper()
+
+	ipVersion := 4
+	if ipv6 {
+		ipVersion = 6
+	}
+	dbBuilder, err := builder.New(builder.Config{
+		Key:            testDBKey,
+		IPVersion:      ipVersion,
+		ClientId:       testClientId,
+		ExpirationDate: testExpirationDate,
+		RandomSize:     testRandomSize,
+		HeaderPageSize: testHeaderPageSize,
+	})
+	if err != nil {
+		t.Fatalf("创建数据库生成器失败: %v", err)
+	}
+
+	for _, r := range ranges {
+		err := dbBuilder.Add(builder.Range{
+			Start:   netip.MustParseAddr(r.start),
+			End:     netip.MustParseAddr(r.end),
+			Columns: r.columns,
+			Other:   r.other,
+		})
+		if err != nil {
+			t.Fatalf("添加测试记录失败: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := dbBuilder.WriteTo(&buf); err != nil {
+		t.Fatalf("生成测试数据库失败: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// writeTestDB 构造测试数据库并写入临时文件，返回文件路径
+func writeTestDB(t testing.TB, ipv6 bool, ranges []testRange) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.czdb")
+	if err := os.WriteFile(path, buildTestDB(t, ipv6, ranges), 0644); err != nil {
+		t.Fatalf("写入测试数据库失败: %v", err)
+	}
+	return path
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// GeoResult 表示一次查询得到的结构化地理信息
+type GeoResult struct {
+	Columns       []string // 按列顺序排列的选中列值 (空值保持为空字符串)
+	ColumnIndexes []int    // 每个列值在地理映射中的原始列索引，与 ColumnSelection 对应
+	OtherData     string   // 数据记录中的其他数据，原样保留
+	Schema        []string // 列名称，按原始列索引排列，由搜索器填充
+}
+
+// Column 返回原始列索引为 index 的列值
+//
+// 参数:
+//   - index: 地理映射中的原始列索引
+//
+// 返回:
+//   - string: 列值
+//   - bool: 该列是否被选中
+func (r *GeoResult) Column(index int) (string, bool) {
+	for i, columnIndex := range r.ColumnIndexes {
+		if columnIndex == index {
+			return r.Columns[i], true
+		}
+	}
+	return "", false
+}
+
+// Name 返回 Columns 中第 i 个列值的名称
+//
+// 参数:
+//   - i: 列值在 Columns 中的位置
+//
+// 返回:
+//   - string: 列名称，Schema 中没有该列时为 "column_<原始列索引>"
+func (r *GeoResult) Name(i int) string {
+	return ColumnName(r.Schema, r.ColumnIndexes[i])
+}
+
+// Get 按列名称返回列值
+//
+// 参数:
+//   - name: 列名称，如 "country"、"city"
+//
+// 返回:
+//   - string: 列值
+//   - bool: 该列是否被选中
+func (r *GeoResult) Get(name string) (string, bool) {
+	index, ok := columnIndex(r.Schema, name)
+	if !ok {
+		return "", false
+	}
+	return r.Column(index)
+}
+
+// Map 返回列名称到列值的映射，只包含选中的列
+func (r *GeoResult) Map() map[string]string {
+	values := make(map[string]string, len(r.Columns))
+	for i, value := range r.Columns {
+		values[r.Name(i)] = value
+	}
+	return values
+}
+
+// String 按旧版 Search 的格式输出结果：每个选中列后跟一个制表符，
+// 空值写为 "null"，最后拼接 OtherData
+func (r *GeoResult) String() string {
+	if r == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, value := range r.Columns {
+		if value == "" {
+			value = "null"
+		}
+		sb.WriteString(value)
+		sb.WriteString("\t")
+	}
+	sb.WriteString(r.OtherData)
+	return sb.String()
+}
+
+// SelectedColumns 返回列选择位掩码中被选中的列索引，按升序排列
+//
+// 参数:
+//   - columnSelection: 列选择位掩码，第 i 列对应第 i+1 位
+//
+// 返回:
+//   - []int: 选中的列索引
+func SelectedColumns(columnSelection int32) []int {
+	var indexes []int
+	for i := 0; i < 31; i++ {
+		if (columnSelection >> (i + 1) & 1) == 1 {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// DecodeGeoResult 解码数据记录，并根据 columnSelection 从地理映射中取出选中的列
+//
+// 参数:
+//   - geoMapData: 解密后的地理映射数据
+//   - columnSelection: 列选择位掩码，第 i 列对应第 i+1 位
+//   - data: 索引指向的 msgpack 数据记录
+//
+// 返回:
+//   - *GeoResult: 结构化的地理信息
+//   - error: 如果解码失败则返回 *CorruptDatabaseError，其 Offset 相对于 data 或
+//     geoMapData 的起始位置；地理映射解码失败时结果中仍保留已解码的 OtherData
+func DecodeGeoResult(geoMapData []byte, columnSelection int32, data []byte) (*GeoResult, error) {
+	// 使用msgpack直接解码，类似Java实现
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+
+	// 解包第一个值：geoPosMixSize (uint64)
+	geoPosMixSize, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, newCorruptError(SectionData, 0, "failed to decode geoPosMixSize: %v", err)
+	}
+
+	// 解包第二个值：otherData (string)
+	otherData, err := dec.DecodeString()
+	if err != nil {
+		return nil, newCorruptError(SectionData, 0, "failed to decode otherData: %v", err)
+	}
+
+	result := &GeoResult{OtherData: otherData}
+
+	// 如果geoPosMixSize为0，只有otherData
+	if geoPosMixSize == 0 {
+		return result, nil
+	}
+
+	// 提取地理指针和长度（来自 msgpack 记录，非索引中的 DB 偏移）
+	geoLen := int((geoPosMixSize >> 24) & 0xFF)
+	geoPtr := int(geoPosMixSize & 0x00FFFFFF)
+
+	// 索引无效时只返回otherData
+	if geoPtr < 0 || geoPtr+geoLen > len(geoMapData) {
+		return result, nil
+	}
+
+	// 使用新的解码器解包地理数据
+	geoDec := msgpack.NewDecoder(bytes.NewReader(geoMapData[geoPtr : geoPtr+geoLen]))
+
+	// 读取数组头，获取列数
+	columnNumber, err := geoDec.DecodeArrayLen()
+	if err != nil {
+		return result, newCorruptError(SectionGeoMap, int64(geoPtr), "failed to decode column array: %v", err)
+	}
+
+	for i := 0; i < columnNumber; i++ {
+		// 解码列值（字符串）
+		value, err := geoDec.DecodeString()
+		if err != nil {
+			return result, newCorruptError(SectionGeoMap, int64(geoPtr), "failed to decode column %d: %v", i, err)
+		}
+
+		// 检查列是否被选中
+		if (columnSelection >> (i + 1) & 1) == 1 {
+			result.Columns = append(result.Columns, value)
+			result.ColumnIndexes = append(result.ColumnIndexes, i)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// 构造一条数据记录和对应的地理映射
+func buildGeoRecord(t *testing.T, columns []string, otherData string) ([]byte, []byte) {
+	t.Helper()
+
+	geoMap, err := msgpack.Marshal(columns)
+	if err != nil {
+		t.Fatalf("编码地理映射失败: %v", err)
+	}
+
+	geoPosMixSize := uint64(len(geoMap)) << 24
+	data, err := msgpack.Marshal(geoPosMixSize)
+	if err != nil {
+		t.Fatalf("编码geoPosMixSize失败: %v", err)
+	}
+	other, err := msgpack.Marshal(otherData)
+	if err != nil {
+		t.Fatalf("编码otherData失败: %v", err)
+	}
+	return geoMap, append(data, other...)
+}
+
+// TestDecodeGeoResult 测试结构化结果的解码及列选择
+func TestDecodeGeoResult(t *testing.T) {
+	geoMap, data := buildGeoRecord(t, []string{"中国", "", "null\tcity"}, "电信")
+
+	// 选中第 0 列和第 1 列 (第 1、2 位)
+	result, err := DecodeGeoResult(geoMap, 0x6, data)
+	if err != nil {
+		t.Fatalf("DecodeGeoResult 返回错误: %v", err)
+	}
+
+	if len(result.Columns) != 2 || result.Columns[0] != "中国" || result.Columns[1] != "" {
+		t.Errorf("Columns = %q, 期望 [中国 \"\"]", result.Columns)
+	}
+	if len(result.ColumnIndexes) != 2 || result.ColumnIndexes[0] != 0 || result.ColumnIndexes[1] != 1 {
+		t.Errorf("ColumnIndexes = %v, 期望 [0 1]", result.ColumnIndexes)
+	}
+	if result.OtherData != "电信" {
+		t.Errorf("OtherData = %q, 期望 %q", result.OtherData, "电信")
+	}
+	if value, ok := result.Column(2); ok {
+		t.Errorf("未选中的列 2 不应返回值, 得到 %q", value)
+	}
+
+	// 选中第 2 列时，值中的制表符和 "null" 原样保留
+	result, err = DecodeGeoResult(geoMap, 0x8, data)
+	if err != nil {
+		t.Fatalf("DecodeGeoResult 返回错误: %v", err)
+	}
+	if value, ok := result.Column(2); !ok || value != "null\tcity" {
+		t.Errorf("Column(2) = %q, %v, 期望 %q", value, ok, "null\tcity")
+	}
+}
+
+// TestGeoResultString 测试 String 与旧版格式保持一致
+func TestGeoResultString(t *testing.T) {
+	geoMap, data := buildGeoRecord(t, []string{"中国", "", "北京"}, "电信")
+
+	result, err := DecodeGeoResult(geoMap, 0xE, data)
+	if err != nil {
+		t.Fatalf("DecodeGeoResult 返回错误: %v", err)
+	}
+
+	expected := "中国\tnull\t北京\t电信"
+	if result.String() != expected {
+		t.Errorf("String() = %q, 期望 %q", result.String(), expected)
+	}
+
+	legacy, err := GetActualGeo(geoMap, 0xE, data)
+	if err != nil {
+		t.Fatalf("GetActualGeo 返回错误: %v", err)
+	}
+	if legacy != expected {
+		t.Errorf("GetActualGeo = %q, 期望 %q", legacy, expected)
+	}
+}
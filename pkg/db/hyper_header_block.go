@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/tagphi/czdb-search-golang/pkg/utils"
@@ -15,16 +16,16 @@ type HyperHeaderBlock struct {
 	DecryptedBlock    *DecryptedBlock
 }
 
-// 解密超级头部块
-func DecryptHyperHeaderBlock(file *os.File, key string) (*HyperHeaderBlock, error) {
+// 解密超级头部块，从 reader 的当前位置 (文件开头) 顺序读取
+func DecryptHyperHeaderBlock(reader io.Reader, key string) (*HyperHeaderBlock, error) {
 	// 读取版本号和客户端ID（共8字节）
 	headerBytes := make([]byte, 8)
-	bytesRead, err := file.Read(headerBytes)
+	bytesRead, err := io.ReadFull(reader, headerBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read HyperHeaderBlock: %v", err)
+		return nil, newCorruptError(SectionHyperHeader, 0, "failed to read HyperHeaderBlock: %v", err)
 	}
 	if bytesRead < 8 {
-		return nil, fmt.Errorf("incomplete HyperHeaderBlock read: %d of 8 bytes", bytesRead)
+		return nil, newCorruptError(SectionHyperHeader, 0, "incomplete HyperHeaderBlock read: %d of 8 bytes", bytesRead)
 	}
 	
 	// 解析超级头部块
@@ -35,35 +36,35 @@ func DecryptHyperHeaderBlock(file *os.File, key string) (*HyperHeaderBlock, erro
 	
 	// 读取加密块大小（4字节）
 	encryptedBlockSizeBytes := make([]byte, 4)
-	bytesRead, err = file.Read(encryptedBlockSizeBytes)
+	bytesRead, err = io.ReadFull(reader, encryptedBlockSizeBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read encrypted block size: %v", err)
+		return nil, newCorruptError(SectionHyperHeader, 8, "failed to read encrypted block size: %v", err)
 	}
 	if bytesRead < 4 {
-		return nil, fmt.Errorf("incomplete encrypted block size read: %d of 4 bytes", bytesRead)
+		return nil, newCorruptError(SectionHyperHeader, 8, "incomplete encrypted block size read: %d of 4 bytes", bytesRead)
 	}
 	
 	hyperHeader.EncryptedBlockSize = utils.GetIntLong(encryptedBlockSizeBytes, 0)
 	
 	// 检查加密块大小是否有效
 	if hyperHeader.EncryptedBlockSize <= 0 || hyperHeader.EncryptedBlockSize > 1000000 {
-		return nil, fmt.Errorf("invalid encrypted block size: %d", hyperHeader.EncryptedBlockSize)
+		return nil, newCorruptError(SectionHyperHeader, 8, "invalid encrypted block size: %d", hyperHeader.EncryptedBlockSize)
 	}
 	
 	// 读取加密块
 	encryptedBlockBytes := make([]byte, hyperHeader.EncryptedBlockSize)
-	bytesRead, err = file.Read(encryptedBlockBytes)
+	bytesRead, err = io.ReadFull(reader, encryptedBlockBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read encrypted block: %v", err)
+		return nil, newCorruptError(SectionHyperHeader, 12, "failed to read encrypted block: %v", err)
 	}
 	if bytesRead < int(hyperHeader.EncryptedBlockSize) {
-		return nil, fmt.Errorf("incomplete encrypted block read: %d of %d bytes", bytesRead, hyperHeader.EncryptedBlockSize)
+		return nil, newCorruptError(SectionHyperHeader, 12, "incomplete encrypted block read: %d of %d bytes", bytesRead, hyperHeader.EncryptedBlockSize)
 	}
 	
 	// 解密加密块
 	decryptedBytes, err := DecryptEncryptedBytes(encryptedBlockBytes, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt block: %v", err)
+		return nil, fmt.Errorf("failed to decrypt block: %w", err)
 	}
 	
 	// 解析ClientId和ExpirationDate
@@ -72,7 +73,7 @@ func DecryptHyperHeaderBlock(file *os.File, key string) (*HyperHeaderBlock, erro
 		combinedValue := utils.GetIntLong(decryptedBytes, 0)
 		
 		decryptedBlock := &DecryptedBlock{
-			ClientId:       combinedValue >> ClientIdShift,           // 获取高12位，右移20位
+			ClientId:       int32(uint32(combinedValue) >> ClientIdShift), // 获取高12位，按无符号数右移20位，避免 2048 以上的ID符号扩展
 			ExpirationDate: combinedValue & ExpirationDateMask,       // 获取低20位，用掩码提取
 		}
 		
@@ -82,13 +83,58 @@ func DecryptHyperHeaderBlock(file *os.File, key string) (*HyperHeaderBlock, erro
 		}
 		
 		hyperHeader.DecryptedBlock = decryptedBlock
+		
+		// 密钥错误时解密结果是随机数据，客户端ID几乎不可能与明文中的一致
+		if decryptedBlock.ClientId != hyperHeader.ClientId {
+			return nil, fmt.Errorf("%w: client ID %d in the encrypted block does not match %d in the header", ErrWrongKey, decryptedBlock.ClientId, hyperHeader.ClientId)
+		}
+		if decryptedBlock.RandomSize < 0 {
+			return nil, fmt.Errorf("%w: implausible random data size %d", ErrWrongKey, decryptedBlock.RandomSize)
+		}
 	} else {
-		return nil, fmt.Errorf("decrypted data too small: %d bytes", len(decryptedBytes))
+		return nil, newCorruptError(SectionHyperHeader, 12, "decrypted data too small: %d bytes", len(decryptedBytes))
 	}
 	
 	return hyperHeader, nil
 }
 
+// checkRandomSize 检查随机数据之后是否还能容纳 SuperBlock，文件放不下的随机数据大小视为密钥错误
+func checkRandomSize(hyperHeader *HyperHeaderBlock, size int64) error {
+	randomSize := int64(hyperHeader.DecryptedBlock.RandomSize)
+	available := size - int64(GetHyperHeaderBlockSize(hyperHeader)) - SuperPartLength
+	if randomSize > available {
+		return fmt.Errorf("%w: implausible random data size %d for a %d byte file", ErrWrongKey, randomSize, size)
+	}
+	return nil
+}
+
+// CheckKey 检查密钥是否与数据库文件匹配，只读取并解密文件头部
+//
+// 参数:
+//   - dbPath: 数据库文件路径
+//   - key: 数据库解密密钥
+//
+// 返回:
+//   - error: 密钥匹配时返回 nil，密钥错误时返回 ErrWrongKey，文件无法读取或损坏时返回其他错误
+func CheckKey(dbPath string, key string) error {
+	file, err := os.Open(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database file: %v", err)
+	}
+	defer file.Close()
+	
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %v", err)
+	}
+	
+	hyperHeader, err := DecryptHyperHeaderBlock(file, key)
+	if err != nil {
+		return err
+	}
+	return checkRandomSize(hyperHeader, fileInfo.Size())
+}
+
 // 获取超级头部块大小
 func GetHyperHeaderBlockSize(hyperHeader *HyperHeaderBlock) int {
 	// 版本号(4字节) + 客户端ID(4字节) + 加密块大小(4字节) + 加密块
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+)
+
+// IPRange 表示数据库中的一个IP区间，Start 和 End 均包含在区间内
+type IPRange struct {
+	Start netip.Addr // 区间起始IP
+	End   netip.Addr // 区间结束IP
+}
+
+// Contains 判断IP是否位于区间内
+func (r IPRange) Contains(addr netip.Addr) bool {
+	return r.Start.Compare(addr) <= 0 && addr.Compare(r.End) <= 0
+}
+
+// String 以 "start-end" 的形式输出区间
+func (r IPRange) String() string {
+	return r.Start.String() + "-" + r.End.String()
+}
+
+// Size 返回区间包含的地址数量，区间无效时为 0
+func (r IPRange) Size() *big.Int {
+	if !r.Start.IsValid() || !r.End.IsValid() || r.Start.BitLen() != r.End.BitLen() || r.End.Less(r.Start) {
+		return new(big.Int)
+	}
+	size := new(big.Int).SetBytes(r.End.AsSlice())
+	size.Sub(size, new(big.Int).SetBytes(r.Start.AsSlice()))
+	return size.Add(size, big.NewInt(1))
+}
+
+// Prefixes 返回恰好覆盖该区间的最少CIDR前缀列表，按地址升序排列
+//
+// 返回:
+//   - []netip.Prefix: CIDR前缀列表，区间无效时为 nil
+func (r IPRange) Prefixes() []netip.Prefix {
+	if !r.Start.IsValid() || !r.End.IsValid() || r.Start.BitLen() != r.End.BitLen() || r.End.Less(r.Start) {
+		return nil
+	}
+
+	var prefixes []netip.Prefix
+	start := r.Start
+	for {
+		// 从最大的块开始尝试，取以 start 为起点且不超过 End 的最大前缀
+		var prefix netip.Prefix
+		var last netip.Addr
+		for bits := 0; bits <= start.BitLen(); bits++ {
+			prefix = netip.PrefixFrom(start, bits)
+			if prefix.Masked().Addr() != start {
+				continue
+			}
+			last = lastAddr(prefix)
+			if last.Compare(r.End) <= 0 {
+				break
+			}
+		}
+
+		prefixes = append(prefixes, prefix)
+		if last == r.End {
+			return prefixes
+		}
+		start = last.Next()
+	}
+}
+
+// lastAddr 返回前缀中的最后一个地址
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	ipBytes := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(ipBytes)*8; i++ {
+		ipBytes[i/8] |= 1 << (7 - i%8)
+	}
+	last, _ := netip.AddrFromSlice(ipBytes)
+	return last
+}
+
+// ipRange 将索引块中的起止IP转换为 IPRange
+func (record *indexRecord) ipRange() IPRange {
+	start, _ := netip.AddrFromSlice(record.StartIP)
+	end, _ := netip.AddrFromSlice(record.EndIP)
+	return IPRange{Start: start, End: end}
+}
+
+// SearchRange 查询IP地址，同时返回命中的区间
+//
+// 参数:
+//   - ip: 要查询的IP地址字符串
+//
+// 返回:
+//   - *GeoResult: 地理位置信息
+//   - IPRange: 命中的区间，可通过 Prefixes 获取其CIDR分解
+//   - error: 如果搜索失败则返回错误，未找到时返回 ErrNotFound
+func (dbSearcher *DBSearcher) SearchRange(ip string) (*GeoResult, IPRange, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil, IPRange{}, fmt.Errorf("%w: %s", ErrInvalidIP, ip)
+	}
+	return dbSearcher.searchBytesRange(parsedIP)
+}
+
+// SearchAddrRange 使用 netip.Addr 查询，同时返回命中的区间
+//
+// 参数:
+//   - addr: 要查询的IP地址
+//
+// 返回:
+//   - *GeoResult: 地理位置信息
+//   - IPRange: 命中的区间
+//   - error: 如果搜索失败则返回错误，未找到时返回 ErrNotFound
+func (dbSearcher *DBSearcher) SearchAddrRange(addr netip.Addr) (*GeoResult, IPRange, error) {
+	if !addr.IsValid() {
+		return nil, IPRange{}, fmt.Errorf("%w: zero netip.Addr", ErrInvalidIP)
+	}
+	ip16 := addr.As16()
+	return dbSearcher.searchBytesRange(ip16[:])
+}
+
+// searchBytesRange 按IP字节查询并返回命中的区间
+func (dbSearcher *DBSearcher) searchBytesRange(ip []byte) (*GeoResult, IPRange, error) {
+	if dbSearcher == nil {
+		return nil, IPRange{}, fmt.Errorf("dbSearcher is nil")
+	}
+
+	ipBytes, err := dbSearcher.normalizeIPBytes(ip)
+	if err != nil {
+		return nil, IPRange{}, err
+	}
+	memoryMode, err := dbSearcher.memoryMode()
+	if err != nil {
+		return nil, IPRange{}, err
+	}
+
+	record, result, err := searchRecordCached(dbSearcher, ipBytes, memoryMode)
+	if err != nil {
+		return nil, IPRange{}, err
+	}
+	return result, record.ipRange(), nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+// TestIPRangePrefixes 测试区间的CIDR分解
+func TestIPRangePrefixes(t *testing.T) {
+	tests := []struct {
+		start    string
+		end      string
+		expected []string
+	}{
+		{"1.0.0.0", "1.0.0.255", []string{"1.0.0.0/24"}},
+		{"1.0.1.0", "1.0.3.255", []string{"1.0.1.0/24", "1.0.2.0/23"}},
+		{"10.0.0.1", "10.0.0.6", []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{"0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"255.255.255.255", "255.255.255.255", []string{"255.255.255.255/32"}},
+		{"2400:3200::", "2400:3200:ffff:ffff:ffff:ffff:ffff:ffff", []string{"2400:3200::/32"}},
+		{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"::/0"}},
+		{"2.2.2.2", "1.1.1.1", nil},
+	}
+
+	for _, test := range tests {
+		r := IPRange{Start: netip.MustParseAddr(test.start), End: netip.MustParseAddr(test.end)}
+		var prefixes []string
+		for _, prefix := range r.Prefixes() {
+			prefixes = append(prefixes, prefix.String())
+		}
+		if !reflect.DeepEqual(prefixes, test.expected) {
+			t.Errorf("%s.Prefixes() = %v, 期望 %v", r, prefixes, test.expected)
+		}
+	}
+}
+
+// TestSearchRange 测试查询时返回命中的区间
+func TestSearchRange(t *testing.T) {
+	for _, searchType := range []SearchType{MEMORY, BTREE} {
+		dbSearcher, err := InitDBSearcher(writeTestDB(t, false, testRanges), testDBKey, searchType)
+		if err != nil {
+			t.Fatalf("初始化数据库搜索器失败: %v", err)
+		}
+
+		result, r, err := dbSearcher.SearchRange("1.0.2.3")
+		if err != nil {
+			t.Fatalf("SearchRange 返回错误: %v", err)
+		}
+		if r.String() != "1.0.1.0-1.0.3.255" || result.String() != "中国\t福建\t福州\t电信" {
+			t.Errorf("SearchRange(1.0.2.3) = %s, %q", r, result)
+		}
+		if !r.Contains(netip.MustParseAddr("1.0.3.0")) || r.Contains(netip.MustParseAddr("1.0.4.0")) {
+			t.Errorf("%s.Contains 结果错误", r)
+		}
+
+		_, r, err = dbSearcher.SearchAddrRange(netip.MustParseAddr("::ffff:223.5.5.5"))
+		if err != nil || r.String() != "223.5.5.0-223.5.5.255" {
+			t.Errorf("SearchAddrRange(::ffff:223.5.5.5) = %s, %v", r, err)
+		}
+		CloseDBSearcher(dbSearcher)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package db
+
+import (
+	"fmt"
+	"os"
+)
+
+// mmapFile 在不支持的平台上返回错误
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return nil, fmt.Errorf("mmap search type is not supported on this platform")
+}
+
+// munmapFile 在不支持的平台上无需处理
+func munmapFile(data []byte) error {
+	return nil
+}
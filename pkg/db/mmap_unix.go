@@ -0,0 +1,22 @@
+//go:build unix
+
+package db
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmapFile 以只读方式映射整个数据库文件，映射的页缓存可在多个进程间共享
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	if size <= 0 || int64(int(size)) != size {
+		return nil, fmt.Errorf("invalid mmap size: %d", size)
+	}
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmapFile 解除文件映射
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
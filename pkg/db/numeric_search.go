@@ -0,0 +1,118 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/tagphi/czdb-search-golang/pkg/utils"
+)
+
+// SearchAddr 使用已解析的 netip.Addr 查询地理位置信息，不再解析字符串
+//
+// 参数:
+//   - addr: 要查询的IP地址，IPv4映射的IPv6地址按IPv4处理，区域标识会被忽略
+//
+// 返回:
+//   - *GeoResult: 地理位置信息
+//   - error: 如果搜索失败则返回错误，未找到时返回 ErrNotFound
+func (dbSearcher *DBSearcher) SearchAddr(addr netip.Addr) (*GeoResult, error) {
+	if !addr.IsValid() {
+		return nil, fmt.Errorf("%w: zero netip.Addr", ErrInvalidIP)
+	}
+	if addr.Is4() {
+		ip4 := addr.As4()
+		return dbSearcher.SearchBytes(ip4[:])
+	}
+	ip16 := addr.As16()
+	return dbSearcher.SearchBytes(ip16[:])
+}
+
+// SearchIP 使用 net.IP 查询地理位置信息
+//
+// 参数:
+//   - ip: 4 字节或 16 字节的IP地址
+//
+// 返回:
+//   - *GeoResult: 地理位置信息
+//   - error: 如果搜索失败则返回错误，未找到时返回 ErrNotFound
+func (dbSearcher *DBSearcher) SearchIP(ip net.IP) (*GeoResult, error) {
+	return dbSearcher.SearchBytes(ip)
+}
+
+// SearchUint32 使用主机序的 uint32 查询IPv4地址，如 0x08080808 表示 8.8.8.8
+//
+// 参数:
+//   - ip: IPv4地址的整数形式
+//
+// 返回:
+//   - *GeoResult: 地理位置信息
+//   - error: 如果搜索失败则返回错误，未找到时返回 ErrNotFound
+func (dbSearcher *DBSearcher) SearchUint32(ip uint32) (*GeoResult, error) {
+	var ipBytes [4]byte
+	binary.BigEndian.PutUint32(ipBytes[:], ip)
+	return dbSearcher.SearchBytes(ipBytes[:])
+}
+
+// SearchBytes 使用网络字节序的原始IP字节查询地理位置信息
+//
+// 参数:
+//   - ip: 4 字节IPv4地址，或 16 字节IPv6地址 (IPv4映射地址按IPv4处理)
+//
+// 返回:
+//   - *GeoResult: 地理位置信息
+//   - error: 如果搜索失败则返回错误，未找到时返回 ErrNotFound
+func (dbSearcher *DBSearcher) SearchBytes(ip []byte) (*GeoResult, error) {
+	if dbSearcher == nil {
+		return nil, fmt.Errorf("dbSearcher is nil")
+	}
+
+	ipBytes, err := dbSearcher.normalizeIPBytes(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	memoryMode, err := dbSearcher.memoryMode()
+	if err != nil {
+		return nil, err
+	}
+	return searchIPBytes(dbSearcher, ipBytes, memoryMode)
+}
+
+// normalizeIPBytes 将IP字节转换为数据库使用的长度，并检查IP版本是否与数据库一致
+//
+// 返回的字节长度总是等于 IPBytesLength，utils.CompareBytes 只比较共同前缀，依赖这一点。
+func (dbSearcher *DBSearcher) normalizeIPBytes(ip []byte) ([]byte, error) {
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return nil, fmt.Errorf("%w: unexpected IP length %d", ErrInvalidIP, len(ip))
+	}
+
+	ip4 := net.IP(ip).To4()
+	switch dbSearcher.IPType {
+	case int32(utils.IPV4):
+		if ip4 == nil {
+			return nil, fmt.Errorf("%w: expected IPv4 address but got IPv6: %s", ErrIPVersionMismatch, net.IP(ip))
+		}
+		return ip4, nil
+	case int32(utils.IPV6):
+		if ip4 != nil {
+			return nil, fmt.Errorf("%w: expected IPv6 address but got IPv4: %s", ErrIPVersionMismatch, net.IP(ip))
+		}
+		return ip, nil
+	default:
+		return nil, fmt.Errorf("unsupported IP type: %d", dbSearcher.IPType)
+	}
+}
+
+// ipToUint32 将IPv4地址字符串转换为主机序的 uint32，与 SearchUint32 的参数形式一致
+func ipToUint32(ip string) (uint32, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidIP, ip)
+	}
+	if parsedIP.To4() == nil {
+		return 0, fmt.Errorf("%w: expected IPv4 address but got IPv6: %s", ErrIPVersionMismatch, ip)
+	}
+	return utils.EncodeIP(parsedIP), nil
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+// TestNumericSearch 测试 netip.Addr、net.IP、uint32 和原始字节查询结果一致
+func TestNumericSearch(t *testing.T) {
+	dbSearcher, err := InitDBSearcher(writeTestDB(t, false, testRanges), testDBKey, BTREE)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(dbSearcher)
+
+	for _, query := range concurrentQueries {
+		addr := netip.MustParseAddr(query.ip)
+		ipUint32, err := ipToUint32(query.ip)
+		if err != nil {
+			t.Fatalf("ipToUint32(%s) 返回错误: %v", query.ip, err)
+		}
+		ip4 := addr.As4()
+
+		lookups := map[string]func() (*GeoResult, error){
+			"SearchAddr":   func() (*GeoResult, error) { return dbSearcher.SearchAddr(addr) },
+			"SearchMapped": func() (*GeoResult, error) { return dbSearcher.SearchAddr(netip.AddrFrom16(addr.As16())) },
+			"SearchIP":     func() (*GeoResult, error) { return dbSearcher.SearchIP(net.ParseIP(query.ip)) },
+			"SearchUint32": func() (*GeoResult, error) { return dbSearcher.SearchUint32(ipUint32) },
+			"SearchBytes":  func() (*GeoResult, error) { return dbSearcher.SearchBytes(ip4[:]) },
+		}
+		for name, lookup := range lookups {
+			result, err := lookup()
+			if query.expected == "" {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("%s(%s) 错误 = %v, 期望 %v", name, query.ip, err, ErrNotFound)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s(%s) 返回错误: %v", name, query.ip, err)
+			} else if result.String() != query.expected {
+				t.Errorf("%s(%s) = %q, 期望 %q", name, query.ip, result.String(), query.expected)
+			}
+		}
+	}
+
+	if _, err := dbSearcher.SearchAddr(netip.Addr{}); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("零值地址的错误 = %v, 期望 %v", err, ErrInvalidIP)
+	}
+	if _, err := dbSearcher.SearchBytes([]byte{1, 2, 3}); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("长度错误的错误 = %v, 期望 %v", err, ErrInvalidIP)
+	}
+	if _, err := dbSearcher.SearchAddr(netip.MustParseAddr("2400:3200::1")); !errors.Is(err, ErrIPVersionMismatch) {
+		t.Errorf("IPv6地址的错误 = %v, 期望 %v", err, ErrIPVersionMismatch)
+	}
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/tagphi/czdb-search-golang/pkg/utils"
+)
+
+// Options 打开数据库时的选项
+type Options struct {
+	SearchType   SearchType   // 搜索类型，MMAP 只适用于数据库文件
+	ExpiryPolicy ExpiryPolicy // 授权过期时的处理方式，默认忽略
+	Schema       []string     // 列名称，按原始列索引排列，为 nil 时使用 DefaultColumnSchema
+	Columns      []string     // 查询默认返回的列名称，覆盖文件中的 ColumnSelection，为 nil 时不覆盖
+	CacheSize    int          // 按命中区间缓存的查询结果数，区间内的任意IP都可以命中，0 表示不缓存
+}
+
+// OpenFile 使用指定选项打开数据库文件
+//
+// 参数:
+//   - dbPath: 数据库文件路径
+//   - key: 数据库解密密钥
+//   - opts: 打开选项，为 nil 时使用默认值 (MEMORY 模式)
+//
+// 返回:
+//   - *DBSearcher: 初始化后的数据库搜索器
+//   - error: 如果初始化失败则返回错误，授权过期且选项为 ExpiryRefuse 时返回 ErrExpired
+func OpenFile(dbPath string, key string, opts *Options) (*DBSearcher, error) {
+	// 打开数据库文件
+	file, err := os.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database file: %v", err)
+	}
+
+	// 获取文件大小
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to get file info: %v", err)
+	}
+	utils.Debug("Database file size: %d bytes\n", fileInfo.Size())
+
+	dbSearcher, err := newDBSearcher(file, fileInfo.Size(), key, opts)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	dbSearcher.File = file
+
+	return dbSearcher, nil
+}
+
+// OpenReader 从支持位置读取的数据源打开数据库，例如 *os.File 或 *bytes.Reader
+//
+// 搜索器不会关闭 reader，调用方需在 CloseDBSearcher 之后自行关闭。
+//
+// 参数:
+//   - reader: 数据源，需支持并发的 ReadAt
+//   - size: 数据源总大小
+//   - key: 数据库解密密钥
+//   - opts: 打开选项，为 nil 时使用默认值 (MEMORY 模式)
+//
+// 返回:
+//   - *DBSearcher: 初始化后的数据库搜索器
+//   - error: 如果初始化失败则返回错误
+func OpenReader(reader io.ReaderAt, size int64, key string, opts *Options) (*DBSearcher, error) {
+	if reader == nil {
+		return nil, fmt.Errorf("reader is nil")
+	}
+	return newDBSearcher(reader, size, key, opts)
+}
+
+// OpenBytes 从内存中的数据库内容打开数据库，例如通过 go:embed 嵌入的文件
+//
+// MEMORY 模式下直接在 data 上查找而不复制，调用方不得再修改 data。
+//
+// 参数:
+//   - data: 完整的数据库文件内容
+//   - key: 数据库解密密钥
+//   - opts: 打开选项，为 nil 时使用默认值 (MEMORY 模式)
+//
+// 返回:
+//   - *DBSearcher: 初始化后的数据库搜索器
+//   - error: 如果初始化失败则返回错误
+func OpenBytes(data []byte, key string, opts *Options) (*DBSearcher, error) {
+	dbSearcher, err := newDBSearcher(bytes.NewReader(data), int64(len(data)), key, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if dbSearcher.SearchType == MEMORY && dbSearcher.FileOffset <= int64(len(data)) {
+		dbSearcher.DBBin = data[dbSearcher.FileOffset:]
+	}
+	return dbSearcher, nil
+}
+
+// OpenFS 从文件系统接口打开数据库，例如 embed.FS 或 os.DirFS
+//
+// 文件支持 io.ReaderAt 时按需读取，否则将整个文件读入内存。
+//
+// 参数:
+//   - fsys: 文件系统
+//   - name: 数据库文件在 fsys 中的名称
+//   - key: 数据库解密密钥
+//   - opts: 打开选项，为 nil 时使用默认值 (MEMORY 模式)
+//
+// 返回:
+//   - *DBSearcher: 初始化后的数据库搜索器，CloseDBSearcher 时关闭打开的文件
+//   - error: 如果初始化失败则返回错误
+func OpenFS(fsys fs.FS, name string, key string, opts *Options) (*DBSearcher, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database file: %v", err)
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	reader, ok := file.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read database file: %v", err)
+		}
+		return OpenBytes(data, key, opts)
+	}
+
+	dbSearcher, err := newDBSearcher(reader, fileInfo.Size(), key, opts)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	dbSearcher.closer = file
+	return dbSearcher, nil
+}
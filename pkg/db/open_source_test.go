@@ -0,0 +1,71 @@
+package db
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// readOnlyFS 包装 fs.FS，使打开的文件不支持 io.ReaderAt
+type readOnlyFS struct {
+	fsys fs.FS
+}
+
+type readOnlyFile struct {
+	fs.File
+}
+
+func (r readOnlyFS) Open(name string) (fs.File, error) {
+	file, err := r.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return readOnlyFile{file}, nil
+}
+
+// TestOpenSources 测试从字节、ReaderAt 和 fs.FS 打开数据库
+func TestOpenSources(t *testing.T) {
+	data := buildTestDB(t, false, testRanges)
+	mapFS := fstest.MapFS{"data/test.czdb": &fstest.MapFile{Data: data}}
+
+	opens := map[string]func() (*DBSearcher, error){
+		"OpenBytes": func() (*DBSearcher, error) { return OpenBytes(data, testDBKey, nil) },
+		"OpenBytesBTree": func() (*DBSearcher, error) {
+			return OpenBytes(data, testDBKey, &Options{SearchType: BTREE})
+		},
+		"OpenReader": func() (*DBSearcher, error) {
+			return OpenReader(bytes.NewReader(data), int64(len(data)), testDBKey, &Options{SearchType: BTREE})
+		},
+		"OpenFS": func() (*DBSearcher, error) {
+			return OpenFS(mapFS, "data/test.czdb", testDBKey, &Options{SearchType: BTREE})
+		},
+		"OpenFSWithoutReaderAt": func() (*DBSearcher, error) {
+			return OpenFS(readOnlyFS{mapFS}, "data/test.czdb", testDBKey, nil)
+		},
+	}
+
+	for name, open := range opens {
+		dbSearcher, err := open()
+		if err != nil {
+			t.Errorf("%s 失败: %v", name, err)
+			continue
+		}
+		for _, query := range concurrentQueries {
+			if query.expected == "" {
+				continue
+			}
+			region, err := Search(query.ip, dbSearcher)
+			if err != nil {
+				t.Errorf("%s: 搜索IP %s 失败: %v", name, query.ip, err)
+			} else if region != query.expected {
+				t.Errorf("%s: Search(%s) = %q, 期望 %q", name, query.ip, region, query.expected)
+			}
+		}
+		CloseDBSearcher(dbSearcher)
+	}
+
+	if _, err := OpenBytes(data, testDBKey, &Options{SearchType: MMAP}); err == nil {
+		t.Errorf("OpenBytes 不应支持 MMAP 模式")
+	}
+}
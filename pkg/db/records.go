@@ -0,0 +1,147 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// recordIteratorBatch 是遍历时每次读取的索引块数量
+const recordIteratorBatch = 1024
+
+// Record 表示数据库中的一条记录
+type Record struct {
+	Range  IPRange    // 记录覆盖的IP区间
+	Result *GeoResult // 解码后的地理信息
+}
+
+// RecordIterator 按地址升序遍历数据库中的所有记录
+//
+// 用法:
+//
+//	it := dbSearcher.RecordIterator()
+//	for it.Next() {
+//		record := it.Record()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type RecordIterator struct {
+	dbSearcher *DBSearcher
+	memoryMode bool
+	ptr        int64  // 下一个索引块的指针
+	buf        []byte // 批量读取的索引块
+	bufStart   int64  // buf 对应的起始指针
+	index      *indexRecord
+	record     Record
+	err        error
+	done       bool
+}
+
+// RecordIterator 创建一个遍历所有记录的游标，适用于所有搜索类型
+//
+// 返回:
+//   - *RecordIterator: 记录游标
+func (dbSearcher *DBSearcher) RecordIterator() *RecordIterator {
+	it := &RecordIterator{dbSearcher: dbSearcher}
+	if dbSearcher == nil {
+		it.err = fmt.Errorf("dbSearcher is nil")
+		return it
+	}
+
+	it.memoryMode, it.err = dbSearcher.memoryMode()
+	if it.err == nil && it.memoryMode {
+		if err := dbSearcher.ensureDBBin(); err != nil {
+			it.err = fmt.Errorf("failed to load database into memory: %w", err)
+		}
+	}
+	it.ptr = int64(dbSearcher.StartIndexPtr)
+	return it
+}
+
+// Records 按地址升序对每条记录调用 fn，fn 返回 false 时提前结束
+//
+// 参数:
+//   - fn: 处理每条记录的回调函数
+//
+// 返回:
+//   - error: 如果读取或解码失败则返回错误
+func (dbSearcher *DBSearcher) Records(fn func(record Record) bool) error {
+	it := dbSearcher.RecordIterator()
+	for it.Next() {
+		if !fn(it.Record()) {
+			break
+		}
+	}
+	return it.Err()
+}
+
+// Next 前进到下一条记录，没有更多记录或发生错误时返回 false
+func (it *RecordIterator) Next() bool {
+	if it.err != nil || it.done {
+		return false
+	}
+
+	dbSearcher := it.dbSearcher
+	if err := dbSearcher.acquire(); err != nil {
+		it.err = err
+		return false
+	}
+	defer dbSearcher.release()
+
+	blen := int64(dbSearcher.IndexLength)
+	endIndexPtr := int64(dbSearcher.EndIndexPtr)
+	if it.ptr > endIndexPtr || blen <= 0 {
+		it.done = true
+		return false
+	}
+
+	// 当前索引块不在缓冲区中时批量读取
+	if it.ptr < it.bufStart || it.ptr+blen > it.bufStart+int64(len(it.buf)) {
+		count := (endIndexPtr-it.ptr)/blen + 1
+		if count > recordIteratorBatch {
+			count = recordIteratorBatch
+		}
+		buf, err := dbSearcher.readDBBytes(it.ptr, int(count*blen), it.memoryMode)
+		if err != nil {
+			it.err = newCorruptError(SectionIndex, dbSearcher.FileOffset+it.ptr, "failed to read index blocks: %v", err)
+			return false
+		}
+		it.buf, it.bufStart = buf, it.ptr
+	}
+
+	offset := it.ptr - it.bufStart
+	block := it.buf[offset : offset+blen]
+	ipLen := dbSearcher.IPBytesLength
+	index := &indexRecord{
+		StartIP: append([]byte(nil), block[:ipLen]...),
+		EndIP:   append([]byte(nil), block[ipLen:ipLen*2]...),
+		DataPtr: binary.LittleEndian.Uint32(block[ipLen*2:]),
+		DataLen: block[ipLen*2+4],
+	}
+	if index.DataPtr == 0 || index.DataLen == 0 {
+		it.err = newCorruptError(SectionIndex, dbSearcher.FileOffset+it.ptr, "invalid data pointer or length: ptr=%d, len=%d", index.DataPtr, index.DataLen)
+		return false
+	}
+
+	result, err := decodeIndexRecord(dbSearcher, index, it.memoryMode)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.index = index
+	it.record = Record{Range: index.ipRange(), Result: result}
+	it.ptr += blen
+	return true
+}
+
+// Record 返回当前记录，仅在 Next 返回 true 后有效
+func (it *RecordIterator) Record() Record {
+	return it.record
+}
+
+// Err 返回遍历过程中遇到的错误，正常结束时返回 nil
+func (it *RecordIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestRecords 测试按地址升序遍历所有记录
+func TestRecords(t *testing.T) {
+	for _, ipv6 := range []bool{false, true} {
+		ranges := testRanges
+		if ipv6 {
+			ranges = testRangesV6
+		}
+		path := writeTestDB(t, ipv6, ranges)
+
+		for _, searchType := range []SearchType{MEMORY, BTREE, MMAP} {
+			dbSearcher, err := InitDBSearcher(path, testDBKey, searchType)
+			if err != nil {
+				t.Fatalf("初始化数据库搜索器失败: %v", err)
+			}
+
+			var records []Record
+			err = dbSearcher.Records(func(record Record) bool {
+				records = append(records, record)
+				return true
+			})
+			if err != nil {
+				t.Fatalf("[%s] 遍历失败: %v", searchTypeToString(searchType), err)
+			}
+			if len(records) != len(ranges) {
+				t.Fatalf("[%s] 记录数 = %d, 期望 %d", searchTypeToString(searchType), len(records), len(ranges))
+			}
+			for i, record := range records {
+				r := ranges[i]
+				if record.Range.Start.String() != r.start || record.Range.End.String() != r.end {
+					t.Errorf("记录 %d 区间 = %s, 期望 %s-%s", i, record.Range, r.start, r.end)
+				}
+				if record.Result.OtherData != r.other || record.Result.Columns[0] != r.columns[0] {
+					t.Errorf("记录 %d 结果 = %q", i, record.Result)
+				}
+			}
+			CloseDBSearcher(dbSearcher)
+		}
+	}
+}
+
+// TestRecordIteratorEarlyStop 测试提前结束遍历及关闭后的错误
+func TestRecordIteratorEarlyStop(t *testing.T) {
+	dbSearcher, err := InitDBSearcher(writeTestDB(t, false, testRanges), testDBKey, BTREE)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+
+	count := 0
+	err = dbSearcher.Records(func(record Record) bool {
+		count++
+		return count < 3
+	})
+	if err != nil || count != 3 {
+		t.Errorf("提前结束: count = %d, err = %v, 期望 3, nil", count, err)
+	}
+
+	it := dbSearcher.RecordIterator()
+	if !it.Next() || it.Record().Range.Start.String() != "1.0.0.0" {
+		t.Fatalf("游标第一条记录错误: %v", it.Err())
+	}
+	CloseDBSearcher(dbSearcher)
+	if it.Next() || !errors.Is(it.Err(), ErrClosed) {
+		t.Errorf("关闭后游标错误 = %v, 期望 %v", it.Err(), ErrClosed)
+	}
+}
+
+// TestRecordsManyBatches 测试记录数超过单次读取数量时的遍历
+func TestRecordsManyBatches(t *testing.T) {
+	var ranges []testRange
+	for i := 0; i < recordIteratorBatch*2+10; i++ {
+		ip := fmt.Sprintf("10.%d.%d.", i/256, i%256)
+		ranges = append(ranges, testRange{ip + "0", ip + "255", []string{"局域网", "", ""}, fmt.Sprint(i)})
+	}
+
+	dbSearcher, err := InitDBSearcher(writeTestDB(t, false, ranges), testDBKey, BTREE)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer CloseDBSearcher(dbSearcher)
+
+	i := 0
+	err = dbSearcher.Records(func(record Record) bool {
+		if record.Range.Start.String() != ranges[i].start || record.Result.OtherData != ranges[i].other {
+			t.Errorf("记录 %d = %s %q, 期望 %s %q", i, record.Range, record.Result.OtherData, ranges[i].start, ranges[i].other)
+		}
+		i++
+		return true
+	})
+	if err != nil || i != len(ranges) {
+		t.Errorf("遍历 %d 条记录, err = %v, 期望 %d", i, err, len(ranges))
+	}
+}
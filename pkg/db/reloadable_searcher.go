@@ -0,0 +1,360 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tagphi/czdb-search-golang/pkg/utils"
+)
+
+// ReloadableSearcher 包装一个 DBSearcher，支持在不中断查询的情况下热加载新的数据库文件
+//
+// 新数据库在后台初始化并校验通过后原子替换旧的搜索器，旧搜索器等待所有进行中的查询
+// 结束后才会关闭。MMAP 模式下请通过重命名替换数据库文件，而不是原地覆盖正在映射的文件。
+type ReloadableSearcher struct {
+	Key        string     // 数据库解密密钥
+	SearchType SearchType // 搜索类型
+
+	// OnReload 在每次重新加载后调用 (可选)，err 为 nil 表示加载成功
+	OnReload func(path string, err error)
+
+	current  atomic.Pointer[searcherRef]
+	reloadMu sync.Mutex // 保证同一时间只有一个重新加载
+	path     string     // 当前数据库文件路径，受 reloadMu 保护
+	options  Options    // 打开选项，SearchType 以同名字段为准
+}
+
+// searcherRef 记录一个搜索器及其进行中的查询
+type searcherRef struct {
+	searcher *DBSearcher
+	inFlight sync.RWMutex // 查询持有读锁，关闭时获取写锁等待查询结束
+	closed   bool         // 受 inFlight 保护
+	fileStat os.FileInfo  // 加载时的文件信息，用于检测变化
+}
+
+// NewReloadableSearcher 打开数据库并创建可热加载的搜索器
+//
+// 参数:
+//   - dbPath: 数据库文件路径
+//   - key: 数据库解密密钥
+//   - searchType: 搜索类型
+//
+// 返回:
+//   - *ReloadableSearcher: 可热加载的搜索器
+//   - error: 如果初始化失败则返回错误
+func NewReloadableSearcher(dbPath string, key string, searchType SearchType) (*ReloadableSearcher, error) {
+	return OpenReloadable(dbPath, key, &Options{SearchType: searchType})
+}
+
+// OpenReloadable 使用指定选项打开数据库并创建可热加载的搜索器，每次重新加载都使用相同的选项
+//
+// 启用 Options.CacheSize 时，每个数据库版本使用各自的缓存，重新加载后缓存从空开始。
+//
+// 参数:
+//   - dbPath: 数据库文件路径
+//   - key: 数据库解密密钥
+//   - opts: 打开选项，为 nil 时使用默认值 (MEMORY 模式)
+//
+// 返回:
+//   - *ReloadableSearcher: 可热加载的搜索器
+//   - error: 如果初始化失败则返回错误
+func OpenReloadable(dbPath string, key string, opts *Options) (*ReloadableSearcher, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	reloadable := &ReloadableSearcher{
+		Key:        key,
+		SearchType: opts.SearchType,
+		path:       dbPath,
+		options:    *opts,
+	}
+
+	ref, err := reloadable.open(dbPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	reloadable.current.Store(ref)
+	return reloadable, nil
+}
+
+// open 初始化并校验新的搜索器
+func (reloadable *ReloadableSearcher) open(dbPath string, previous *DBSearcher) (*searcherRef, error) {
+	fileStat, err := os.Stat(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat database file: %v", err)
+	}
+
+	opts := reloadable.options
+	opts.SearchType = reloadable.SearchType
+	searcher, err := OpenFile(dbPath, reloadable.Key, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSearcher(searcher, previous); err != nil {
+		CloseDBSearcher(searcher)
+		return nil, err
+	}
+
+	return &searcherRef{searcher: searcher, fileStat: fileStat}, nil
+}
+
+// checkSearcher 在替换前检查新搜索器可以正常查询，且IP类型与旧搜索器一致
+func checkSearcher(searcher *DBSearcher, previous *DBSearcher) error {
+	if previous != nil && previous.IPType != searcher.IPType {
+		return fmt.Errorf("%w: new database is IPv%d, current is IPv%d", ErrIPVersionMismatch, searcher.IPType, previous.IPType)
+	}
+
+	param := searcher.BtreeModeParam
+	if param == nil || param.HeaderLength == 0 {
+		return newCorruptError(SectionHeaderBlock, searcher.FileOffset+SuperPartLength, "empty HeaderBlock")
+	}
+
+	memoryMode, err := searcher.memoryMode()
+	if err != nil {
+		return err
+	}
+
+	// 查询第一个和最后一个头部行的起始IP，确保索引和数据记录可以解码；
+	// 绕过查询结果缓存，自检不影响缓存的内容和统计信息
+	for _, sip := range [][]byte{param.HeaderSip[0], param.HeaderSip[param.HeaderLength-1]} {
+		record, err := searchIndexRecord(searcher, sip[:searcher.IPBytesLength], memoryMode)
+		if err == nil {
+			_, err = decodeIndexRecord(searcher, record, memoryMode)
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("database self-check failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// acquire 获取当前搜索器，调用方必须在查询结束后调用 release
+func (reloadable *ReloadableSearcher) acquire() (*searcherRef, error) {
+	for {
+		ref := reloadable.current.Load()
+		if ref == nil {
+			return nil, ErrClosed
+		}
+		ref.inFlight.RLock()
+		if !ref.closed {
+			return ref, nil
+		}
+		// 取到了已被替换并关闭的搜索器，重新读取当前搜索器
+		ref.inFlight.RUnlock()
+	}
+}
+
+// release 结束一次查询
+func (ref *searcherRef) release() {
+	ref.inFlight.RUnlock()
+}
+
+// close 等待进行中的查询结束后关闭搜索器
+func (ref *searcherRef) close() {
+	ref.inFlight.Lock()
+	defer ref.inFlight.Unlock()
+	if !ref.closed {
+		ref.closed = true
+		CloseDBSearcher(ref.searcher)
+	}
+}
+
+// Do 使用当前搜索器执行 fn，执行期间该搜索器不会被关闭
+//
+// 参数:
+//   - fn: 使用搜索器的函数，不得在返回后继续持有该搜索器
+//
+// 返回:
+//   - error: fn 返回的错误，搜索器已关闭时返回 ErrClosed
+func (reloadable *ReloadableSearcher) Do(fn func(searcher *DBSearcher) error) error {
+	ref, err := reloadable.acquire()
+	if err != nil {
+		return err
+	}
+	defer ref.release()
+	return fn(ref.searcher)
+}
+
+// Search 搜索IP地址对应的地理位置信息，返回格式与 db.Search 相同
+func (reloadable *ReloadableSearcher) Search(ip string) (string, error) {
+	var region string
+	err := reloadable.Do(func(searcher *DBSearcher) error {
+		var err error
+		region, err = Search(ip, searcher)
+		return err
+	})
+	return region, err
+}
+
+// SearchResult 搜索IP地址对应的结构化地理位置信息
+func (reloadable *ReloadableSearcher) SearchResult(ip string) (*GeoResult, error) {
+	var result *GeoResult
+	err := reloadable.Do(func(searcher *DBSearcher) error {
+		var err error
+		result, err = searcher.SearchResult(ip)
+		return err
+	})
+	return result, err
+}
+
+// SearchAddr 使用 netip.Addr 查询地理位置信息
+func (reloadable *ReloadableSearcher) SearchAddr(addr netip.Addr) (*GeoResult, error) {
+	var result *GeoResult
+	err := reloadable.Do(func(searcher *DBSearcher) error {
+		var err error
+		result, err = searcher.SearchAddr(addr)
+		return err
+	})
+	return result, err
+}
+
+// SearchBatch 使用当前搜索器批量查询，整批查询使用同一个数据库版本
+func (reloadable *ReloadableSearcher) SearchBatch(ips []netip.Addr) ([]GeoResult, []error) {
+	var results []GeoResult
+	var errs []error
+	err := reloadable.Do(func(searcher *DBSearcher) error {
+		results, errs = searcher.SearchBatch(ips)
+		return nil
+	})
+	if err != nil {
+		results, errs = make([]GeoResult, len(ips)), make([]error, len(ips))
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return results, errs
+}
+
+// CacheStats 返回当前数据库版本的缓存统计信息，重新加载后从零开始
+func (reloadable *ReloadableSearcher) CacheStats() CacheStats {
+	var stats CacheStats
+	reloadable.Do(func(searcher *DBSearcher) error {
+		stats = searcher.CacheStats()
+		return nil
+	})
+	return stats
+}
+
+// Info 打印当前数据库信息
+func (reloadable *ReloadableSearcher) Info() {
+	reloadable.Do(func(searcher *DBSearcher) error {
+		Info(searcher)
+		return nil
+	})
+}
+
+// Path 返回当前数据库文件路径
+func (reloadable *ReloadableSearcher) Path() string {
+	reloadable.reloadMu.Lock()
+	defer reloadable.reloadMu.Unlock()
+	return reloadable.path
+}
+
+// Reload 从当前路径重新加载数据库
+func (reloadable *ReloadableSearcher) Reload() error {
+	return reloadable.ReloadFrom("")
+}
+
+// ReloadFrom 从指定路径加载新数据库，校验通过后替换当前搜索器
+//
+// 参数:
+//   - dbPath: 新数据库文件路径，为空时使用当前路径
+//
+// 返回:
+//   - error: 如果新数据库加载或校验失败则返回错误，此时继续使用旧数据库
+func (reloadable *ReloadableSearcher) ReloadFrom(dbPath string) error {
+	reloadable.reloadMu.Lock()
+	defer reloadable.reloadMu.Unlock()
+
+	if dbPath == "" {
+		dbPath = reloadable.path
+	}
+
+	old := reloadable.current.Load()
+	if old == nil {
+		return ErrClosed
+	}
+
+	ref, err := reloadable.open(dbPath, old.searcher)
+	if err == nil {
+		reloadable.current.Store(ref)
+		reloadable.path = dbPath
+		// 在后台等待旧搜索器上的查询结束后关闭
+		go old.close()
+		utils.Debug("Debug: Reloaded database from %s\n", dbPath)
+	}
+
+	if reloadable.OnReload != nil {
+		reloadable.OnReload(dbPath, err)
+	}
+	return err
+}
+
+// WatchFile 定期检查数据库文件的修改时间和大小，发生变化时自动重新加载
+//
+// 参数:
+//   - interval: 检查间隔
+//
+// 返回:
+//   - func(): 停止检查的函数
+func (reloadable *ReloadableSearcher) WatchFile(interval time.Duration) func() {
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// 加载失败的文件信息，文件再次变化之前不重复尝试
+		var failedStat os.FileInfo
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			ref := reloadable.current.Load()
+			if ref == nil {
+				return
+			}
+			fileStat, err := os.Stat(reloadable.Path())
+			if err != nil || sameFileStat(fileStat, ref.fileStat) || sameFileStat(fileStat, failedStat) {
+				continue
+			}
+
+			if err := reloadable.Reload(); err != nil {
+				utils.Warning("failed to reload database: %v\n", err)
+				failedStat = fileStat
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// sameFileStat 判断两次文件信息的修改时间和大小是否相同
+func sameFileStat(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// Close 等待进行中的查询结束后关闭当前搜索器，之后的查询返回 ErrClosed
+func (reloadable *ReloadableSearcher) Close() {
+	reloadable.reloadMu.Lock()
+	defer reloadable.reloadMu.Unlock()
+
+	if ref := reloadable.current.Swap(nil); ref != nil {
+		ref.close()
+	}
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 第二个版本的测试数据：修改了 8.8.8.0/24 的信息
+var testRangesUpdated = []testRange{
+	{"1.0.0.0", "1.0.0.255", []string{"澳大利亚", "", ""}, "APNIC"},
+	{"8.8.8.0", "8.8.8.255", []string{"美国", "加利福尼亚", ""}, "Google LLC"},
+	{"223.5.5.0", "223.5.5.255", []string{"中国", "浙江", "杭州"}, "阿里云"},
+}
+
+// TestReloadableSearcher 测试在并发查询期间热加载新数据库
+func TestReloadableSearcher(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.czdb")
+	newPath := filepath.Join(dir, "new.czdb")
+	if err := os.WriteFile(oldPath, buildTestDB(t, false, testRanges), 0644); err != nil {
+		t.Fatalf("写入测试数据库失败: %v", err)
+	}
+	if err := os.WriteFile(newPath, buildTestDB(t, false, testRangesUpdated), 0644); err != nil {
+		t.Fatalf("写入测试数据库失败: %v", err)
+	}
+
+	for _, searchType := range []SearchType{MEMORY, BTREE, MMAP} {
+		t.Run(searchTypeToString(searchType), func(t *testing.T) {
+			reloadable, err := NewReloadableSearcher(oldPath, testDBKey, searchType)
+			if err != nil {
+				t.Fatalf("初始化可热加载搜索器失败: %v", err)
+			}
+			defer reloadable.Close()
+
+			var reloads int32
+			reloadable.OnReload = func(path string, err error) {
+				if err == nil {
+					atomic.AddInt32(&reloads, 1)
+				}
+			}
+
+			// 热加载期间持续查询，结果只能是新旧两个版本之一
+			var wg sync.WaitGroup
+			stop := make(chan struct{})
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						region, err := reloadable.Search("8.8.8.8")
+						if err != nil {
+							t.Errorf("热加载期间查询失败: %v", err)
+							return
+						}
+						if region != "美国\tnull\tnull\tGoogle" && region != "美国\t加利福尼亚\tnull\tGoogle LLC" {
+							t.Errorf("热加载期间查询结果异常: %q", region)
+							return
+						}
+					}
+				}()
+			}
+
+			for i := 0; i < 5; i++ {
+				path := newPath
+				if i%2 == 1 {
+					path = oldPath
+				}
+				if err := reloadable.ReloadFrom(path); err != nil {
+					t.Errorf("热加载失败: %v", err)
+				}
+			}
+			close(stop)
+			wg.Wait()
+
+			if reloads != 5 {
+				t.Errorf("成功热加载次数 = %d, 期望 5", reloads)
+			}
+			region, err := reloadable.Search("8.8.8.8")
+			if err != nil || region != "美国\t加利福尼亚\tnull\tGoogle LLC" {
+				t.Errorf("热加载后 Search = %q, %v", region, err)
+			}
+			if reloadable.Path() != newPath {
+				t.Errorf("Path() = %s, 期望 %s", reloadable.Path(), newPath)
+			}
+		})
+	}
+}
+
+// TestReloadableSearcherRejectsBadFile 测试加载失败时继续使用旧数据库
+func TestReloadableSearcherRejectsBadFile(t *testing.T) {
+	reloadable, err := NewReloadableSearcher(writeTestDB(t, false, testRanges), testDBKey, BTREE)
+	if err != nil {
+		t.Fatalf("初始化可热加载搜索器失败: %v", err)
+	}
+
+	// IP类型不一致
+	if err := reloadable.ReloadFrom(writeTestDB(t, true, testRangesV6)); !errors.Is(err, ErrIPVersionMismatch) {
+		t.Errorf("加载IPv6数据库的错误 = %v, 期望 %v", err, ErrIPVersionMismatch)
+	}
+
+	// 文件被截断
+	data := buildTestDB(t, false, testRanges)
+	truncated := filepath.Join(t.TempDir(), "truncated.czdb")
+	if err := os.WriteFile(truncated, data[:len(data)/2], 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	if err := reloadable.ReloadFrom(truncated); err == nil {
+		t.Errorf("加载截断的数据库应该失败")
+	}
+
+	if region, err := reloadable.Search("8.8.8.8"); err != nil || region != "美国\tnull\tnull\tGoogle" {
+		t.Errorf("加载失败后 Search = %q, %v", region, err)
+	}
+
+	reloadable.Close()
+	if _, err := reloadable.Search("8.8.8.8"); !errors.Is(err, ErrClosed) {
+		t.Errorf("关闭后查询错误 = %v, 期望 %v", err, ErrClosed)
+	}
+}
+
+// TestReloadableSearcherWatchFile 测试文件变化时自动重新加载
+func TestReloadableSearcherWatchFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "watched.czdb")
+	if err := os.WriteFile(path, buildTestDB(t, false, testRanges), 0644); err != nil {
+		t.Fatalf("写入测试数据库失败: %v", err)
+	}
+
+	reloadable, err := NewReloadableSearcher(path, testDBKey, MMAP)
+	if err != nil {
+		t.Fatalf("初始化可热加载搜索器失败: %v", err)
+	}
+	defer reloadable.Close()
+
+	reloaded := make(chan error, 1)
+	reloadable.OnReload = func(path string, err error) {
+		reloaded <- err
+	}
+	stop := reloadable.WatchFile(10 * time.Millisecond)
+	defer stop()
+
+	// 通过重命名替换文件
+	tmp := filepath.Join(dir, "watched.czdb.tmp")
+	if err := os.WriteFile(tmp, buildTestDB(t, false, testRangesUpdated), 0644); err != nil {
+		t.Fatalf("写入测试数据库失败: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("替换测试数据库失败: %v", err)
+	}
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatalf("自动重新加载失败: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待自动重新加载超时")
+	}
+
+	if region, err := reloadable.Search("8.8.8.8"); err != nil || region != "美国\t加利福尼亚\tnull\tGoogle LLC" {
+		t.Errorf("自动重新加载后 Search = %q, %v", region, err)
+	}
+}
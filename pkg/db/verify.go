@@ -0,0 +1,339 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// maxVerifyIssues 是校验报告中保留的最大问题数，超出的问题只计数
+const maxVerifyIssues = 1000
+
+// VerifyIssue 描述校验发现的一个问题
+type VerifyIssue struct {
+	Section string `json:"section"` // 问题所在的区段，取值同 CorruptDatabaseError.Section
+	Offset  int64  `json:"offset"`  // 问题所在的文件偏移量
+	Record  int    `json:"record"`  // 索引记录的序号，与索引记录无关时为 -1
+	Message string `json:"message"` // 问题描述
+}
+
+// VerifyReport 是数据库完整性校验的结果
+type VerifyReport struct {
+	FileSize      int64         `json:"file_size"`      // 文件实际大小
+	DbSize        int64         `json:"db_size"`        // SuperBlock 中记录的数据库大小
+	IPVersion     int           `json:"ip_version"`     // 4 或 6
+	HeaderEntries int           `json:"header_entries"` // 头部块条目数
+	IndexRecords  int           `json:"index_records"`  // 已检查的索引记录数
+	GeoMapSize    int           `json:"geo_map_size"`   // 地理映射大小
+	IssueCount    int           `json:"issue_count"`    // 发现的问题总数
+	Issues        []VerifyIssue `json:"issues"`         // 问题列表，最多保留 1000 个
+}
+
+// OK 判断校验是否没有发现问题
+func (report *VerifyReport) OK() bool {
+	return report.IssueCount == 0
+}
+
+// addIssue 记录一个问题
+func (report *VerifyReport) addIssue(section string, offset int64, record int, format string, args ...interface{}) {
+	report.IssueCount++
+	if len(report.Issues) < maxVerifyIssues {
+		report.Issues = append(report.Issues, VerifyIssue{
+			Section: section,
+			Offset:  offset,
+			Record:  record,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+}
+
+// VerifyFile 打开数据库文件并校验其完整性
+//
+// 文件在初始化阶段就无法解析时 (如 SuperBlock 被截断)，报告中只包含该问题。
+//
+// 参数:
+//   - dbPath: 数据库文件路径
+//   - key: 数据库解密密钥
+//
+// 返回:
+//   - *VerifyReport: 校验报告
+//   - error: 如果文件无法打开或密钥错误则返回错误
+func VerifyFile(dbPath string, key string) (*VerifyReport, error) {
+	dbSearcher, err := InitDBSearcher(dbPath, key, BTREE)
+	if err != nil {
+		var corrupt *CorruptDatabaseError
+		if !errors.As(err, &corrupt) || errors.Is(err, ErrWrongKey) {
+			return nil, err
+		}
+		report := &VerifyReport{Issues: []VerifyIssue{}}
+		report.addIssue(corrupt.Section, corrupt.Offset, -1, "%v", corrupt.Err)
+		return report, nil
+	}
+	defer CloseDBSearcher(dbSearcher)
+	return dbSearcher.Verify()
+}
+
+// Verify 校验数据库的完整性，检查所有问题而不是在第一个问题处停止
+//
+// 检查内容：SuperBlock 中的数据库大小与实际大小一致；头部块的起始IP严格递增且指针有效；
+// 索引记录的区间有序且互不重叠；每个数据记录和地理映射指针都在范围内；每条 msgpack
+// 记录都可以解码。
+//
+// 返回:
+//   - *VerifyReport: 校验报告
+//   - error: 如果搜索器已关闭或无法读取则返回错误
+func (dbSearcher *DBSearcher) Verify() (*VerifyReport, error) {
+	if dbSearcher == nil {
+		return nil, fmt.Errorf("dbSearcher is nil")
+	}
+	if err := dbSearcher.acquire(); err != nil {
+		return nil, err
+	}
+	defer dbSearcher.release()
+	memoryMode, err := dbSearcher.memoryMode()
+	if err != nil {
+		return nil, err
+	}
+	if memoryMode {
+		if err := dbSearcher.ensureDBBin(); err != nil {
+			// 文件被截断时无法完整载入内存，改为按需读取
+			memoryMode = false
+		}
+	}
+
+	v := &verifier{
+		dbSearcher: dbSearcher,
+		memoryMode: memoryMode,
+		bodySize:   dbSearcher.FileSize - dbSearcher.FileOffset,
+		report: &VerifyReport{
+			FileSize:   dbSearcher.FileSize,
+			IPVersion:  int(dbSearcher.IPType),
+			GeoMapSize: len(dbSearcher.GeoMapData),
+			Issues:     []VerifyIssue{},
+		},
+		geoChecked: map[uint64]bool{},
+	}
+	if dbSearcher.SuperBlock != nil {
+		v.report.DbSize = int64(dbSearcher.SuperBlock.DbSize)
+	}
+
+	v.verifyLayout()
+	v.verifyHeaderBlock()
+	v.verifyGeoMap()
+	v.verifyIndex()
+	return v.report, nil
+}
+
+// verifier 保存一次校验的状态，所有偏移量相对于 SuperBlock 起始位置
+type verifier struct {
+	dbSearcher *DBSearcher
+	memoryMode bool
+	bodySize   int64
+	report     *VerifyReport
+	geoChecked map[uint64]bool // 已检查过的地理映射指针
+	indexValid bool            // 索引范围是否有效
+}
+
+// issue 记录一个问题，offset 相对于 SuperBlock 起始位置
+func (v *verifier) issue(section string, offset int64, record int, format string, args ...interface{}) {
+	v.report.addIssue(section, v.dbSearcher.FileOffset+offset, record, format, args...)
+}
+
+// verifyLayout 检查 SuperBlock 中的大小和指针
+func (v *verifier) verifyLayout() {
+	dbSearcher := v.dbSearcher
+	if v.report.DbSize != v.bodySize {
+		v.issue(SectionSuperBlock, 1, -1, "db size mismatch: SuperBlock records %d bytes, file has %d", v.report.DbSize, v.bodySize)
+	}
+
+	headerEnd := int64(SuperPartLength) + int64(dbSearcher.HeaderBlockSize)
+	if dbSearcher.HeaderBlockSize%HeaderBlockLength != 0 {
+		v.issue(SectionSuperBlock, 9, -1, "HeaderBlockSize %d is not a multiple of %d", dbSearcher.HeaderBlockSize, HeaderBlockLength)
+	}
+	if headerEnd > v.bodySize {
+		v.issue(SectionSuperBlock, 9, -1, "HeaderBlock ends at %d, beyond end of file at %d", headerEnd, v.bodySize)
+	}
+
+	start, end, blen := int64(dbSearcher.StartIndexPtr), int64(dbSearcher.EndIndexPtr), int64(dbSearcher.IndexLength)
+	switch {
+	case start < headerEnd:
+		v.issue(SectionSuperBlock, 5, -1, "StartIndexPtr %d points into the HeaderBlock ending at %d", start, headerEnd)
+	case end < start:
+		v.issue(SectionSuperBlock, 13, -1, "EndIndexPtr %d is before StartIndexPtr %d", end, start)
+	case (end-start)%blen != 0:
+		v.issue(SectionSuperBlock, 13, -1, "index range %d-%d is not a multiple of the index length %d", start, end, blen)
+	default:
+		v.indexValid = true
+	}
+	if end+blen > v.bodySize {
+		v.issue(SectionIndex, end, -1, "last index record ends at %d, beyond end of file at %d", end+blen, v.bodySize)
+	}
+}
+
+// verifyHeaderBlock 检查头部块的起始IP严格递增，且指针指向对应的索引记录
+func (v *verifier) verifyHeaderBlock() {
+	dbSearcher := v.dbSearcher
+	param := dbSearcher.BtreeModeParam
+	if param == nil || param.HeaderLength == 0 {
+		v.issue(SectionHeaderBlock, SuperPartLength, -1, "HeaderBlock has no entries")
+		return
+	}
+	v.report.HeaderEntries = param.HeaderLength
+
+	ipLen := dbSearcher.IPBytesLength
+	start, end, blen := dbSearcher.StartIndexPtr, dbSearcher.EndIndexPtr, dbSearcher.IndexLength
+	for i := 0; i < param.HeaderLength; i++ {
+		offset := int64(SuperPartLength + i*HeaderBlockLength)
+		if i > 0 && bytes.Compare(param.HeaderSip[i-1][:ipLen], param.HeaderSip[i][:ipLen]) >= 0 {
+			v.issue(SectionHeaderBlock, offset, -1, "header entry %d start IP %s is not greater than the previous entry", i, formatIPBytes(param.HeaderSip[i][:ipLen]))
+		}
+
+		ptr := param.HeaderPtr[i]
+		if ptr < start || ptr > end || (ptr-start)%blen != 0 {
+			v.issue(SectionHeaderBlock, offset+16, -1, "header entry %d points to %d, not an index record in %d-%d", i, ptr, start, end)
+			continue
+		}
+		if i > 0 && ptr < param.HeaderPtr[i-1] {
+			v.issue(SectionHeaderBlock, offset+16, -1, "header entry %d pointer %d is before the previous entry", i, ptr)
+		}
+
+		// 头部行的起始IP应与其指向的索引记录的起始IP一致
+		indexStart, err := v.dbSearcher.readDBBytes(int64(ptr), ipLen, v.memoryMode)
+		if err != nil {
+			continue // 超出文件的索引记录在 verifyLayout 中报告
+		}
+		if !bytes.Equal(indexStart, param.HeaderSip[i][:ipLen]) {
+			v.issue(SectionHeaderBlock, offset, -1, "header entry %d start IP %s differs from index record start IP %s", i, formatIPBytes(param.HeaderSip[i][:ipLen]), formatIPBytes(indexStart))
+		}
+	}
+}
+
+// verifyGeoMap 检查设置了列选择时地理映射存在且没有被截断
+func (v *verifier) verifyGeoMap() {
+	dbSearcher := v.dbSearcher
+	if dbSearcher.ColumnSelection == 0 {
+		return
+	}
+
+	sizeBytes := make([]byte, 4)
+	if _, err := dbSearcher.ReaderAt.ReadAt(sizeBytes, dbSearcher.geoMapOffset-4); err != nil {
+		v.report.addIssue(SectionGeoMap, dbSearcher.geoMapOffset-4, -1, "failed to read geo map size: %v", err)
+		return
+	}
+	declared := int64(int32(binary.LittleEndian.Uint32(sizeBytes)))
+	if declared <= 0 {
+		v.report.addIssue(SectionGeoMap, dbSearcher.geoMapOffset-4, -1, "column selection is set but the geo map is missing (declared size %d)", declared)
+		return
+	}
+	if end := dbSearcher.geoMapOffset + declared; end > dbSearcher.FileSize {
+		v.report.addIssue(SectionGeoMap, dbSearcher.geoMapOffset, -1, "geo map of %d bytes ends at %d, beyond end of file at %d", declared, end, dbSearcher.FileSize)
+	}
+}
+
+// verifyIndex 依次检查每条索引记录及其数据记录
+func (v *verifier) verifyIndex() {
+	dbSearcher := v.dbSearcher
+	if !v.indexValid {
+		return
+	}
+
+	ipLen := dbSearcher.IPBytesLength
+	blen := int64(dbSearcher.IndexLength)
+	ptr := int64(dbSearcher.StartIndexPtr)
+	end := int64(dbSearcher.EndIndexPtr)
+	if last := v.bodySize - blen; last < end {
+		// 只检查文件中完整存在的索引记录
+		if last < ptr {
+			return
+		}
+		end = ptr + (last-ptr)/blen*blen
+	}
+
+	var previousEnd []byte
+	for record := 0; ptr <= end; {
+		count := (end-ptr)/blen + 1
+		if count > recordIteratorBatch {
+			count = recordIteratorBatch
+		}
+		buf, err := dbSearcher.readDBBytes(ptr, int(count*blen), v.memoryMode)
+		if err != nil {
+			v.issue(SectionIndex, ptr, record, "failed to read index records: %v", err)
+			return
+		}
+
+		for offset := int64(0); offset < int64(len(buf)); offset, ptr, record = offset+blen, ptr+blen, record+1 {
+			block := buf[offset : offset+blen]
+			startIP, endIP := block[:ipLen], block[ipLen:ipLen*2]
+			if bytes.Compare(startIP, endIP) > 0 {
+				v.issue(SectionIndex, ptr, record, "start IP %s is greater than end IP %s", formatIPBytes(startIP), formatIPBytes(endIP))
+			}
+			if previousEnd != nil && bytes.Compare(previousEnd, startIP) >= 0 {
+				v.issue(SectionIndex, ptr, record, "range %s-%s is not sorted after or overlaps the previous range ending at %s", formatIPBytes(startIP), formatIPBytes(endIP), formatIPBytes(previousEnd))
+			}
+			previousEnd = append(previousEnd[:0], endIP...)
+
+			v.verifyDataRecord(ptr, record, binary.LittleEndian.Uint32(block[ipLen*2:]), block[ipLen*2+4])
+			v.report.IndexRecords++
+		}
+	}
+}
+
+// verifyDataRecord 检查数据记录在范围内、可以解码，且地理映射指针有效
+func (v *verifier) verifyDataRecord(indexPtr int64, record int, dataPtr uint32, dataLen uint8) {
+	dbSearcher := v.dbSearcher
+	if dataPtr == 0 || dataLen == 0 {
+		v.issue(SectionIndex, indexPtr, record, "invalid data pointer or length: ptr=%d, len=%d", dataPtr, dataLen)
+		return
+	}
+	if dataEnd := int64(dataPtr) + int64(dataLen); int64(dataPtr) < SuperPartLength || dataEnd > v.bodySize {
+		v.issue(SectionIndex, indexPtr, record, "data record %d+%d is out of bounds [%d, %d)", dataPtr, dataLen, SuperPartLength, v.bodySize)
+		return
+	}
+
+	data, err := dbSearcher.readDBBytes(int64(dataPtr), int(dataLen), v.memoryMode)
+	if err != nil {
+		v.issue(SectionData, int64(dataPtr), record, "failed to read data record: %v", err)
+		return
+	}
+
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	geoPosMixSize, err := dec.DecodeUint64()
+	if err != nil {
+		v.issue(SectionData, int64(dataPtr), record, "failed to decode geoPosMixSize: %v", err)
+		return
+	}
+	if _, err := dec.DecodeString(); err != nil {
+		v.issue(SectionData, int64(dataPtr), record, "failed to decode otherData: %v", err)
+		return
+	}
+	if geoPosMixSize == 0 || dbSearcher.ColumnSelection == 0 || v.geoChecked[geoPosMixSize] {
+		return
+	}
+	v.geoChecked[geoPosMixSize] = true
+
+	geoLen := int64((geoPosMixSize >> 24) & 0xFF)
+	geoPtr := int64(geoPosMixSize & 0x00FFFFFF)
+	if geoPtr+geoLen > int64(len(dbSearcher.GeoMapData)) {
+		v.issue(SectionData, int64(dataPtr), record, "geo map pointer %d+%d is out of bounds [0, %d)", geoPtr, geoLen, len(dbSearcher.GeoMapData))
+		return
+	}
+	if _, err := DecodeGeoResult(dbSearcher.GeoMapData, dbSearcher.ColumnSelection, data); err != nil {
+		var corrupt *CorruptDatabaseError
+		if errors.As(err, &corrupt) {
+			err = corrupt.Err
+		}
+		v.report.addIssue(SectionGeoMap, dbSearcher.geoMapOffset+geoPtr, record, "failed to decode geo map entry: %v", err)
+	}
+}
+
+// formatIPBytes 将IP字节格式化为字符串
+func formatIPBytes(ip []byte) string {
+	if addr, ok := netip.AddrFromSlice(ip); ok {
+		return addr.String()
+	}
+	return fmt.Sprintf("%x", ip)
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestVerifyClean 测试完好的数据库没有问题
+func TestVerifyClean(t *testing.T) {
+	for _, ipv6 := range []bool{false, true} {
+		ranges := testRanges
+		if ipv6 {
+			ranges = testRangesV6
+		}
+		for _, searchType := range []SearchType{MEMORY, BTREE} {
+			dbSearcher, err := InitDBSearcher(writeTestDB(t, ipv6, ranges), testDBKey, searchType)
+			if err != nil {
+				t.Fatalf("初始化数据库搜索器失败: %v", err)
+			}
+			report, err := dbSearcher.Verify()
+			if err != nil {
+				t.Fatalf("Verify 返回错误: %v", err)
+			}
+			if !report.OK() {
+				t.Errorf("ipv6=%v: 完好的数据库报告了问题: %+v", ipv6, report.Issues)
+			}
+			if report.IndexRecords != len(ranges) || report.HeaderEntries == 0 || report.DbSize != report.FileSize-dbSearcher.FileOffset {
+				t.Errorf("ipv6=%v: 报告 = %+v", ipv6, report)
+			}
+
+			CloseDBSearcher(dbSearcher)
+			if _, err := dbSearcher.Verify(); err != ErrClosed {
+				t.Errorf("关闭后 Verify 错误 = %v, 期望 %v", err, ErrClosed)
+			}
+		}
+	}
+}
+
+// TestVerifyCorrupt 测试各种损坏都能在报告中定位到对应区段
+func TestVerifyCorrupt(t *testing.T) {
+	data := buildTestDB(t, false, testRanges)
+	dbSearcher, err := OpenBytes(data, testDBKey, &Options{SearchType: BTREE})
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	offset := int(dbSearcher.FileOffset)
+	indexOffset := func(record int) int {
+		return offset + int(dbSearcher.StartIndexPtr) + record*int(dbSearcher.IndexLength)
+	}
+	headerOffset := func(entry int) int {
+		return offset + SuperPartLength + entry*HeaderBlockLength
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+		section string
+		offset  int
+	}{
+		{"截断", func(data []byte) []byte {
+			return data[:len(data)-10]
+		}, SectionSuperBlock, offset + 1},
+		{"数据库大小", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[offset+1:], uint32(len(data)))
+			return data
+		}, SectionSuperBlock, offset + 1},
+		{"数据指针越界", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[indexOffset(2)+8:], uint32(len(data)))
+			return data
+		}, SectionIndex, indexOffset(2)},
+		{"索引重叠", func(data []byte) []byte {
+			copy(data[indexOffset(1):], []byte{1, 0, 0, 128})
+			return data
+		}, SectionIndex, indexOffset(1)},
+		{"msgpack损坏", func(data []byte) []byte {
+			dataPtr := int(binary.LittleEndian.Uint32(data[indexOffset(4)+8:]))
+			data[offset+dataPtr] = 0xc1
+			return data
+		}, SectionData, 0},
+		{"头部未递增", func(data []byte) []byte {
+			copy(data[headerOffset(1):], data[headerOffset(0):headerOffset(0)+16])
+			return data
+		}, SectionHeaderBlock, headerOffset(1)},
+		{"头部指针", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[headerOffset(1)+16:], uint32(dbSearcher.StartIndexPtr+1))
+			return data
+		}, SectionHeaderBlock, headerOffset(1) + 16},
+		{"地理映射缺失", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[dbSearcher.geoMapOffset-4:], 0)
+			return data
+		}, SectionGeoMap, int(dbSearcher.geoMapOffset) - 4},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "corrupt.czdb")
+		if err := os.WriteFile(path, test.corrupt(append([]byte(nil), data...)), 0644); err != nil {
+			t.Fatalf("写入测试文件失败: %v", err)
+		}
+		report, err := VerifyFile(path, testDBKey)
+		if err != nil {
+			t.Fatalf("%s: VerifyFile 返回错误: %v", test.name, err)
+		}
+		if report.OK() {
+			t.Errorf("%s: 没有报告问题", test.name)
+			continue
+		}
+		if !hasVerifyIssue(report, test.section, int64(test.offset)) {
+			t.Errorf("%s: 报告中没有 %s@%d 的问题: %+v", test.name, test.section, test.offset, report.Issues)
+		}
+	}
+
+	// 地理映射指针越界
+	dbSearcher.GeoMapData = dbSearcher.GeoMapData[:1]
+	report, err := dbSearcher.Verify()
+	if err != nil {
+		t.Fatalf("Verify 返回错误: %v", err)
+	}
+	if !hasVerifyIssue(report, SectionData, 0) {
+		t.Errorf("地理映射指针越界没有报告问题: %+v", report.Issues)
+	}
+	CloseDBSearcher(dbSearcher)
+
+	// 初始化阶段就失败的文件
+	path := filepath.Join(t.TempDir(), "truncated.czdb")
+	if err := os.WriteFile(path, data[:offset+SuperPartLength], 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	report, err = VerifyFile(path, testDBKey)
+	if err != nil {
+		t.Fatalf("VerifyFile 返回错误: %v", err)
+	}
+	if report.IssueCount != 1 || report.Issues[0].Section != SectionHeaderBlock {
+		t.Errorf("截断在 SuperBlock 之后的报告 = %+v", report.Issues)
+	}
+	if _, err := VerifyFile(path, "c2hvcnQ="); err == nil {
+		t.Errorf("无效密钥应返回错误")
+	}
+}
+
+// hasVerifyIssue 判断报告中是否有指定区段的问题，offset 为 0 时不比较偏移量
+func hasVerifyIssue(report *VerifyReport, section string, offset int64) bool {
+	for _, issue := range report.Issues {
+		if issue.Section == section && (offset == 0 || issue.Offset == offset) {
+			return true
+		}
+	}
+	return false
+}
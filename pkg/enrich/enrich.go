@@ -0,0 +1,309 @@
+package enrich
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+)
+
+// OtherField 是表示数据记录中其他数据的字段名称
+const OtherField = "other"
+
+// Searcher 按IP查询地理信息，*db.DBSearcher 和 *db.ReloadableSearcher 都实现了该接口
+type Searcher interface {
+	SearchAddr(addr netip.Addr) (*db.GeoResult, error)
+}
+
+// Options 日志处理选项
+type Options struct {
+	Fields            []string       // 输出的地理字段，为列名称或 OtherField，不能为空
+	ClientVariable    string         // 客户端地址所在的变量，默认为 "remote_addr"
+	ForwardedVariable string         // X-Forwarded-For 所在的变量，默认为 "http_x_forwarded_for"，格式中没有该变量时不使用
+	TrustedProxies    []netip.Prefix // 可信的代理地址，客户端地址属于其中时从 X-Forwarded-For 中查找真实的客户端
+	InsertAfter       string         // 将地理字段插入到该变量之后，为空时追加到行尾
+}
+
+// Enricher 解析日志行并查询客户端IP的地理信息，可以被多个 goroutine 并发使用
+type Enricher struct {
+	searcher    Searcher
+	format      *Format
+	opts        Options
+	client      int // 客户端地址变量的位置
+	forwarded   int // X-Forwarded-For 变量的位置，-1 表示不使用
+	insertAfter int // 插入地理字段的变量位置，-1 表示追加到行尾
+}
+
+// Entry 是一行日志的解析和查询结果
+type Entry struct {
+	Line     string        // 原始日志行
+	Values   []string      // 各变量的值，按 Format.Variables 的顺序排列
+	ClientIP netip.Addr    // 用于查询的客户端IP，无法确定时为零值
+	Result   *db.GeoResult // 地理信息，查询失败时为 nil
+	Err      error         // 确定客户端IP或查询失败的原因，未找到时为 db.ErrNotFound
+
+	spans [][2]int // 各变量的值在 Line 中的起止位置
+}
+
+// New 创建日志处理器
+//
+// 参数:
+//   - searcher: 数据库搜索器
+//   - format: 日志格式
+//   - opts: 处理选项
+//
+// 返回:
+//   - *Enricher: 日志处理器
+//   - error: 未指定地理字段，或格式中没有客户端地址、插入位置的变量时返回错误
+func New(searcher Searcher, format *Format, opts Options) (*Enricher, error) {
+	if len(opts.Fields) == 0 {
+		return nil, fmt.Errorf("at least one geo field is required")
+	}
+	if opts.ClientVariable == "" {
+		opts.ClientVariable = "remote_addr"
+	}
+	if opts.ForwardedVariable == "" {
+		opts.ForwardedVariable = "http_x_forwarded_for"
+	}
+
+	enricher := &Enricher{
+		searcher:    searcher,
+		format:      format,
+		opts:        opts,
+		client:      format.index(opts.ClientVariable),
+		forwarded:   format.index(opts.ForwardedVariable),
+		insertAfter: -1,
+	}
+	if enricher.client < 0 {
+		return nil, fmt.Errorf("log format has no $%s variable for the client address", opts.ClientVariable)
+	}
+	if opts.InsertAfter != "" {
+		if enricher.insertAfter = format.index(opts.InsertAfter); enricher.insertAfter < 0 {
+			return nil, fmt.Errorf("log format has no $%s variable to insert the geo fields after", opts.InsertAfter)
+		}
+	}
+	return enricher, nil
+}
+
+// ParseTrustedProxies 解析以逗号分隔的可信代理地址，每一项为 CIDR 或单个IP
+//
+// 参数:
+//   - spec: 如 "10.0.0.0/8,192.168.1.1,fd00::/8"
+//
+// 返回:
+//   - []netip.Prefix: 代理地址
+//   - error: 如果任一项无效则返回错误
+func ParseTrustedProxies(spec string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Enrich 解析一行日志并查询客户端IP的地理信息
+//
+// 参数:
+//   - line: 日志行，不含换行符
+//
+// 返回:
+//   - *Entry: 解析和查询结果，查询失败的原因见 Entry.Err
+//   - error: 日志行与格式不匹配时返回 ErrNoMatch
+func (enricher *Enricher) Enrich(line string) (*Entry, error) {
+	spans, ok := enricher.format.match(line)
+	if !ok {
+		return nil, ErrNoMatch
+	}
+	entry := &Entry{Line: line, Values: make([]string, len(spans)), spans: spans}
+	for i, span := range spans {
+		entry.Values[i] = line[span[0]:span[1]]
+	}
+
+	entry.ClientIP, entry.Err = enricher.clientIP(entry.Values)
+	if entry.Err == nil {
+		entry.Result, entry.Err = enricher.searcher.SearchAddr(entry.ClientIP)
+	}
+	return entry, nil
+}
+
+// clientIP 返回客户端IP
+//
+// 客户端地址属于可信代理时，从右向左遍历 X-Forwarded-For，跳过可信代理，
+// 返回第一个不可信的地址，即最后一个可信代理看到的客户端；所有地址都可信时返回最左边的地址。
+// 这与 nginx 的 real_ip_recursive on 相同，客户端无法通过伪造 X-Forwarded-For 改变结果。
+func (enricher *Enricher) clientIP(values []string) (netip.Addr, error) {
+	addr, ok := parseHost(values[enricher.client])
+	if !ok {
+		return netip.Addr{}, fmt.Errorf("%w: %q", db.ErrInvalidIP, values[enricher.client])
+	}
+	if enricher.forwarded < 0 {
+		return addr, nil
+	}
+
+	hops := strings.Split(values[enricher.forwarded], ",")
+	for i := len(hops) - 1; i >= 0 && enricher.trusted(addr); i-- {
+		hop, ok := parseHost(strings.TrimSpace(hops[i]))
+		if !ok {
+			break
+		}
+		addr = hop
+	}
+	return addr, nil
+}
+
+// trusted 判断地址是否属于可信代理
+func (enricher *Enricher) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range enricher.opts.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHost 解析IP地址，允许带有端口 (1.2.3.4:80 或 [::1]:80)
+func parseHost(host string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.WithZone(""), true
+	}
+	if addrPort, err := netip.ParseAddrPort(host); err == nil {
+		return addrPort.Addr().WithZone(""), true
+	}
+	return netip.Addr{}, false
+}
+
+// fieldValue 返回地理字段的值，查询失败或没有该字段时为空字符串
+func (enricher *Enricher) fieldValue(entry *Entry, field string) string {
+	if entry.Result == nil {
+		return ""
+	}
+	if field == OtherField {
+		return entry.Result.OtherData
+	}
+	value, _ := entry.Result.Get(field)
+	return value
+}
+
+// AppendLine 将加入地理字段的日志行追加到 buf，不含换行符
+//
+// 每个地理字段写为带引号的字符串，空值写为 "-"，字段之间以空格分隔，
+// 插入位置的变量位于引号或方括号中时插入到右引号或右方括号之后。
+func (enricher *Enricher) AppendLine(buf []byte, entry *Entry) []byte {
+	at := len(entry.Line)
+	if enricher.insertAfter >= 0 {
+		at = entry.spans[enricher.insertAfter][1]
+		before, after := enricher.format.literals[enricher.insertAfter], enricher.format.literals[enricher.insertAfter+1]
+		for _, pair := range []string{`""`, `''`, "[]"} {
+			if strings.HasSuffix(before, pair[:1]) && strings.HasPrefix(after, pair[1:]) {
+				at++
+				break
+			}
+		}
+	}
+
+	buf = append(buf, entry.Line[:at]...)
+	for _, field := range enricher.opts.Fields {
+		buf = append(buf, ' ')
+		buf = appendQuoted(buf, enricher.fieldValue(entry, field))
+	}
+	return append(buf, entry.Line[at:]...)
+}
+
+// appendQuoted 追加带引号的字段值，转义其中的引号和反斜杠
+func appendQuoted(buf []byte, value string) []byte {
+	if value == "" {
+		value = "-"
+	}
+	buf = append(buf, '"')
+	for i := 0; i < len(value); i++ {
+		if value[i] == '"' || value[i] == '\\' {
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, value[i])
+	}
+	return append(buf, '"')
+}
+
+// AppendJSON 将日志行编码为一个 JSON 对象追加到 buf，不含换行符
+//
+// 对象依次包含各变量 (重复的变量只保留第一个)、client_ip 和 geo，
+// geo 为地理字段的对象，查询失败时不输出 geo，而是输出 geo_error。
+func (enricher *Enricher) AppendJSON(buf []byte, entry *Entry) []byte {
+	buf = append(buf, '{')
+	for i, name := range enricher.format.variables {
+		if enricher.format.index(name) != i {
+			continue
+		}
+		buf = appendJSONField(buf, i > 0, name, entry.Values[i])
+	}
+
+	clientIP := ""
+	if entry.ClientIP.IsValid() {
+		clientIP = entry.ClientIP.String()
+	}
+	buf = appendJSONField(buf, true, "client_ip", clientIP)
+
+	if entry.Err != nil {
+		buf = appendJSONField(buf, true, "geo_error", errorText(entry.Err))
+		return append(buf, '}')
+	}
+	buf = append(buf, `,"geo":{`...)
+	for i, field := range enricher.opts.Fields {
+		buf = appendJSONField(buf, i > 0, field, enricher.fieldValue(entry, field))
+	}
+	return append(buf, "}}"...)
+}
+
+// appendJSONField 追加一个 "name":"value" 字段
+func appendJSONField(buf []byte, comma bool, name, value string) []byte {
+	if comma {
+		buf = append(buf, ',')
+	}
+	buf = appendJSONString(buf, name)
+	buf = append(buf, ':')
+	return appendJSONString(buf, value)
+}
+
+// appendJSONString 追加 JSON 字符串，不转义 URL 中常见的 &、< 和 >
+func appendJSONString(buf []byte, value string) []byte {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return append(buf, bytes.TrimSuffix(encoded.Bytes(), []byte("\n"))...)
+}
+
+// errorText 返回 geo_error 字段的值，只包含错误的类别
+func errorText(err error) string {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return "not found"
+	case errors.Is(err, db.ErrInvalidIP):
+		return "invalid ip"
+	case errors.Is(err, db.ErrIPVersionMismatch):
+		return "ip version mismatch"
+	default:
+		return err.Error()
+	}
+}
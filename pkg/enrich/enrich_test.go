@@ -0,0 +1,164 @@
+package enrich
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tagphi/czdb-search-golang/internal/testdb"
+	"github.com/tagphi/czdb-search-golang/pkg/builder"
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+)
+
+// openTestSearcher 生成包含两条记录的测试数据库并打开搜索器，测试结束时自动关闭
+func openTestSearcher(t *testing.T) *db.DBSearcher {
+	t.Helper()
+
+	return testdb.Open(t, 991231, []builder.Range{
+		testdb.Range("1.0.1.0", "1.0.3.255", []string{"中国", "福建", "福州"}, "电信"),
+		testdb.Range("8.8.8.0", "8.8.8.255", []string{"美国", "", ""}, `Google "DNS"`),
+	})
+}
+
+// newTestEnricher 按格式和选项创建日志处理器
+func newTestEnricher(t *testing.T, spec string, opts Options) *Enricher {
+	t.Helper()
+
+	format, err := ParseFormat(spec)
+	if err != nil {
+		t.Fatalf("ParseFormat 返回错误: %v", err)
+	}
+	enricher, err := New(openTestSearcher(t), format, opts)
+	if err != nil {
+		t.Fatalf("New 返回错误: %v", err)
+	}
+	return enricher
+}
+
+// TestEnrichLine 测试追加和插入地理字段
+func TestEnrichLine(t *testing.T) {
+	line := `1.0.1.1 - - [10/Oct/2026:13:55:36 +0800] "GET / HTTP/1.1" 200 612 "-" "curl/8.0"`
+	tests := []struct {
+		insertAfter string
+		expected    string
+	}{
+		{"", line + ` "中国" "福州" "电信"`},
+		{"remote_addr", `1.0.1.1 "中国" "福州" "电信" - - [10/Oct/2026:13:55:36 +0800] "GET / HTTP/1.1" 200 612 "-" "curl/8.0"`},
+		{"time_local", `1.0.1.1 - - [10/Oct/2026:13:55:36 +0800] "中国" "福州" "电信" "GET / HTTP/1.1" 200 612 "-" "curl/8.0"`},
+		{"request", `1.0.1.1 - - [10/Oct/2026:13:55:36 +0800] "GET / HTTP/1.1" "中国" "福州" "电信" 200 612 "-" "curl/8.0"`},
+	}
+	for _, test := range tests {
+		enricher := newTestEnricher(t, "combined", Options{
+			Fields:      []string{"country", "city", OtherField},
+			InsertAfter: test.insertAfter,
+		})
+		entry, err := enricher.Enrich(line)
+		if err != nil {
+			t.Fatalf("Enrich 返回错误: %v", err)
+		}
+		if got := string(enricher.AppendLine(nil, entry)); got != test.expected {
+			t.Errorf("InsertAfter=%q:\n得到 %s\n期望 %s", test.insertAfter, got, test.expected)
+		}
+	}
+
+	enricher := newTestEnricher(t, "common", Options{Fields: []string{"city", OtherField}})
+	entry, err := enricher.Enrich(`8.8.8.8 - - [10/Oct/2026:13:55:36 +0800] "GET / HTTP/1.1" 200 612`)
+	if err != nil {
+		t.Fatalf("Enrich 返回错误: %v", err)
+	}
+	if got := string(enricher.AppendLine(nil, entry)); got != `8.8.8.8 - - [10/Oct/2026:13:55:36 +0800] "GET / HTTP/1.1" 200 612 "-" "Google \"DNS\""` {
+		t.Errorf("空值和引号转义结果 = %s", got)
+	}
+
+	entry, err = enricher.Enrich(`9.9.9.9 - - [10/Oct/2026:13:55:36 +0800] "GET / HTTP/1.1" 200 612`)
+	if err != nil || !errors.Is(entry.Err, db.ErrNotFound) {
+		t.Fatalf("未找到的IP Enrich = %v, %v", entry, err)
+	}
+	if got := string(enricher.AppendLine(nil, entry)); got != `9.9.9.9 - - [10/Oct/2026:13:55:36 +0800] "GET / HTTP/1.1" 200 612 "-" "-"` {
+		t.Errorf("未找到的IP结果 = %s", got)
+	}
+
+	if _, err := enricher.Enrich("not an access log line"); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("不匹配的行应返回 ErrNoMatch，得到 %v", err)
+	}
+}
+
+// TestEnrichForwarded 测试从 X-Forwarded-For 中跳过可信代理确定客户端IP
+func TestEnrichForwarded(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies 返回错误: %v", err)
+	}
+	enricher := newTestEnricher(t, `$remote_addr "$http_x_forwarded_for"`, Options{
+		Fields:         []string{"country"},
+		TrustedProxies: proxies,
+	})
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{`8.8.8.8 "1.0.1.1"`, "8.8.8.8"},                        // 直接连接的客户端不可信，忽略 X-Forwarded-For
+		{`10.0.0.1 "1.0.1.1"`, "1.0.1.1"},                       // 可信代理转发
+		{`10.0.0.1 "2.2.2.2, 1.0.1.1, 192.168.1.1"`, "1.0.1.1"}, // 跳过多层可信代理，伪造的最左边地址被忽略
+		{`10.0.0.1 "10.0.0.2, 10.0.0.3"`, "10.0.0.2"},           // 都可信时使用最左边的地址
+		{`10.0.0.1 "1.0.1.1:5000"`, "1.0.1.1"},                  // 带端口的地址
+		{`10.0.0.1 "-"`, "10.0.0.1"},                            // 没有 X-Forwarded-For
+		{`[::ffff:10.0.0.1]:80 "8.8.8.8"`, "8.8.8.8"},           // IPv4 映射的代理地址
+	}
+	for _, test := range tests {
+		entry, err := enricher.Enrich(test.line)
+		if err != nil {
+			t.Fatalf("Enrich(%q) 返回错误: %v", test.line, err)
+		}
+		if entry.ClientIP.String() != test.expected {
+			t.Errorf("Enrich(%q) 客户端IP = %v, 期望 %s", test.line, entry.ClientIP, test.expected)
+		}
+	}
+
+	entry, err := enricher.Enrich(`unknown "-"`)
+	if err != nil || !errors.Is(entry.Err, db.ErrInvalidIP) || entry.ClientIP.IsValid() {
+		t.Errorf("无效的客户端地址 Enrich = %+v, %v", entry, err)
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/8,bogus"); err == nil {
+		t.Errorf("ParseTrustedProxies 对无效地址应返回错误")
+	}
+}
+
+// TestEnrichJSON 测试 JSON Lines 输出
+func TestEnrichJSON(t *testing.T) {
+	enricher := newTestEnricher(t, `$remote_addr "$request" "$request"`, Options{Fields: []string{"country", "province"}})
+
+	entry, err := enricher.Enrich(`1.0.1.1 "GET /?a=1&b=<2>" "x"`)
+	if err != nil {
+		t.Fatalf("Enrich 返回错误: %v", err)
+	}
+	expected := `{"remote_addr":"1.0.1.1","request":"GET /?a=1&b=<2>","client_ip":"1.0.1.1","geo":{"country":"中国","province":"福建"}}`
+	if got := string(enricher.AppendJSON(nil, entry)); got != expected {
+		t.Errorf("AppendJSON =\n%s\n期望\n%s", got, expected)
+	}
+
+	entry, err = enricher.Enrich(`bogus "GET /" "x"`)
+	if err != nil {
+		t.Fatalf("Enrich 返回错误: %v", err)
+	}
+	expected = `{"remote_addr":"bogus","request":"GET /","client_ip":"","geo_error":"invalid ip"}`
+	if got := string(enricher.AppendJSON(nil, entry)); got != expected {
+		t.Errorf("AppendJSON =\n%s\n期望\n%s", got, expected)
+	}
+}
+
+// TestNewErrors 测试缺少地理字段或变量时 New 返回错误
+func TestNewErrors(t *testing.T) {
+	format, _ := ParseFormat("common")
+	searcher := openTestSearcher(t)
+	for _, opts := range []Options{
+		{},
+		{Fields: []string{"country"}, ClientVariable: "http_x_real_ip"},
+		{Fields: []string{"country"}, InsertAfter: "http_referer"},
+	} {
+		if _, err := New(searcher, format, opts); err == nil {
+			t.Errorf("New(%+v) 应返回错误", opts)
+		}
+	}
+}
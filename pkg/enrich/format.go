@@ -0,0 +1,225 @@
+// Package enrich 解析 Web 访问日志，按客户端IP查询地理信息并写回日志行或输出为 JSON Lines
+package enrich
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 预定义的日志格式，与 nginx 的 combined 和 Apache 的 common、combined 格式的行相同
+const (
+	// CommonFormat 是 Common Log Format
+	CommonFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent`
+	// CombinedFormat 是 nginx 默认的 combined 格式，在 CommonFormat 之后加上 Referer 和 User-Agent
+	CombinedFormat = CommonFormat + ` "$http_referer" "$http_user_agent"`
+)
+
+// ErrNoMatch 表示日志行与日志格式不匹配
+var ErrNoMatch = errors.New("line does not match the log format")
+
+// Format 是编译后的日志格式，由字面文本和 nginx 风格的变量交替组成
+type Format struct {
+	spec      string
+	literals  []string // literals[i] 位于 variables[i] 之前，最后一个位于行尾，比 variables 多一个
+	variables []string
+}
+
+// ParseFormat 解析日志格式
+//
+// spec 可以是 "common"、"combined"，nginx 的 log_format 字符串 (变量写为 $name 或 ${name})，
+// 或者从 nginx.conf 中复制的带引号的写法，如
+//
+//	log_format main '$remote_addr - $remote_user [$time_local] '
+//	                '"$request" $status "$http_x_forwarded_for"';
+//
+// 参数:
+//   - spec: 日志格式
+//
+// 返回:
+//   - *Format: 编译后的日志格式
+//   - error: 格式中没有变量或两个变量相邻时返回错误
+func ParseFormat(spec string) (*Format, error) {
+	switch strings.ToLower(strings.TrimSpace(spec)) {
+	case "common", "clf":
+		spec = CommonFormat
+	case "combined":
+		spec = CombinedFormat
+	}
+
+	text, err := unquoteDirective(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	format := &Format{spec: text}
+	var literal strings.Builder
+	for i := 0; i < len(text); {
+		name, next := readVariable(text, i)
+		if name == "" {
+			literal.WriteByte(text[i])
+			i++
+			continue
+		}
+		if literal.Len() == 0 && len(format.variables) > 0 {
+			return nil, fmt.Errorf("log format %q: variables $%s and $%s must be separated by text",
+				text, format.variables[len(format.variables)-1], name)
+		}
+		format.literals = append(format.literals, literal.String())
+		format.variables = append(format.variables, name)
+		literal.Reset()
+		i = next
+	}
+	format.literals = append(format.literals, literal.String())
+
+	if len(format.variables) == 0 {
+		return nil, fmt.Errorf("log format %q contains no variables", text)
+	}
+	return format, nil
+}
+
+// readVariable 读取 text[i] 处的 $name 或 ${name}，不是变量时返回空名称
+func readVariable(text string, i int) (string, int) {
+	if text[i] != '$' {
+		return "", i
+	}
+	start, braced := i+1, false
+	if start < len(text) && text[start] == '{' {
+		start, braced = start+1, true
+	}
+	end := start
+	for end < len(text) && isVariableChar(text[end]) {
+		end++
+	}
+	if end == start {
+		return "", i
+	}
+	if braced {
+		if end >= len(text) || text[end] != '}' {
+			return "", i
+		}
+		return text[start:end], end + 1
+	}
+	return text[start:end], end
+}
+
+// isVariableChar 判断字符是否可以出现在变量名称中
+func isVariableChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// unquoteDirective 去掉 log_format 指令的名称、escape 参数和结尾的分号，拼接各个带引号的部分
+//
+// 不以引号开头的 spec 原样返回。
+func unquoteDirective(spec string) (string, error) {
+	text := strings.TrimSpace(spec)
+	if fields := strings.Fields(text); len(fields) >= 2 && fields[0] == "log_format" {
+		text = strings.TrimSpace(strings.TrimPrefix(text, "log_format"))
+		text = strings.TrimSpace(strings.TrimPrefix(text, fields[1]))
+		if strings.HasPrefix(text, "escape=") {
+			text = strings.TrimSpace(text[strings.IndexAny(text+" ", " \t\n"):])
+		}
+	}
+	text = strings.TrimSpace(strings.TrimSuffix(text, ";"))
+	if text == "" || text[0] != '\'' && text[0] != '"' {
+		return spec, nil
+	}
+
+	var result strings.Builder
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '\'' || c == '"':
+			end := i + 1
+			for ; end < len(text) && text[end] != c; end++ {
+				if text[end] == '\\' && end+1 < len(text) {
+					end++
+				}
+				result.WriteByte(text[end])
+			}
+			if end >= len(text) {
+				return "", fmt.Errorf("log format %q: unterminated quoted string", spec)
+			}
+			i = end + 1
+		default:
+			return "", fmt.Errorf("log format %q: unexpected %q outside quotes", spec, c)
+		}
+	}
+	return result.String(), nil
+}
+
+// String 返回日志格式的 nginx 写法
+func (format *Format) String() string {
+	return format.spec
+}
+
+// Variables 返回格式中的变量名称，按出现顺序排列
+func (format *Format) Variables() []string {
+	return format.variables
+}
+
+// index 返回变量第一次出现的位置，格式中没有该变量时返回 -1
+func (format *Format) index(name string) int {
+	for i, variable := range format.variables {
+		if variable == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// match 按格式切分日志行，返回每个变量的值在行中的起止位置
+//
+// 每个变量的值延伸到其后字面文本第一次出现的位置；值位于引号中时跳过被反斜杠转义的引号，
+// 最后一个变量的值延伸到行尾的字面文本之前。
+func (format *Format) match(line string) ([][2]int, bool) {
+	if !strings.HasPrefix(line, format.literals[0]) {
+		return nil, false
+	}
+	spans := make([][2]int, len(format.variables))
+	pos := len(format.literals[0])
+	last := len(format.variables) - 1
+	for i := range format.variables {
+		after := format.literals[i+1]
+		var end int
+		if i == last {
+			if !strings.HasSuffix(line[pos:], after) {
+				return nil, false
+			}
+			end = len(line) - len(after)
+		} else {
+			quoted := strings.HasSuffix(format.literals[i], `"`) && strings.HasPrefix(after, `"`)
+			offset := indexLiteral(line[pos:], after, quoted)
+			if offset < 0 {
+				return nil, false
+			}
+			end = pos + offset
+		}
+		spans[i] = [2]int{pos, end}
+		pos = end + len(after)
+	}
+	return spans, true
+}
+
+// indexLiteral 查找 literal 在 s 中第一次出现的位置，quoted 为 true 时跳过前面有奇数个反斜杠的位置
+func indexLiteral(s, literal string, quoted bool) int {
+	for offset := 0; ; {
+		i := strings.Index(s[offset:], literal)
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		if !quoted {
+			return i
+		}
+		backslashes := 0
+		for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+			backslashes++
+		}
+		if backslashes%2 == 0 {
+			return i
+		}
+		offset = i + 1
+	}
+}
@@ -0,0 +1,76 @@
+package enrich
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseFormat 测试预定义格式、nginx 指令写法和无效格式
+func TestParseFormat(t *testing.T) {
+	combined, err := ParseFormat("combined")
+	if err != nil {
+		t.Fatalf("ParseFormat(combined) 返回错误: %v", err)
+	}
+	expected := []string{"remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent"}
+	if !reflect.DeepEqual(combined.Variables(), expected) {
+		t.Errorf("combined 变量 = %v, 期望 %v", combined.Variables(), expected)
+	}
+
+	directive := `log_format main escape=json '$remote_addr - [$time_local] '
+	                  "\"$request\" ${status}xx \"$http_x_forwarded_for\"";`
+	format, err := ParseFormat(directive)
+	if err != nil {
+		t.Fatalf("ParseFormat(指令) 返回错误: %v", err)
+	}
+	if format.String() != `$remote_addr - [$time_local] "$request" ${status}xx "$http_x_forwarded_for"` {
+		t.Errorf("指令格式 = %q", format.String())
+	}
+	if !reflect.DeepEqual(format.Variables(), []string{"remote_addr", "time_local", "request", "status", "http_x_forwarded_for"}) {
+		t.Errorf("指令格式变量 = %v", format.Variables())
+	}
+
+	for _, spec := range []string{
+		"no variables here",
+		"$remote_addr$status",
+		`'$remote_addr`,
+		`'$remote_addr' x`,
+	} {
+		if _, err := ParseFormat(spec); err == nil {
+			t.Errorf("ParseFormat(%q) 应返回错误", spec)
+		}
+	}
+}
+
+// TestFormatMatch 测试按格式切分日志行，包括引号中被转义的引号和不匹配的行
+func TestFormatMatch(t *testing.T) {
+	format, err := ParseFormat("combined")
+	if err != nil {
+		t.Fatalf("ParseFormat 返回错误: %v", err)
+	}
+
+	line := `1.0.1.1 - - [10/Oct/2026:13:55:36 +0800] "GET /a?q=\"x\" HTTP/1.1" 200 612 "-" "curl/8.0 \"beta\""`
+	spans, ok := format.match(line)
+	if !ok {
+		t.Fatalf("日志行应与格式匹配")
+	}
+	var values []string
+	for _, span := range spans {
+		values = append(values, line[span[0]:span[1]])
+	}
+	expected := []string{"1.0.1.1", "-", "10/Oct/2026:13:55:36 +0800", `GET /a?q=\"x\" HTTP/1.1`,
+		"200", "612", "-", `curl/8.0 \"beta\"`}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("变量值 = %q, 期望 %q", values, expected)
+	}
+
+	for _, line := range []string{
+		"",
+		`1.0.1.1 - - [10/Oct/2026:13:55:36 +0800] "GET / HTTP/1.1" 200 612`,
+		`1.0.1.1 - - [10/Oct/2026:13:55:36 +0800] "GET / HTTP/1.1" 200 612 "-" "curl" trailing`,
+	} {
+		if _, ok := format.match(line); ok {
+			t.Errorf("日志行 %q 不应与格式匹配", line)
+		}
+	}
+}
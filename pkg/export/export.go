@@ -0,0 +1,267 @@
+// Package export 将CZDB数据库中的记录导出为 CSV、TSV、JSON Lines 或 MMDB
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+)
+
+// Format 表示导出格式
+type Format string
+
+const (
+	// CSV 逗号分隔，按 RFC 4180 转义
+	CSV Format = "csv"
+	// TSV 制表符分隔，值中的 \t、\n、\r 和 \ 转义为 \t、\n、\r 和 \\
+	TSV Format = "tsv"
+	// JSONLines 每行一个 JSON 对象
+	JSONLines Format = "jsonl"
+	// MMDB MaxMind DB 二进制格式，使用 ExportMMDB 导出
+	MMDB Format = "mmdb"
+)
+
+// ParseFormat 解析导出格式名称，支持 csv、tsv、jsonl (或 json、ndjson) 和 mmdb
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "csv":
+		return CSV, nil
+	case "tsv":
+		return TSV, nil
+	case "jsonl", "json", "ndjson":
+		return JSONLines, nil
+	case "mmdb":
+		return MMDB, nil
+	default:
+		return "", fmt.Errorf("unsupported export format: %s", name)
+	}
+}
+
+// Options 导出选项
+type Options struct {
+	Format   Format   // 导出格式，默认为 CSV
+	Columns  []string // 地理列的名称，按选中列的顺序对应，未指定的列按 Schema 命名
+	Schema   []string // 列名称，按原始列索引排列，通常为 DBSearcher.Schema；其中没有的列命名为 column_<索引>
+	Numeric  bool     // 是否同时输出数值形式的 start_num 和 end_num
+	NoHeader bool     // CSV/TSV 不输出表头
+}
+
+// Writer 按行写出记录
+type Writer struct {
+	opts          Options
+	columnIndexes []int    // 输出的地理列在地理映射中的原始索引
+	names         []string // 输出字段名称
+	buf           *bufio.Writer
+	csv           *csv.Writer
+	wroteHeader   bool
+}
+
+// NewWriter 创建记录写出器
+//
+// 参数:
+//   - w: 输出目标
+//   - columnIndexes: 输出的地理列在地理映射中的原始索引，通常为 db.SelectedColumns 的结果
+//   - opts: 导出选项
+//
+// 返回:
+//   - *Writer: 记录写出器，写完后需调用 Flush
+//   - error: 如果格式不支持则返回错误
+func NewWriter(w io.Writer, columnIndexes []int, opts Options) (*Writer, error) {
+	if opts.Format == "" {
+		opts.Format = CSV
+	}
+	if _, err := ParseFormat(string(opts.Format)); err != nil {
+		return nil, err
+	}
+	if opts.Format == MMDB {
+		return nil, fmt.Errorf("mmdb is not a line format, use ExportMMDB")
+	}
+
+	writer := &Writer{
+		opts:          opts,
+		columnIndexes: columnIndexes,
+		buf:           bufio.NewWriter(w),
+	}
+	if opts.Format == CSV {
+		writer.csv = csv.NewWriter(writer.buf)
+	}
+
+	writer.names = []string{"start_ip", "end_ip"}
+	if opts.Numeric {
+		writer.names = append(writer.names, "start_num", "end_num")
+	}
+	for i, index := range columnIndexes {
+		if i < len(opts.Columns) && opts.Columns[i] != "" {
+			writer.names = append(writer.names, opts.Columns[i])
+		} else {
+			writer.names = append(writer.names, db.ColumnName(opts.Schema, index))
+		}
+	}
+	writer.names = append(writer.names, "other")
+	return writer, nil
+}
+
+// Names 返回输出字段名称
+func (writer *Writer) Names() []string {
+	return writer.names
+}
+
+// WriteRecord 写出一条记录
+func (writer *Writer) WriteRecord(record db.Record) error {
+	if err := writer.writeHeader(); err != nil {
+		return err
+	}
+
+	values := []string{record.Range.Start.String(), record.Range.End.String()}
+	if writer.opts.Numeric {
+		values = append(values, AddrToDecimal(record.Range.Start), AddrToDecimal(record.Range.End))
+	}
+	for _, index := range writer.columnIndexes {
+		value := ""
+		if record.Result != nil {
+			value, _ = record.Result.Column(index)
+		}
+		values = append(values, value)
+	}
+	other := ""
+	if record.Result != nil {
+		other = record.Result.OtherData
+	}
+	values = append(values, other)
+
+	if writer.opts.Format == JSONLines {
+		return writer.writeJSON(values, record.Range.Start.Is4())
+	}
+	return writer.writeRow(values)
+}
+
+// writeHeader 在第一条记录之前写出 CSV 或 TSV 的表头，只写出一次
+func (writer *Writer) writeHeader() error {
+	if writer.wroteHeader {
+		return nil
+	}
+	writer.wroteHeader = true
+	if writer.opts.NoHeader || writer.opts.Format == JSONLines {
+		return nil
+	}
+	return writer.writeRow(writer.names)
+}
+
+// writeRow 写出一行 CSV 或 TSV
+func (writer *Writer) writeRow(values []string) error {
+	if writer.csv != nil {
+		return writer.csv.Write(values)
+	}
+
+	for i, value := range values {
+		if i > 0 {
+			writer.buf.WriteByte('\t')
+		}
+		writer.buf.WriteString(EscapeTSV(value))
+	}
+	return writer.buf.WriteByte('\n')
+}
+
+// writeJSON 按字段顺序写出一个 JSON 对象，IPv4 的数值字段为数字，IPv6 为字符串
+func (writer *Writer) writeJSON(values []string, ipv4 bool) error {
+	var line bytes.Buffer
+	line.WriteByte('{')
+	for i, name := range writer.names {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		line.Write(key)
+		line.WriteByte(':')
+
+		numeric := writer.opts.Numeric && (i == 2 || i == 3)
+		if numeric && ipv4 {
+			line.WriteString(values[i])
+		} else {
+			value, _ := json.Marshal(values[i])
+			line.Write(value)
+		}
+	}
+	line.WriteString("}\n")
+	_, err := writer.buf.Write(line.Bytes())
+	return err
+}
+
+// Flush 将缓冲的数据写入输出目标，没有写出任何记录时也会写出表头
+func (writer *Writer) Flush() error {
+	if err := writer.writeHeader(); err != nil {
+		return err
+	}
+	if writer.csv != nil {
+		writer.csv.Flush()
+		if err := writer.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return writer.buf.Flush()
+}
+
+// Export 按地址升序导出数据库中的所有记录
+//
+// 参数:
+//   - dbSearcher: 数据库搜索器
+//   - w: 输出目标
+//   - opts: 导出选项，未指定 Schema 时使用 dbSearcher.Schema
+//
+// 返回:
+//   - int: 导出的记录数
+//   - error: 如果遍历或写出失败则返回错误
+func Export(dbSearcher *db.DBSearcher, w io.Writer, opts Options) (int, error) {
+	if opts.Schema == nil {
+		opts.Schema = dbSearcher.Schema
+	}
+	writer, err := NewWriter(w, db.SelectedColumns(dbSearcher.Selection()), opts)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var writeErr error
+	err = dbSearcher.Records(func(record db.Record) bool {
+		if writeErr = writer.WriteRecord(record); writeErr != nil {
+			return false
+		}
+		count++
+		return true
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if flushErr := writer.Flush(); err == nil {
+		err = flushErr
+	}
+	return count, err
+}
+
+// AddrToDecimal 返回IP地址的十进制数值形式，IPv6 地址按 128 位无符号整数输出
+func AddrToDecimal(addr netip.Addr) string {
+	if addr.Is4() {
+		ip4 := addr.As4()
+		return strconv.FormatUint(uint64(ip4[0])<<24|uint64(ip4[1])<<16|uint64(ip4[2])<<8|uint64(ip4[3]), 10)
+	}
+	ip16 := addr.As16()
+	return new(big.Int).SetBytes(ip16[:]).String()
+}
+
+// EscapeTSV 转义 TSV 字段中的特殊字符
+func EscapeTSV(value string) string {
+	if !strings.ContainsAny(value, "\t\n\r\\") {
+		return value
+	}
+	replacer := strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+	return replacer.Replace(value)
+}
@@ -0,0 +1,115 @@
+package export
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+)
+
+// 测试用的记录
+var testRecords = []db.Record{
+	{
+		Range:  db.IPRange{Start: netip.MustParseAddr("1.0.1.0"), End: netip.MustParseAddr("1.0.3.255")},
+		Result: &db.GeoResult{Columns: []string{"中国", "福建"}, ColumnIndexes: []int{0, 1}, OtherData: "电信"},
+	},
+	{
+		Range:  db.IPRange{Start: netip.MustParseAddr("8.8.8.0"), End: netip.MustParseAddr("8.8.8.255")},
+		Result: &db.GeoResult{Columns: []string{"美国", "a,\"b\"\tc"}, ColumnIndexes: []int{0, 1}, OtherData: ""},
+	},
+}
+
+// TestWriterFormats 测试三种导出格式的输出
+func TestWriterFormats(t *testing.T) {
+	tests := []struct {
+		opts     Options
+		expected string
+	}{
+		{
+			Options{Format: CSV, Columns: []string{"country"}},
+			"start_ip,end_ip,country,column_1,other\n" +
+				"1.0.1.0,1.0.3.255,中国,福建,电信\n" +
+				"8.8.8.0,8.8.8.255,美国,\"a,\"\"b\"\"\tc\",\n",
+		},
+		{
+			Options{Format: CSV, Columns: []string{"国家"}, Schema: db.DefaultColumnSchema},
+			"start_ip,end_ip,国家,province,other\n" +
+				"1.0.1.0,1.0.3.255,中国,福建,电信\n" +
+				"8.8.8.0,8.8.8.255,美国,\"a,\"\"b\"\"\tc\",\n",
+		},
+		{
+			Options{Format: TSV, Numeric: true, NoHeader: true},
+			"1.0.1.0\t1.0.3.255\t16777472\t16778239\t中国\t福建\t电信\n" +
+				"8.8.8.0\t8.8.8.255\t134744064\t134744319\t美国\ta,\"b\"\\tc\t\n",
+		},
+		{
+			Options{Format: JSONLines, Numeric: true, Columns: []string{"country", "province"}},
+			`{"start_ip":"1.0.1.0","end_ip":"1.0.3.255","start_num":16777472,"end_num":16778239,"country":"中国","province":"福建","other":"电信"}` + "\n" +
+				`{"start_ip":"8.8.8.0","end_ip":"8.8.8.255","start_num":134744064,"end_num":134744319,"country":"美国","province":"a,\"b\"\tc","other":""}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		writer, err := NewWriter(&out, []int{0, 1}, test.opts)
+		if err != nil {
+			t.Fatalf("NewWriter 返回错误: %v", err)
+		}
+		for _, record := range testRecords {
+			if err := writer.WriteRecord(record); err != nil {
+				t.Fatalf("WriteRecord 返回错误: %v", err)
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			t.Fatalf("Flush 返回错误: %v", err)
+		}
+		if out.String() != test.expected {
+			t.Errorf("%s 输出:\n%s\n期望:\n%s", test.opts.Format, out.String(), test.expected)
+		}
+	}
+}
+
+// TestWriterNoRecords 测试没有记录时 CSV 和 TSV 仍然输出表头
+func TestWriterNoRecords(t *testing.T) {
+	tests := []struct {
+		opts     Options
+		expected string
+	}{
+		{Options{Format: CSV}, "start_ip,end_ip,column_0,column_1,other\n"},
+		{Options{Format: TSV, Schema: db.DefaultColumnSchema}, "start_ip\tend_ip\tcountry\tprovince\tother\n"},
+		{Options{Format: TSV, NoHeader: true}, ""},
+		{Options{Format: JSONLines}, ""},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		writer, err := NewWriter(&out, []int{0, 1}, test.opts)
+		if err != nil {
+			t.Fatalf("NewWriter 返回错误: %v", err)
+		}
+		// 多次调用 Flush 只写出一次表头
+		for i := 0; i < 2; i++ {
+			if err := writer.Flush(); err != nil {
+				t.Fatalf("Flush 返回错误: %v", err)
+			}
+		}
+		if out.String() != test.expected {
+			t.Errorf("%+v 输出 %q, 期望 %q", test.opts, out.String(), test.expected)
+		}
+	}
+}
+
+// TestAddrToDecimal 测试IP地址的数值形式
+func TestAddrToDecimal(t *testing.T) {
+	tests := map[string]string{
+		"0.0.0.0":         "0",
+		"255.255.255.255": "4294967295",
+		"::1":             "1",
+		"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff": "340282366920938463463374607431768211455",
+	}
+	for ip, expected := range tests {
+		if result := AddrToDecimal(netip.MustParseAddr(ip)); result != expected {
+			t.Errorf("AddrToDecimal(%s) = %s, 期望 %s", ip, result, expected)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+	"github.com/tagphi/czdb-search-golang/pkg/mmdb"
+	"github.com/tagphi/czdb-search-golang/pkg/utils"
+)
+
+// OtherDataColumn 表示 MMDBField 的来源为数据记录中的 otherData
+const OtherDataColumn = -1
+
+// MMDBField 描述MMDB数据中的一个键及其来源
+type MMDBField struct {
+	Key    string // 键路径，以 . 分隔嵌套的映射，如 "country.names.zh-CN"
+	Column int    // 地理映射中的原始列索引，OtherDataColumn 表示 otherData
+}
+
+// MMDBOptions MMDB导出选项
+type MMDBOptions struct {
+	Fields       []MMDBField       // 字段映射，为空时使用 DefaultMMDBFields
+	DatabaseType string            // 元数据中的数据库类型，默认为 "CZDB"
+	Languages    []string          // 元数据中的语言
+	Description  map[string]string // 元数据中按语言区分的描述
+	IPVersion    int               // 搜索树的IP版本，为 0 时与数据库一致；IPv4数据库可指定 6
+	RecordSize   int               // 记录位数，为 0 时自动选择
+}
+
+// ParseMMDBFields 解析以逗号分隔的字段映射，如 "country=0,province=1,isp=other"
+//
+// 参数:
+//   - spec: 每一项为 键路径=列索引，列索引为 other 时表示 otherData
+//
+// 返回:
+//   - []MMDBField: 字段映射
+//   - error: 如果格式错误则返回错误
+func ParseMMDBFields(spec string) ([]MMDBField, error) {
+	var fields []MMDBField
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, source, ok := strings.Cut(item, "=")
+		key, source = strings.TrimSpace(key), strings.TrimSpace(source)
+		if !ok || key == "" || source == "" {
+			return nil, fmt.Errorf("invalid MMDB field %q, expected key=column", item)
+		}
+
+		column := OtherDataColumn
+		if source != "other" {
+			index, err := strconv.Atoi(source)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid column %q in MMDB field %q", source, item)
+			}
+			column = index
+		}
+		fields = append(fields, MMDBField{Key: key, Column: column})
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no MMDB fields in %q", spec)
+	}
+	return fields, nil
+}
+
+// DefaultMMDBFields 返回默认的字段映射：每个选中列一个键，otherData 写入 "other"
+//
+// 参数:
+//   - columnIndexes: 选中列的原始索引
+//   - schema: 列名称，按原始列索引排列，通常为 DBSearcher.Schema
+//   - names: 按选中列顺序对应的键名，未指定的列使用 db.ColumnName(schema, 索引)
+//
+// 返回:
+//   - []MMDBField: 字段映射
+func DefaultMMDBFields(columnIndexes []int, schema []string, names []string) []MMDBField {
+	fields := make([]MMDBField, 0, len(columnIndexes)+1)
+	for i, index := range columnIndexes {
+		key := db.ColumnName(schema, index)
+		if i < len(names) && names[i] != "" {
+			key = names[i]
+		}
+		fields = append(fields, MMDBField{Key: key, Column: index})
+	}
+	return append(fields, MMDBField{Key: "other", Column: OtherDataColumn})
+}
+
+// MMDBValue 按字段映射将查询结果转换为MMDB数据，空值的键不写入
+//
+// 参数:
+//   - result: 查询结果
+//   - fields: 字段映射
+//
+// 返回:
+//   - map[string]interface{}: MMDB数据
+//   - error: 如果键路径冲突则返回错误
+func MMDBValue(result *db.GeoResult, fields []MMDBField) (map[string]interface{}, error) {
+	value := map[string]interface{}{}
+	if result == nil {
+		return value, nil
+	}
+
+	for _, field := range fields {
+		text := result.OtherData
+		if field.Column != OtherDataColumn {
+			text, _ = result.Column(field.Column)
+		}
+		if text == "" {
+			continue
+		}
+
+		path := strings.Split(field.Key, ".")
+		m := value
+		for _, name := range path[:len(path)-1] {
+			child, ok := m[name]
+			if !ok {
+				child = map[string]interface{}{}
+				m[name] = child
+			}
+			if m, ok = child.(map[string]interface{}); !ok {
+				return nil, fmt.Errorf("MMDB field %q conflicts with another field", field.Key)
+			}
+		}
+		if _, ok := m[path[len(path)-1]]; ok {
+			return nil, fmt.Errorf("MMDB field %q conflicts with another field", field.Key)
+		}
+		m[path[len(path)-1]] = text
+	}
+	return value, nil
+}
+
+// checkMMDBFields 检查字段映射只使用选中的列，记录只解码选中的列，其他列的字段会被静默丢弃
+func checkMMDBFields(fields []MMDBField, selected []int, schema []string) error {
+	for _, field := range fields {
+		if field.Column == OtherDataColumn {
+			continue
+		}
+		found := false
+		for _, index := range selected {
+			found = found || index == field.Column
+		}
+		if !found {
+			return fmt.Errorf("MMDB field %q uses column %d (%s), which is not in the column selection",
+				field.Key, field.Column, db.ColumnName(schema, field.Column))
+		}
+	}
+	return nil
+}
+
+// ExportMMDB 将数据库中的所有记录写出为MMDB文件
+//
+// 每条记录按其CIDR分解插入搜索树，数据内容由 opts.Fields 决定。
+//
+// 参数:
+//   - dbSearcher: 数据库搜索器
+//   - w: 输出目标
+//   - opts: MMDB导出选项
+//
+// 返回:
+//   - int: 导出的记录数
+//   - error: 如果字段映射使用了未选中的列，或遍历、转换、写出失败则返回错误
+func ExportMMDB(dbSearcher *db.DBSearcher, w io.Writer, opts MMDBOptions) (int, error) {
+	ipVersion := opts.IPVersion
+	if ipVersion == 0 {
+		ipVersion = int(dbSearcher.IPType)
+	}
+	if ipVersion == utils.IPV4 && dbSearcher.IPType == int32(utils.IPV6) {
+		return 0, fmt.Errorf("cannot export an IPv6 database to an IPv4 MMDB tree")
+	}
+
+	databaseType := opts.DatabaseType
+	if databaseType == "" {
+		databaseType = "CZDB"
+	}
+	writer, err := mmdb.NewWriter(ipVersion, databaseType)
+	if err != nil {
+		return 0, err
+	}
+	writer.Languages = opts.Languages
+	writer.Description = opts.Description
+	writer.RecordSize = opts.RecordSize
+
+	selected := db.SelectedColumns(dbSearcher.Selection())
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = DefaultMMDBFields(selected, dbSearcher.Schema, nil)
+	}
+	if err := checkMMDBFields(fields, selected, dbSearcher.Schema); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var insertErr error
+	err = dbSearcher.Records(func(record db.Record) bool {
+		value, err := MMDBValue(record.Result, fields)
+		if err != nil {
+			insertErr = err
+			return false
+		}
+		for _, prefix := range record.Range.Prefixes() {
+			if insertErr = writer.Insert(prefix, value); insertErr != nil {
+				return false
+			}
+		}
+		count++
+		return true
+	})
+	if err == nil {
+		err = insertErr
+	}
+	if err != nil {
+		return count, err
+	}
+
+	if _, err := writer.WriteTo(w); err != nil {
+		return count, err
+	}
+	return count, nil
+}
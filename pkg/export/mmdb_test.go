@@ -0,0 +1,173 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/tagphi/czdb-search-golang/internal/testdb"
+	"github.com/tagphi/czdb-search-golang/pkg/builder"
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+	"github.com/tagphi/czdb-search-golang/pkg/mmdb"
+)
+
+// TestExportMMDBRoundTrip 测试导出的MMDB文件与 db.Search 的查询结果一致
+func TestExportMMDBRoundTrip(t *testing.T) {
+	fields, err := ParseMMDBFields("country.names.zh-CN=0, region=1, city=2, isp=other")
+	if err != nil {
+		t.Fatalf("解析字段映射失败: %v", err)
+	}
+
+	tests := []struct {
+		path      string
+		ipVersion int
+		fields    []MMDBField
+	}{
+		{"testdata/ipv4.czdb", 0, fields},
+		{"testdata/ipv4.czdb", 6, nil},
+		{"testdata/ipv6.czdb", 0, fields},
+	}
+
+	for _, test := range tests {
+		dbSearcher, err := db.InitDBSearcher(test.path, testdb.Key, db.MEMORY)
+		if err != nil {
+			t.Fatalf("初始化数据库搜索器失败: %v", err)
+		}
+
+		var out bytes.Buffer
+		opts := MMDBOptions{Fields: test.fields, IPVersion: test.ipVersion}
+		count, err := ExportMMDB(dbSearcher, &out, opts)
+		if err != nil {
+			t.Fatalf("%s: 导出MMDB失败: %v", test.path, err)
+		}
+		reader, err := mmdb.FromBytes(out.Bytes())
+		if err != nil {
+			t.Fatalf("%s: 打开导出的MMDB失败: %v", test.path, err)
+		}
+		if reader.Metadata.DatabaseType != "CZDB" {
+			t.Errorf("%s: database_type = %q", test.path, reader.Metadata.DatabaseType)
+		}
+
+		expectedFields := test.fields
+		if expectedFields == nil {
+			expectedFields = DefaultMMDBFields(db.SelectedColumns(dbSearcher.ColumnSelection), dbSearcher.Schema, nil)
+		}
+
+		records := 0
+		err = dbSearcher.Records(func(record db.Record) bool {
+			records++
+			for _, addr := range []netip.Addr{record.Range.Start, record.Range.Start.Next(), record.Range.End, record.Range.Start.Prev(), record.Range.End.Next()} {
+				if !addr.IsValid() {
+					continue
+				}
+				checkMMDBLookup(t, dbSearcher, reader, addr, expectedFields)
+				if test.ipVersion == 6 && addr.Is4() {
+					checkMMDBLookup(t, dbSearcher, reader, netip.AddrFrom16(addr.As16()), expectedFields)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			t.Fatalf("%s: 遍历记录失败: %v", test.path, err)
+		}
+		if records == 0 || count != records {
+			t.Errorf("%s: 导出 %d 条记录, 期望 %d", test.path, count, records)
+		}
+		db.CloseDBSearcher(dbSearcher)
+	}
+}
+
+// checkMMDBLookup 检查MMDB与CZDB对同一地址的查询结果一致
+func checkMMDBLookup(t *testing.T, dbSearcher *db.DBSearcher, reader *mmdb.Reader, addr netip.Addr, fields []MMDBField) {
+	t.Helper()
+
+	result, err := dbSearcher.SearchAddr(addr)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("查询 %s 失败: %v", addr, err)
+	}
+	value, found, lookupErr := reader.Lookup(addr)
+	if lookupErr != nil {
+		t.Fatalf("MMDB查询 %s 失败: %v", addr, lookupErr)
+	}
+
+	if found != (err == nil) {
+		t.Errorf("%s: MMDB found = %v, CZDB 错误 = %v", addr, found, err)
+		return
+	}
+	if !found {
+		return
+	}
+
+	expected, err := MMDBValue(result, fields)
+	if err != nil {
+		t.Fatalf("转换 %s 的结果失败: %v", addr, err)
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("%s: MMDB = %v, 期望 %v", addr, value, expected)
+	}
+}
+
+// TestMMDBValue 测试字段映射生成嵌套的MMDB数据
+func TestMMDBValue(t *testing.T) {
+	result := testRecords[0].Result
+	fields := []MMDBField{
+		{Key: "country.names.zh-CN", Column: 0},
+		{Key: "country.iso_code", Column: 5},
+		{Key: "subdivision", Column: 1},
+		{Key: "isp", Column: OtherDataColumn},
+	}
+
+	value, err := MMDBValue(result, fields)
+	if err != nil {
+		t.Fatalf("MMDBValue 返回错误: %v", err)
+	}
+	expected := map[string]interface{}{
+		"country":     map[string]interface{}{"names": map[string]interface{}{"zh-CN": "中国"}},
+		"subdivision": "福建",
+		"isp":         "电信",
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("MMDBValue = %v, 期望 %v", value, expected)
+	}
+
+	conflicting := []MMDBField{{Key: "country", Column: 0}, {Key: "country.name", Column: 1}}
+	if _, err := MMDBValue(result, conflicting); err == nil {
+		t.Errorf("冲突的键路径应返回错误")
+	}
+
+	for _, spec := range []string{"", "country", "country=x", "=1", "country=-1"} {
+		if _, err := ParseMMDBFields(spec); err == nil {
+			t.Errorf("ParseMMDBFields(%q) 应返回错误", spec)
+		}
+	}
+}
+
+// TestExportMMDBColumnsAndFullRange 测试字段映射使用未选中的列时返回错误，以及覆盖整个地址空间的记录可以导出
+func TestExportMMDBColumnsAndFullRange(t *testing.T) {
+	dbSearcher, err := db.InitDBSearcher("testdata/ipv4.czdb", testdb.Key, db.MEMORY)
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	defer db.CloseDBSearcher(dbSearcher)
+	fields := []MMDBField{{Key: "country", Column: 0}, {Key: "isp", Column: 4}}
+	if _, err := ExportMMDB(dbSearcher, io.Discard, MMDBOptions{Fields: fields}); err == nil {
+		t.Errorf("字段映射使用未选中的列时应返回错误")
+	}
+
+	fullRange := testdb.Open(t, 301231, []builder.Range{testdb.Range("0.0.0.0", "255.255.255.255", []string{"全部"}, "")})
+
+	var out bytes.Buffer
+	if count, err := ExportMMDB(fullRange, &out, MMDBOptions{}); err != nil || count != 1 {
+		t.Fatalf("导出覆盖整个地址空间的数据库 = %d, %v", count, err)
+	}
+	reader, err := mmdb.FromBytes(out.Bytes())
+	if err != nil {
+		t.Fatalf("打开导出的MMDB失败: %v", err)
+	}
+	for _, ip := range []string{"0.0.0.0", "1.2.3.4", "255.255.255.255"} {
+		checkMMDBLookup(t, fullRange, reader, netip.MustParseAddr(ip), DefaultMMDBFields(db.SelectedColumns(fullRange.Selection()), fullRange.Schema, nil))
+	}
+}
@@ -0,0 +1,192 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// encoder 将Go值编码为MMDB数据段格式
+//
+// 支持的类型：string、[]byte、bool、float32、float64、int32、uint16、uint32、uint64、
+// *big.Int (uint128)、map[string]interface{}、map[string]string、[]interface{} 和 []string。
+type encoder struct {
+	// pointers 记录已写入数据段的字符串，非 nil 时重复的字符串编码为指针
+	pointers map[string]uint32
+}
+
+// encode 将 value 追加到 buf 末尾，base 是 buf 起点在数据段中的偏移量
+func (enc *encoder) encode(buf []byte, base uint32, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return enc.encodeString(buf, base, v), nil
+	case []byte:
+		buf = appendControl(buf, typeBytes, len(v))
+		return append(buf, v...), nil
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		return appendControl(buf, typeBool, size), nil
+	case float64:
+		buf = appendControl(buf, typeDouble, 8)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(v)), nil
+	case float32:
+		buf = appendControl(buf, typeFloat, 4)
+		return binary.BigEndian.AppendUint32(buf, math.Float32bits(v)), nil
+	case int32:
+		return appendUint(buf, typeInt32, uint64(uint32(v))), nil
+	case uint16:
+		return appendUint(buf, typeUint16, uint64(v)), nil
+	case uint32:
+		return appendUint(buf, typeUint32, uint64(v)), nil
+	case uint64:
+		return appendUint(buf, typeUint64, v), nil
+	case *big.Int:
+		if v.Sign() < 0 || v.BitLen() > 128 {
+			return nil, fmt.Errorf("uint128 value out of range: %s", v)
+		}
+		number := v.Bytes()
+		buf = appendControl(buf, typeUint128, len(number))
+		return append(buf, number...), nil
+	case map[string]interface{}:
+		return enc.encodeMap(buf, base, len(v), func(key string) interface{} { return v[key] }, mapKeys(v))
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		return enc.encodeMap(buf, base, len(v), func(key string) interface{} { return v[key] }, keys)
+	case []interface{}:
+		buf = appendControl(buf, typeArray, len(v))
+		var err error
+		for _, item := range v {
+			if buf, err = enc.encode(buf, base, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case []string:
+		buf = appendControl(buf, typeArray, len(v))
+		for _, item := range v {
+			buf = enc.encodeString(buf, base, item)
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("unsupported MMDB value type %T", value)
+	}
+}
+
+// encodeMap 按键的字典序编码映射，保证相同内容的输出相同
+func (enc *encoder) encodeMap(buf []byte, base uint32, size int, get func(key string) interface{}, keys []string) ([]byte, error) {
+	sort.Strings(keys)
+	buf = appendControl(buf, typeMap, size)
+	var err error
+	for _, key := range keys {
+		buf = enc.encodeString(buf, base, key)
+		if buf, err = enc.encode(buf, base, get(key)); err != nil {
+			return nil, fmt.Errorf("map key %q: %w", key, err)
+		}
+	}
+	return buf, nil
+}
+
+// encodeString 编码字符串，已写入过且比指针长的字符串改为写入指针
+func (enc *encoder) encodeString(buf []byte, base uint32, value string) []byte {
+	if enc.pointers != nil {
+		if offset, ok := enc.pointers[value]; ok {
+			pointer := appendPointer(nil, offset)
+			if len(pointer) < controlSize(len(value))+len(value) {
+				return append(buf, pointer...)
+			}
+		} else {
+			enc.pointers[value] = base + uint32(len(buf))
+		}
+	}
+	buf = appendControl(buf, typeString, len(value))
+	return append(buf, value...)
+}
+
+// mapKeys 返回映射的所有键
+func mapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// appendUint 以去掉前导零字节的大端形式编码无符号整数
+func appendUint(buf []byte, fieldType int, value uint64) []byte {
+	size := 0
+	for v := value; v != 0; v >>= 8 {
+		size++
+	}
+	buf = appendControl(buf, fieldType, size)
+	for i := size - 1; i >= 0; i-- {
+		buf = append(buf, byte(value>>(8*i)))
+	}
+	return buf
+}
+
+// appendControl 写入控制字节、扩展类型字节和长度扩展字节
+func appendControl(buf []byte, fieldType int, size int) []byte {
+	var sizeBits byte
+	var extra []byte
+	switch {
+	case size < 29:
+		sizeBits = byte(size)
+	case size < 285:
+		sizeBits = 29
+		extra = []byte{byte(size - 29)}
+	case size < 65821:
+		sizeBits = 30
+		rest := size - 285
+		extra = []byte{byte(rest >> 8), byte(rest)}
+	default:
+		sizeBits = 31
+		rest := size - 65821
+		extra = []byte{byte(rest >> 16), byte(rest >> 8), byte(rest)}
+	}
+
+	if fieldType > typeMap {
+		buf = append(buf, sizeBits, byte(fieldType-7))
+	} else {
+		buf = append(buf, byte(fieldType)<<5|sizeBits)
+	}
+	return append(buf, extra...)
+}
+
+// controlSize 返回字符串控制字节及长度扩展字节的总长度
+func controlSize(size int) int {
+	switch {
+	case size < 29:
+		return 1
+	case size < 285:
+		return 2
+	case size < 65821:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// appendPointer 写入指向数据段偏移量的指针
+func appendPointer(buf []byte, offset uint32) []byte {
+	switch {
+	case offset < 1<<11:
+		return append(buf, typePointer<<5|byte(offset>>8), byte(offset))
+	case offset < 1<<11+1<<19:
+		rest := offset - 1<<11
+		return append(buf, typePointer<<5|1<<3|byte(rest>>16), byte(rest>>8), byte(rest))
+	case offset < 1<<11+1<<19+1<<27:
+		rest := offset - (1<<11 + 1<<19)
+		return append(buf, typePointer<<5|2<<3|byte(rest>>24), byte(rest>>16), byte(rest>>8), byte(rest))
+	default:
+		buf = append(buf, typePointer<<5|3<<3)
+		return binary.BigEndian.AppendUint32(buf, offset)
+	}
+}
@@ -0,0 +1,135 @@
+// Package mmdb 读写 MaxMind DB (MMDB) 格式的文件
+//
+// 格式说明见 https://maxmind.github.io/MaxMind-DB/ ，本包只依赖标准库。
+package mmdb
+
+import "fmt"
+
+// metadataStartMarker 是元数据段的起始标记
+var metadataStartMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparatorSize 是搜索树与数据段之间的 16 个零字节
+const dataSectionSeparatorSize = 16
+
+// 数据段中的字段类型
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+)
+
+// Metadata 是MMDB文件的元数据
+type Metadata struct {
+	NodeCount                uint32            // 搜索树节点数
+	RecordSize               uint16            // 每条记录的位数：24、28 或 32
+	IPVersion                uint16            // 4 或 6
+	DatabaseType             string            // 数据库类型，如 "GeoIP2-City"
+	Languages                []string          // 数据中名称使用的语言
+	BinaryFormatMajorVersion uint16            // 格式主版本，固定为 2
+	BinaryFormatMinorVersion uint16            // 格式次版本
+	BuildEpoch               uint64            // 生成时间的 Unix 时间戳
+	Description              map[string]string // 按语言区分的描述
+}
+
+// toMap 将元数据转换为写入文件的映射
+func (metadata *Metadata) toMap() map[string]interface{} {
+	languages := make([]interface{}, len(metadata.Languages))
+	for i, language := range metadata.Languages {
+		languages[i] = language
+	}
+	description := make(map[string]interface{}, len(metadata.Description))
+	for language, text := range metadata.Description {
+		description[language] = text
+	}
+
+	return map[string]interface{}{
+		"node_count":                  metadata.NodeCount,
+		"record_size":                 metadata.RecordSize,
+		"ip_version":                  metadata.IPVersion,
+		"database_type":               metadata.DatabaseType,
+		"languages":                   languages,
+		"binary_format_major_version": metadata.BinaryFormatMajorVersion,
+		"binary_format_minor_version": metadata.BinaryFormatMinorVersion,
+		"build_epoch":                 metadata.BuildEpoch,
+		"description":                 description,
+	}
+}
+
+// metadataFromMap 从解码后的映射读取元数据
+func metadataFromMap(value interface{}) (Metadata, error) {
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return Metadata{}, fmt.Errorf("metadata is %T, expected map", value)
+	}
+
+	var metadata Metadata
+	var err error
+	uintField := func(name string) uint64 {
+		if err != nil {
+			return 0
+		}
+		var number uint64
+		number, err = toUint64(fields[name])
+		if err != nil {
+			err = fmt.Errorf("metadata field %s: %v", name, err)
+		}
+		return number
+	}
+
+	metadata.NodeCount = uint32(uintField("node_count"))
+	metadata.RecordSize = uint16(uintField("record_size"))
+	metadata.IPVersion = uint16(uintField("ip_version"))
+	metadata.BinaryFormatMajorVersion = uint16(uintField("binary_format_major_version"))
+	metadata.BinaryFormatMinorVersion = uint16(uintField("binary_format_minor_version"))
+	if _, ok := fields["build_epoch"]; ok {
+		metadata.BuildEpoch = uintField("build_epoch")
+	}
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	metadata.DatabaseType, _ = fields["database_type"].(string)
+	if languages, ok := fields["languages"].([]interface{}); ok {
+		for _, language := range languages {
+			if text, ok := language.(string); ok {
+				metadata.Languages = append(metadata.Languages, text)
+			}
+		}
+	}
+	if description, ok := fields["description"].(map[string]interface{}); ok {
+		metadata.Description = make(map[string]string, len(description))
+		for language, text := range description {
+			if text, ok := text.(string); ok {
+				metadata.Description[language] = text
+			}
+		}
+	}
+	return metadata, nil
+}
+
+// toUint64 将解码出的无符号整数统一转换为 uint64
+func toUint64(value interface{}) (uint64, error) {
+	switch number := value.(type) {
+	case uint16:
+		return uint64(number), nil
+	case uint32:
+		return uint64(number), nil
+	case uint64:
+		return number, nil
+	case nil:
+		return 0, fmt.Errorf("missing")
+	default:
+		return 0, fmt.Errorf("unexpected type %T", value)
+	}
+}
@@ -0,0 +1,310 @@
+package mmdb
+
+import (
+	"bytes"
+	"math/big"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildTestMMDB 写出包含给定网络的MMDB文件并打开
+func buildTestMMDB(t *testing.T, ipVersion int, recordSize int, networks map[string]interface{}) *Reader {
+	t.Helper()
+
+	writer, err := NewWriter(ipVersion, "Test-DB")
+	if err != nil {
+		t.Fatalf("创建写入器失败: %v", err)
+	}
+	writer.RecordSize = recordSize
+	writer.Languages = []string{"zh-CN"}
+	writer.Description = map[string]string{"zh-CN": "测试数据库"}
+	writer.BuildTime = time.Unix(1700000000, 0)
+
+	for network, value := range networks {
+		if err := writer.Insert(netip.MustParsePrefix(network), value); err != nil {
+			t.Fatalf("插入 %s 失败: %v", network, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := writer.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("写出MMDB失败: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo 返回 %d 字节, 实际写出 %d 字节", n, buf.Len())
+	}
+
+	reader, err := FromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("打开MMDB失败: %v", err)
+	}
+	return reader
+}
+
+// TestRoundTrip 测试不同记录位数下写出的文件可以读回相同的数据
+func TestRoundTrip(t *testing.T) {
+	networks := map[string]interface{}{
+		"1.0.1.0/24": map[string]interface{}{"country": "中国", "city": "福州"},
+		"1.0.2.0/23": map[string]interface{}{"country": "中国", "city": "福州"},
+		"8.8.8.0/24": map[string]interface{}{"country": "美国", "isp": "Google"},
+		"10.0.0.0/8": map[string]interface{}{"country": "局域网"},
+	}
+
+	for _, recordSize := range []int{24, 28, 32} {
+		for _, ipVersion := range []int{4, 6} {
+			reader := buildTestMMDB(t, ipVersion, recordSize, networks)
+			if int(reader.Metadata.RecordSize) != recordSize || int(reader.Metadata.IPVersion) != ipVersion {
+				t.Fatalf("元数据 = %+v, 期望 record_size=%d ip_version=%d", reader.Metadata, recordSize, ipVersion)
+			}
+
+			tests := []struct {
+				ip       string
+				expected map[string]interface{}
+				network  string
+			}{
+				{"1.0.1.1", map[string]interface{}{"country": "中国", "city": "福州"}, "1.0.1.0/24"},
+				{"1.0.3.255", map[string]interface{}{"country": "中国", "city": "福州"}, "1.0.2.0/23"},
+				{"8.8.8.8", map[string]interface{}{"country": "美国", "isp": "Google"}, "8.8.8.0/24"},
+				{"10.20.30.40", map[string]interface{}{"country": "局域网"}, "10.0.0.0/8"},
+				{"1.0.0.255", nil, ""},
+				{"9.9.9.9", nil, ""},
+			}
+			if ipVersion == 6 {
+				// IPv4映射地址指向同一棵子树
+				tests = append(tests, struct {
+					ip       string
+					expected map[string]interface{}
+					network  string
+				}{"::ffff:8.8.8.8", map[string]interface{}{"country": "美国", "isp": "Google"}, "8.8.8.0/24"})
+			}
+
+			for _, test := range tests {
+				value, network, found, err := reader.LookupNetwork(netip.MustParseAddr(test.ip))
+				if err != nil {
+					t.Fatalf("[%d/%d] 查询 %s 失败: %v", ipVersion, recordSize, test.ip, err)
+				}
+				if found != (test.expected != nil) {
+					t.Errorf("[%d/%d] %s found = %v, 期望 %v", ipVersion, recordSize, test.ip, found, test.expected != nil)
+					continue
+				}
+				if !found {
+					continue
+				}
+				if !reflect.DeepEqual(value, test.expected) {
+					t.Errorf("[%d/%d] %s = %v, 期望 %v", ipVersion, recordSize, test.ip, value, test.expected)
+				}
+				if network.String() != test.network {
+					t.Errorf("[%d/%d] %s 网络 = %s, 期望 %s", ipVersion, recordSize, test.ip, network, test.network)
+				}
+			}
+		}
+	}
+}
+
+// TestIPv6Tree 测试IPv6网络的写入和查询
+func TestIPv6Tree(t *testing.T) {
+	reader := buildTestMMDB(t, 6, 0, map[string]interface{}{
+		"2001:db8::/112":  map[string]interface{}{"country": "文档"},
+		"2400:3200::/32":  map[string]interface{}{"country": "中国", "isp": "阿里云"},
+		"2606:4700::/112": map[string]interface{}{"country": "美国"},
+	})
+
+	value, found, err := reader.Lookup(netip.MustParseAddr("2400:3200:1::1"))
+	if err != nil || !found {
+		t.Fatalf("查询 2400:3200:1::1 = %v, %v, %v", value, found, err)
+	}
+	if value.(map[string]interface{})["isp"] != "阿里云" {
+		t.Errorf("2400:3200:1::1 = %v", value)
+	}
+
+	if _, found, _ := reader.Lookup(netip.MustParseAddr("2001:db8::1:0")); found {
+		t.Errorf("2001:db8::1:0 不应找到")
+	}
+	if _, found, _ := reader.Lookup(netip.MustParseAddr("8.8.8.8")); found {
+		t.Errorf("没有IPv4数据时 8.8.8.8 不应找到")
+	}
+}
+
+// TestFullAddressSpace 测试覆盖整个地址空间的 /0 网络
+func TestFullAddressSpace(t *testing.T) {
+	tests := []struct {
+		ipVersion int
+		network   string
+		ips       []string
+	}{
+		{4, "0.0.0.0/0", []string{"0.0.0.0", "1.2.3.4", "255.255.255.255"}},
+		{6, "::/0", []string{"::", "1.2.3.4", "2400:3200::1", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"}},
+	}
+	for _, test := range tests {
+		reader := buildTestMMDB(t, test.ipVersion, 0, map[string]interface{}{test.network: "全部"})
+		for _, ip := range test.ips {
+			value, found, err := reader.Lookup(netip.MustParseAddr(ip))
+			if err != nil || !found || value != "全部" {
+				t.Errorf("%s: 查询 %s = %v, %v, %v", test.network, ip, value, found, err)
+			}
+		}
+	}
+}
+
+// TestIPv4MappedAlias 测试 ::ffff:0:0/96 指向IPv4数据，包括 ::/96 本身是数据记录的情况
+//
+// Reader 查询前会 Unmap，这里沿树直接查找映射地址，模拟不做转换的其他读取器。
+func TestIPv4MappedAlias(t *testing.T) {
+	for _, network := range []string{"1.2.3.0/24", "0.0.0.0/0", "0.0.0.0/1"} {
+		reader := buildTestMMDB(t, 6, 0, map[string]interface{}{network: "IPv4"})
+
+		walk := func(addr netip.Addr) uint32 {
+			ip := addr.As16()
+			node := uint32(0)
+			for depth := 0; depth < 128 && node < reader.nodeCount; depth++ {
+				node = reader.readNode(node, int(ip[depth/8]>>(7-depth%8)&1))
+			}
+			return node
+		}
+		mapped := walk(netip.MustParseAddr("::ffff:1.2.3.4"))
+		if mapped <= reader.nodeCount || mapped != walk(netip.MustParseAddr("::1.2.3.4")) {
+			t.Errorf("%s: ::ffff:1.2.3.4 的记录 = %d, ::1.2.3.4 的记录 = %d", network, mapped, walk(netip.MustParseAddr("::1.2.3.4")))
+		}
+	}
+}
+
+// TestValueTypes 测试所有支持的数据类型可以往返
+func TestValueTypes(t *testing.T) {
+	value := map[string]interface{}{
+		"string":  "hello",
+		"long":    strings.Repeat("x", 70000),
+		"bytes":   []byte{1, 2, 3},
+		"true":    true,
+		"false":   false,
+		"double":  3.14159,
+		"float":   float32(1.5),
+		"int32":   int32(-123456),
+		"uint16":  uint16(65535),
+		"uint32":  uint32(0),
+		"uint64":  uint64(1) << 63,
+		"uint128": new(big.Int).Lsh(big.NewInt(1), 127),
+		"array":   []interface{}{"a", uint32(1), []interface{}{}},
+		"map":     map[string]interface{}{"names": map[string]interface{}{"en": "China", "zh-CN": "中国"}},
+	}
+
+	reader := buildTestMMDB(t, 4, 0, map[string]interface{}{"1.2.3.0/24": value})
+	got, found, err := reader.Lookup(netip.MustParseAddr("1.2.3.4"))
+	if err != nil || !found {
+		t.Fatalf("查询失败: %v, %v", found, err)
+	}
+	gotMap := got.(map[string]interface{})
+	for key, expected := range value {
+		actual := gotMap[key]
+		if bigValue, ok := expected.(*big.Int); ok {
+			if bigValue.Cmp(actual.(*big.Int)) != 0 {
+				t.Errorf("%s = %v, 期望 %v", key, actual, expected)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s = %#v, 期望 %#v", key, actual, expected)
+		}
+	}
+
+	if _, err := NewWriter(5, ""); err == nil {
+		t.Errorf("无效的IP版本应返回错误")
+	}
+	writer, _ := NewWriter(4, "")
+	if err := writer.Insert(netip.MustParsePrefix("1.0.0.0/8"), 42); err == nil {
+		t.Errorf("不支持的数据类型应返回错误")
+	}
+	if err := writer.Insert(netip.MustParsePrefix("2001:db8::/32"), "x"); err == nil {
+		t.Errorf("IPv4树中插入IPv6网络应返回错误")
+	}
+}
+
+// TestDeduplication 测试相同的数据只写入一次，重复的字符串以指针引用
+func TestDeduplication(t *testing.T) {
+	write := func(count int, distinct bool) int {
+		writer, _ := NewWriter(4, "")
+		for i := 0; i < count; i++ {
+			value := map[string]interface{}{"country": "中华人民共和国", "isp": "中国电信"}
+			if distinct {
+				value["index"] = uint32(i)
+			}
+			writer.Insert(netip.PrefixFrom(netip.AddrFrom4([4]byte{1, byte(i), 0, 0}), 16), value)
+		}
+		return len(writer.data)
+	}
+
+	if single, repeated := write(1, false), write(100, false); single != repeated {
+		t.Errorf("相同数据写入 100 次后数据段为 %d 字节, 期望 %d", repeated, single)
+	}
+	// 不同的记录中重复的键和值使用指针，每条记录远小于完整编码
+	if size := write(100, true); size > write(1, true)+99*16 {
+		t.Errorf("100 条记录的数据段为 %d 字节，字符串没有去重", size)
+	}
+}
+
+// TestMetadata 测试元数据往返
+func TestMetadata(t *testing.T) {
+	reader := buildTestMMDB(t, 6, 0, map[string]interface{}{"1.0.0.0/24": "x"})
+	metadata := reader.Metadata
+	if metadata.DatabaseType != "Test-DB" || metadata.BinaryFormatMajorVersion != 2 || metadata.BuildEpoch != 1700000000 {
+		t.Errorf("元数据 = %+v", metadata)
+	}
+	if !reflect.DeepEqual(metadata.Languages, []string{"zh-CN"}) || metadata.Description["zh-CN"] != "测试数据库" {
+		t.Errorf("元数据语言或描述 = %v, %v", metadata.Languages, metadata.Description)
+	}
+
+	if _, err := FromBytes([]byte("not an mmdb file")); err == nil {
+		t.Errorf("无效文件应返回错误")
+	}
+}
+
+// TestDecoderVectors 测试格式规范中的编码示例
+func TestDecoderVectors(t *testing.T) {
+	tests := []struct {
+		encoded  []byte
+		expected interface{}
+	}{
+		{[]byte{0x43, 'f', 'o', 'o'}, "foo"},
+		{[]byte{0xa0}, uint16(0)},
+		{[]byte{0xa2, 0x01, 0xf4}, uint16(500)},
+		{[]byte{0xc4, 0xff, 0xff, 0xff, 0xff}, uint32(4294967295)},
+		{[]byte{0x04, 0x01, 0xff, 0xff, 0xff, 0xff}, int32(-1)},
+		{[]byte{0x01, 0x07}, true},
+		{[]byte{0x00, 0x07}, false},
+		{[]byte{0x01, 0x04, 0x43, 'f', 'o', 'o'}, []interface{}{"foo"}},
+		{[]byte{0xe1, 0x42, 'e', 'n', 0x43, 'G', 'o', '!'}, map[string]interface{}{"en": "Go!"}},
+	}
+
+	for _, test := range tests {
+		dec := decoder{buffer: test.encoded}
+		value, next, err := dec.decode(0, 0)
+		if err != nil {
+			t.Errorf("解码 % x 失败: %v", test.encoded, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.expected) || next != uint(len(test.encoded)) {
+			t.Errorf("解码 % x = %#v (结束于 %d), 期望 %#v", test.encoded, value, next, test.expected)
+		}
+
+		encoded, err := (&encoder{}).encode(nil, 0, test.expected)
+		if err != nil || !bytes.Equal(encoded, test.encoded) {
+			t.Errorf("编码 %#v = % x, 期望 % x", test.expected, encoded, test.encoded)
+		}
+	}
+
+	for _, offset := range []uint32{0, 2047, 2048, 526335, 526336, 134744063, 134744064, 1 << 31} {
+		buf := appendPointer(nil, offset)
+		dec := decoder{buffer: buf}
+		fieldType, size, next, err := dec.decodeControl(0)
+		if err != nil || fieldType != typePointer {
+			t.Fatalf("指针 %d 控制字节解析失败: %v", offset, err)
+		}
+		pointer, _, err := dec.decodePointer(size, next)
+		if err != nil || pointer != uint(offset) {
+			t.Errorf("指针 %d 解码为 %d, %v", offset, pointer, err)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+)
+
+// ErrInvalidDatabase 表示MMDB文件格式错误
+var ErrInvalidDatabase = errors.New("invalid MMDB database")
+
+// maxMetadataSize 是在文件末尾查找元数据标记的范围
+const maxMetadataSize = 128 * 1024
+
+// Reader 在内存中的MMDB文件上查询网络数据，可并发使用
+type Reader struct {
+	Metadata Metadata // 文件元数据
+
+	buffer    []byte
+	data      []byte // 数据段，不含元数据
+	nodeCount uint32
+	nodeSize  int    // 每个节点的字节数
+	ipv4Start uint32 // IPv6树中 ::/96 对应的节点
+	ipv4Depth int    // 到达 ipv4Start 经过的位数
+	treeSize  int
+}
+
+// Open 读取并打开MMDB文件
+//
+// 参数:
+//   - path: MMDB文件路径
+//
+// 返回:
+//   - *Reader: MMDB读取器
+//   - error: 如果读取失败或格式错误则返回错误
+func Open(path string) (*Reader, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MMDB file: %v", err)
+	}
+	return FromBytes(buffer)
+}
+
+// FromBytes 从内存中的MMDB文件内容创建读取器，调用方不得再修改 buffer
+//
+// 参数:
+//   - buffer: 完整的MMDB文件内容
+//
+// 返回:
+//   - *Reader: MMDB读取器
+//   - error: 如果格式错误则返回错误
+func FromBytes(buffer []byte) (*Reader, error) {
+	searchStart := len(buffer) - maxMetadataSize
+	if searchStart < 0 {
+		searchStart = 0
+	}
+	markerIndex := bytes.LastIndex(buffer[searchStart:], metadataStartMarker)
+	if markerIndex < 0 {
+		return nil, fmt.Errorf("%w: metadata start marker not found", ErrInvalidDatabase)
+	}
+	metadataStart := searchStart + markerIndex + len(metadataStartMarker)
+
+	metadataDecoder := decoder{buffer: buffer[metadataStart:]}
+	value, _, err := metadataDecoder.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrInvalidDatabase, err)
+	}
+	metadata, err := metadataFromMap(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDatabase, err)
+	}
+
+	if metadata.RecordSize != 24 && metadata.RecordSize != 28 && metadata.RecordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, metadata.RecordSize)
+	}
+	if metadata.IPVersion != 4 && metadata.IPVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", ErrInvalidDatabase, metadata.IPVersion)
+	}
+
+	reader := &Reader{
+		Metadata:  metadata,
+		buffer:    buffer,
+		nodeCount: metadata.NodeCount,
+		nodeSize:  int(metadata.RecordSize) / 4,
+	}
+	reader.treeSize = int(metadata.NodeCount) * reader.nodeSize
+	dataStart := reader.treeSize + dataSectionSeparatorSize
+	dataEnd := metadataStart - len(metadataStartMarker)
+	if dataStart > dataEnd {
+		return nil, fmt.Errorf("%w: search tree of %d nodes exceeds file size", ErrInvalidDatabase, metadata.NodeCount)
+	}
+	reader.data = buffer[dataStart:dataEnd]
+
+	if metadata.IPVersion == 6 {
+		node := uint32(0)
+		depth := 0
+		for ; depth < 96 && node < reader.nodeCount; depth++ {
+			node = reader.readNode(node, 0)
+		}
+		reader.ipv4Start, reader.ipv4Depth = node, depth
+	}
+	return reader, nil
+}
+
+// Lookup 查询IP地址所在网络的数据
+//
+// 参数:
+//   - addr: 要查询的IP地址，IPv4映射的IPv6地址按IPv4处理
+//
+// 返回:
+//   - interface{}: 解码后的数据，映射为 map[string]interface{}，数组为 []interface{}
+//   - bool: 是否找到
+//   - error: 如果地址无效或数据损坏则返回错误
+func (reader *Reader) Lookup(addr netip.Addr) (interface{}, bool, error) {
+	value, _, found, err := reader.LookupNetwork(addr)
+	return value, found, err
+}
+
+// LookupNetwork 查询IP地址所在网络的数据，同时返回该网络
+//
+// 参数:
+//   - addr: 要查询的IP地址
+//
+// 返回:
+//   - interface{}: 解码后的数据
+//   - netip.Prefix: 地址所在的网络，未找到时为包含该地址的空网络
+//   - bool: 是否找到
+//   - error: 如果地址无效或数据损坏则返回错误
+func (reader *Reader) LookupNetwork(addr netip.Addr) (interface{}, netip.Prefix, bool, error) {
+	if !addr.IsValid() {
+		return nil, netip.Prefix{}, false, fmt.Errorf("invalid IP address")
+	}
+	addr = addr.Unmap().WithZone("")
+	if addr.Is6() && reader.Metadata.IPVersion == 4 {
+		return nil, netip.Prefix{}, false, fmt.Errorf("cannot look up IPv6 address %s in an IPv4 database", addr)
+	}
+
+	ip := addr.AsSlice()
+	bitCount := len(ip) * 8
+	node, depth := uint32(0), 0
+	if addr.Is4() && reader.Metadata.IPVersion == 6 {
+		node, depth = reader.ipv4Start, reader.ipv4Depth
+		bitCount += 96
+		ip = append(make([]byte, 12), ip...)
+	}
+
+	for ; depth < bitCount && node < reader.nodeCount; depth++ {
+		bit := ip[depth/8] >> (7 - depth%8) & 1
+		node = reader.readNode(node, int(bit))
+	}
+
+	prefixBits := depth
+	if addr.Is4() && reader.Metadata.IPVersion == 6 {
+		prefixBits -= 96
+		if prefixBits < 0 {
+			prefixBits = 0
+		}
+	}
+	prefix, _ := addr.Prefix(prefixBits)
+
+	switch {
+	case node == reader.nodeCount:
+		return nil, prefix, false, nil
+	case node < reader.nodeCount:
+		return nil, netip.Prefix{}, false, fmt.Errorf("%w: search tree deeper than address length", ErrInvalidDatabase)
+	}
+
+	offset := uint64(node) - uint64(reader.nodeCount) - dataSectionSeparatorSize
+	if offset >= uint64(len(reader.data)) {
+		return nil, netip.Prefix{}, false, fmt.Errorf("%w: data pointer %d out of range", ErrInvalidDatabase, offset)
+	}
+	dataDecoder := decoder{buffer: reader.data}
+	value, _, err := dataDecoder.decode(uint(offset), 0)
+	if err != nil {
+		return nil, netip.Prefix{}, false, fmt.Errorf("%w: %v", ErrInvalidDatabase, err)
+	}
+	return value, prefix, true, nil
+}
+
+// readNode 读取节点的左 (bit=0) 或右 (bit=1) 记录
+func (reader *Reader) readNode(node uint32, bit int) uint32 {
+	offset := int(node) * reader.nodeSize
+	if offset+reader.nodeSize > reader.treeSize {
+		return reader.nodeCount
+	}
+	b := reader.buffer[offset : offset+reader.nodeSize]
+
+	switch reader.Metadata.RecordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	case 28:
+		if bit == 0 {
+			return uint32(b[3]&0xf0)<<20 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		}
+		return uint32(b[3]&0x0f)<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6])
+	default:
+		return binary.BigEndian.Uint32(b[bit*4:])
+	}
+}
+
+// maxDecodeDepth 限制嵌套层数，防止损坏的文件导致无限递归
+const maxDecodeDepth = 512
+
+// decoder 解码MMDB数据段
+type decoder struct {
+	buffer []byte
+}
+
+// decode 解码 offset 处的值，返回值和下一个字段的偏移量
+func (dec *decoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, fmt.Errorf("data nested too deeply")
+	}
+
+	fieldType, size, offset, err := dec.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if fieldType == typePointer {
+		pointer, next, err := dec.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		if pointer < uint(len(dec.buffer)) && dec.buffer[pointer]>>5 == typePointer {
+			return nil, 0, fmt.Errorf("pointer at %d points to another pointer", offset)
+		}
+		value, _, err := dec.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	switch fieldType {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := dec.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key at %d is %T, expected string", offset, key)
+			}
+			value, next, err := dec.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[keyString] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		array := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := dec.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			array = append(array, value)
+			offset = next
+		}
+		return array, offset, nil
+	case typeBool:
+		if size > 1 {
+			return nil, 0, fmt.Errorf("invalid bool size %d at %d", size, offset)
+		}
+		return size == 1, offset, nil
+	}
+
+	end := offset + size
+	if end > uint(len(dec.buffer)) || end < offset {
+		return nil, 0, fmt.Errorf("field of %d bytes at %d exceeds data section", size, offset)
+	}
+	payload := dec.buffer[offset:end]
+
+	switch fieldType {
+	case typeString:
+		return string(payload), end, nil
+	case typeBytes:
+		return append([]byte(nil), payload...), end, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d at %d", size, offset)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), end, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d at %d", size, offset)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(payload)), end, nil
+	case typeUint16:
+		if size > 2 {
+			return nil, 0, fmt.Errorf("invalid uint16 size %d at %d", size, offset)
+		}
+		return uint16(decodeUint(payload)), end, nil
+	case typeUint32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid uint32 size %d at %d", size, offset)
+		}
+		return uint32(decodeUint(payload)), end, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %d at %d", size, offset)
+		}
+		return int32(uint32(decodeUint(payload))), end, nil
+	case typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid uint64 size %d at %d", size, offset)
+		}
+		return decodeUint(payload), end, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("invalid uint128 size %d at %d", size, offset)
+		}
+		return new(big.Int).SetBytes(payload), end, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown field type %d at %d", fieldType, offset)
+	}
+}
+
+// decodeControl 解析控制字节，返回类型、长度 (指针为大小位) 和负载的偏移量
+func (dec *decoder) decodeControl(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(dec.buffer)) {
+		return 0, 0, 0, fmt.Errorf("unexpected end of data at %d", offset)
+	}
+	control := dec.buffer[offset]
+	offset++
+
+	fieldType := int(control >> 5)
+	if fieldType == typePointer {
+		return fieldType, uint(control & 0x1f), offset, nil
+	}
+	if fieldType == typeExtended {
+		if offset >= uint(len(dec.buffer)) {
+			return 0, 0, 0, fmt.Errorf("unexpected end of data at %d", offset)
+		}
+		fieldType = int(dec.buffer[offset]) + 7
+		offset++
+		if fieldType <= typeMap {
+			return 0, 0, 0, fmt.Errorf("invalid extended type %d at %d", fieldType, offset-1)
+		}
+	}
+
+	size := uint(control & 0x1f)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(dec.buffer)) {
+			return 0, 0, 0, fmt.Errorf("unexpected end of data at %d", offset)
+		}
+		rest := uint(decodeUint(dec.buffer[offset : offset+extra]))
+		offset += extra
+		switch extra {
+		case 1:
+			size = 29 + rest
+		case 2:
+			size = 285 + rest
+		default:
+			size = 65821 + rest
+		}
+	}
+	return fieldType, size, offset, nil
+}
+
+// decodePointer 解析指针，sizeBits 是控制字节的低 5 位
+func (dec *decoder) decodePointer(sizeBits uint, offset uint) (uint, uint, error) {
+	pointerSize := sizeBits>>3 + 1
+	if offset+pointerSize > uint(len(dec.buffer)) {
+		return 0, 0, fmt.Errorf("unexpected end of data at %d", offset)
+	}
+	payload := dec.buffer[offset : offset+pointerSize]
+	next := offset + pointerSize
+
+	prefix := uint(sizeBits & 0x7)
+	switch pointerSize {
+	case 1:
+		return prefix<<8 | uint(payload[0]), next, nil
+	case 2:
+		return (prefix<<16 | uint(decodeUint(payload))) + 1<<11, next, nil
+	case 3:
+		return (prefix<<24 | uint(decodeUint(payload))) + 1<<11 + 1<<19, next, nil
+	default:
+		return uint(decodeUint(payload)), next, nil
+	}
+}
+
+// decodeUint 按大端解码无符号整数
+func decodeUint(b []byte) uint64 {
+	var value uint64
+	for _, c := range b {
+		value = value<<8 | uint64(c)
+	}
+	return value
+}
@@ -0,0 +1,286 @@
+package mmdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"time"
+)
+
+// ipv4MappedPrefix 是IPv4映射地址所在的前缀，IPv6树中将其指向IPv4子树
+var ipv4MappedPrefix = netip.MustParsePrefix("::ffff:0:0/96")
+
+// Writer 在内存中构建MMDB搜索树和数据段
+//
+// IPv6树中的IPv4网络插入到 ::/96 下，写出时 ::ffff:0:0/96 指向同一棵子树。
+// 相同的数据只写入一次，重复的字符串以指针引用。
+type Writer struct {
+	DatabaseType string            // 数据库类型
+	Languages    []string          // 数据中名称使用的语言
+	Description  map[string]string // 按语言区分的描述
+	RecordSize   int               // 记录位数，为 0 时按文件大小自动选择 24、28 或 32
+	BuildTime    time.Time         // 生成时间，为零值时使用写出的时间
+
+	ipVersion int
+	// nodes 是搜索树节点的左右子记录：0 表示空，正数为节点编号，
+	// 负数 -(offset+1) 表示数据段中的偏移量
+	nodes   [][2]int64
+	data    []byte
+	records map[string]uint32 // 不含指针的编码结果到数据段偏移量
+	enc     encoder
+}
+
+// NewWriter 创建MMDB写入器
+//
+// 参数:
+//   - ipVersion: 4 或 6，IPv6树同时可以存放IPv4网络
+//   - databaseType: 写入元数据的数据库类型
+//
+// 返回:
+//   - *Writer: MMDB写入器
+//   - error: 如果 ipVersion 无效则返回错误
+func NewWriter(ipVersion int, databaseType string) (*Writer, error) {
+	if ipVersion != 4 && ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version: %d", ipVersion)
+	}
+	return &Writer{
+		DatabaseType: databaseType,
+		ipVersion:    ipVersion,
+		nodes:        make([][2]int64, 1),
+		records:      map[string]uint32{},
+		enc:          encoder{pointers: map[string]uint32{}},
+	}, nil
+}
+
+// Insert 插入一个网络及其数据，与已有网络重叠的部分被覆盖
+//
+// 参数:
+//   - prefix: 网络前缀，IPv4树中只能插入IPv4网络
+//   - value: 网络对应的数据，通常为 map[string]interface{}
+//
+// 返回:
+//   - error: 如果前缀或数据无效则返回错误
+func (writer *Writer) Insert(prefix netip.Prefix, value interface{}) error {
+	if !prefix.IsValid() {
+		return fmt.Errorf("invalid prefix: %v", prefix)
+	}
+	prefix = prefix.Masked()
+	addr := prefix.Addr()
+	bits := prefix.Bits()
+	if addr.Is4() && writer.ipVersion == 6 {
+		// IPv4网络位于 ::/96 下
+		var ip16 [16]byte
+		ip4 := addr.As4()
+		copy(ip16[12:], ip4[:])
+		addr = netip.AddrFrom16(ip16)
+		bits += 96
+	} else if addr.Is6() && writer.ipVersion == 4 {
+		return fmt.Errorf("cannot insert IPv6 network %s into an IPv4 tree", prefix)
+	}
+
+	offset, err := writer.store(value)
+	if err != nil {
+		return err
+	}
+	record := -int64(offset) - 1
+	if bits == 0 {
+		// 整个地址空间：根节点本身不能是数据记录，让它的两个子记录都指向数据
+		writer.nodes[0] = [2]int64{record, record}
+		return nil
+	}
+	writer.insert(addr.AsSlice(), bits, record)
+	return nil
+}
+
+// store 将数据写入数据段并返回偏移量，相同的数据只写入一次
+func (writer *Writer) store(value interface{}) (uint32, error) {
+	// 先编码不含指针的形式作为去重的键，同时检查数据类型
+	key, err := (&encoder{}).encode(nil, 0, value)
+	if err != nil {
+		return 0, err
+	}
+	if offset, ok := writer.records[string(key)]; ok {
+		return offset, nil
+	}
+
+	offset := uint32(len(writer.data))
+	writer.data, _ = writer.enc.encode(writer.data, 0, value)
+	writer.records[string(key)] = offset
+	return offset, nil
+}
+
+// insert 沿地址的前 bits 位找到或创建节点，并将最后一位对应的记录设置为 record
+func (writer *Writer) insert(ip []byte, bits int, record int64) {
+	node := int64(0)
+	for depth := 0; depth < bits-1; depth++ {
+		bit := ip[depth/8] >> (7 - depth%8) & 1
+		child := writer.nodes[node][bit]
+		if child <= 0 {
+			// 空记录或数据记录：创建新节点，数据记录下放到两个子记录
+			writer.nodes = append(writer.nodes, [2]int64{child, child})
+			child = int64(len(writer.nodes) - 1)
+			writer.nodes[node][bit] = child
+		}
+		node = child
+	}
+	bit := ip[(bits-1)/8] >> (7 - (bits-1)%8) & 1
+	writer.nodes[node][bit] = record
+}
+
+// aliasIPv4 让 ::ffff:0:0/96 指向 ::/96 下的IPv4子树
+func (writer *Writer) aliasIPv4() {
+	if writer.ipVersion != 6 {
+		return
+	}
+
+	// 查找 ::/96 对应的记录，遇到数据记录时整个 ::/96 都是这条数据 (如插入了IPv4的 0.0.0.0/0)，
+	// 以它作为别名的目标
+	ipv4Root := int64(0)
+	for depth := 0; depth < 96; depth++ {
+		ipv4Root = writer.nodes[ipv4Root][0]
+		if ipv4Root == 0 {
+			return
+		}
+		if ipv4Root < 0 {
+			break
+		}
+	}
+
+	// 沿 ::ffff:0:0/96 创建节点，已有其他数据时不覆盖
+	ip := ipv4MappedPrefix.Addr().AsSlice()
+	node := int64(0)
+	for depth := 0; depth < 95; depth++ {
+		bit := ip[depth/8] >> (7 - depth%8) & 1
+		child := writer.nodes[node][bit]
+		if child < 0 {
+			return
+		}
+		if child == 0 {
+			writer.nodes = append(writer.nodes, [2]int64{})
+			child = int64(len(writer.nodes) - 1)
+			writer.nodes[node][bit] = child
+		}
+		node = child
+	}
+	if writer.nodes[node][1] == 0 {
+		writer.nodes[node][1] = ipv4Root
+	}
+}
+
+// WriteTo 将MMDB文件写入 w
+//
+// 参数:
+//   - w: 输出目标
+//
+// 返回:
+//   - int64: 写入的字节数
+//   - error: 如果写入失败或数据过大则返回错误
+func (writer *Writer) WriteTo(w io.Writer) (int64, error) {
+	writer.aliasIPv4()
+
+	nodeCount := int64(len(writer.nodes))
+	maxRecord := nodeCount + dataSectionSeparatorSize + int64(len(writer.data))
+	recordSize := writer.RecordSize
+	if recordSize == 0 {
+		switch {
+		case maxRecord < 1<<24:
+			recordSize = 24
+		case maxRecord < 1<<28:
+			recordSize = 28
+		default:
+			recordSize = 32
+		}
+	}
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return 0, fmt.Errorf("unsupported record size: %d", recordSize)
+	}
+	if maxRecord >= 1<<recordSize {
+		return 0, fmt.Errorf("database too large for %d-bit records", recordSize)
+	}
+
+	buildTime := writer.BuildTime
+	if buildTime.IsZero() {
+		buildTime = time.Now()
+	}
+	metadata := Metadata{
+		NodeCount:                uint32(nodeCount),
+		RecordSize:               uint16(recordSize),
+		IPVersion:                uint16(writer.ipVersion),
+		DatabaseType:             writer.DatabaseType,
+		Languages:                writer.Languages,
+		BinaryFormatMajorVersion: 2,
+		BinaryFormatMinorVersion: 0,
+		BuildEpoch:               uint64(buildTime.Unix()),
+		Description:              writer.Description,
+	}
+	metadataBytes, err := (&encoder{}).encode(nil, 0, metadata.toMap())
+	if err != nil {
+		return 0, err
+	}
+
+	out := &countingWriter{w: bufio.NewWriter(w)}
+	nodeBytes := make([]byte, recordSize/4)
+	for _, node := range writer.nodes {
+		left := recordValue(node[0], nodeCount)
+		right := recordValue(node[1], nodeCount)
+		switch recordSize {
+		case 24:
+			putUint24(nodeBytes[0:], left)
+			putUint24(nodeBytes[3:], right)
+		case 28:
+			putUint24(nodeBytes[0:], left)
+			nodeBytes[3] = byte(left>>24&0x0f)<<4 | byte(right>>24&0x0f)
+			putUint24(nodeBytes[4:], right)
+		case 32:
+			putUint32(nodeBytes[0:], left)
+			putUint32(nodeBytes[4:], right)
+		}
+		out.write(nodeBytes)
+	}
+	out.write(make([]byte, dataSectionSeparatorSize))
+	out.write(writer.data)
+	out.write(metadataStartMarker)
+	out.write(metadataBytes)
+
+	if out.err == nil {
+		out.err = out.w.Flush()
+	}
+	return out.n, out.err
+}
+
+// recordValue 将内部记录转换为文件中的记录值
+func recordValue(record int64, nodeCount int64) uint32 {
+	switch {
+	case record == 0:
+		return uint32(nodeCount)
+	case record > 0:
+		return uint32(record)
+	default:
+		return uint32(nodeCount + dataSectionSeparatorSize - record - 1)
+	}
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v)
+}
+
+func putUint32(b []byte, v uint32) {
+	b[0], b[1], b[2], b[3] = byte(v>>24), byte(v>>16), byte(v>>8), byte(v)
+}
+
+// countingWriter 记录写入的字节数和第一个错误
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) write(p []byte) {
+	if cw.err != nil {
+		return
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+}
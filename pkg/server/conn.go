@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrServerClosed 在调用 Shutdown 或 Close 之后由 Serve 返回
+var ErrServerClosed = errors.New("server closed")
+
+// connTracker 记录服务的监听器和连接，用于优雅关闭，零值可以直接使用
+type connTracker struct {
+	mu        sync.Mutex
+	listeners map[io.Closer]struct{} // net.Listener 或 net.PacketConn
+	conns     map[net.Conn]struct{}
+	closing   atomic.Bool
+	wg        sync.WaitGroup // 进行中的连接和请求
+}
+
+// addListener 记录监听器，服务已关闭时返回 false
+func (tracker *connTracker) addListener(listener io.Closer) bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if tracker.closing.Load() {
+		return false
+	}
+	if tracker.listeners == nil {
+		tracker.listeners = make(map[io.Closer]struct{})
+	}
+	tracker.listeners[listener] = struct{}{}
+	return true
+}
+
+// removeListener 移除监听器的记录
+func (tracker *connTracker) removeListener(listener io.Closer) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	delete(tracker.listeners, listener)
+}
+
+// addConn 记录连接并计入进行中的任务，服务已关闭时返回 false
+func (tracker *connTracker) addConn(conn net.Conn) bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if tracker.closing.Load() {
+		return false
+	}
+	if tracker.conns == nil {
+		tracker.conns = make(map[net.Conn]struct{})
+	}
+	tracker.conns[conn] = struct{}{}
+	tracker.wg.Add(1)
+	return true
+}
+
+// removeConn 移除连接的记录
+func (tracker *connTracker) removeConn(conn net.Conn) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	delete(tracker.conns, conn)
+	tracker.wg.Done()
+}
+
+// addTask 计入一个不属于连接的进行中任务 (如一个UDP请求)，服务已关闭时返回 false
+func (tracker *connTracker) addTask() bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if tracker.closing.Load() {
+		return false
+	}
+	tracker.wg.Add(1)
+	return true
+}
+
+// doneTask 结束 addTask 计入的任务
+func (tracker *connTracker) doneTask() {
+	tracker.wg.Done()
+}
+
+// waitRead 在读取下一个请求之前设置读取期限，服务正在关闭时返回 false
+//
+// 在设置期限之后检查关闭状态，避免覆盖 shutdown 为打断读取而设置的期限。
+func (tracker *connTracker) waitRead(conn net.Conn, idleTimeout time.Duration) bool {
+	var deadline time.Time
+	if idleTimeout > 0 {
+		deadline = time.Now().Add(idleTimeout)
+	}
+	conn.SetReadDeadline(deadline)
+	return !tracker.closing.Load()
+}
+
+// shutdown 关闭所有监听器，打断空闲连接上阻塞的读取，并等待进行中的任务结束
+//
+// 参数:
+//   - ctx: 等待的期限，到期后强制关闭剩余的连接
+//
+// 返回:
+//   - error: 等待期限到期时返回 ctx.Err()
+func (tracker *connTracker) shutdown(ctx context.Context) error {
+	tracker.mu.Lock()
+	tracker.closing.Store(true)
+	for listener := range tracker.listeners {
+		listener.Close()
+	}
+	// 正在处理请求的连接在写出响应后由 waitRead 发现服务正在关闭
+	for conn := range tracker.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	tracker.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		tracker.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		tracker.close()
+		return ctx.Err()
+	}
+}
+
+// close 立即关闭所有监听器和连接
+func (tracker *connTracker) close() error {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	tracker.closing.Store(true)
+	for listener := range tracker.listeners {
+		listener.Close()
+	}
+	for conn := range tracker.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+// acceptLoop 在 listener 上接受连接，为每个连接启动一个 goroutine 调用 handle
+//
+// handle 返回前需调用 tracker.removeConn。Serve 之类的方法返回时 listener 已被关闭。
+//
+// 参数:
+//   - tracker: 记录监听器和连接
+//   - listener: 监听器
+//   - logger: 记录暂时性的 accept 错误
+//   - handle: 处理一个连接
+//
+// 返回:
+//   - error: 总是返回非 nil 的错误，服务关闭后返回 ErrServerClosed
+func acceptLoop(tracker *connTracker, listener net.Listener, logger *log.Logger, handle func(net.Conn)) error {
+	if !tracker.addListener(listener) {
+		listener.Close()
+		return ErrServerClosed
+	}
+	defer tracker.removeListener(listener)
+	defer listener.Close()
+
+	var delay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if tracker.closing.Load() {
+				return ErrServerClosed
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			// 与 net/http 相同，其他错误 (如文件描述符耗尽) 通常是暂时的，退避后重试
+			if delay = delay * 2; delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay > time.Second {
+				delay = time.Second
+			}
+			logger.Printf("accept error: %v; retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		if !tracker.addConn(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go handle(conn)
+	}
+}
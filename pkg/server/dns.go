@@ -0,0 +1,368 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+)
+
+// 默认的DNS服务配置
+const (
+	DefaultDNSTTL         = 300
+	DefaultDNSIdleTimeout = 10 * time.Second
+)
+
+// DNSConfig DNS 查询服务的配置
+type DNSConfig struct {
+	Zone        string        // 查询名称的后缀，如 "geo.internal"
+	TTL         uint32        // 应答的 TTL 秒数，默认 DefaultDNSTTL
+	IdleTimeout time.Duration // TCP 连接空闲超过该时间后关闭，默认 DefaultDNSIdleTimeout
+	Logger      *log.Logger   // 记录服务端错误，默认使用 log.Default()
+}
+
+// DNSServer 通过 DNS TXT 记录提供IP查询，可以直接使用 dig 查询
+//
+// IPv4 地址按 in-addr.arpa 的方式倒序写在区域名之前，如 8.8.8.8.geo.internal；
+// IPv6 地址按 ip6.arpa 的方式写为倒序的 32 个十六进制半字节，如
+// b.a.9.8.7.6.5.0.4.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.0.0.0.0.1.2.3.4.geo.internal。
+// TXT 记录的内容与 db.Search 的结果相同。
+//
+// 名称无法解析为IP或未找到时返回 NXDOMAIN，区域之外的名称返回 REFUSED，
+// 否定应答的授权部分带有区域的 SOA 记录以便解析器缓存。
+type DNSServer struct {
+	searcher *db.ReloadableSearcher
+	config   DNSConfig
+	zone     []string // 区域名的各个标签
+	tracker  connTracker
+}
+
+// NewDNSServer 创建 DNS 查询服务
+//
+// 参数:
+//   - searcher: 数据库搜索器，由调用方负责关闭
+//   - config: 服务配置，零值字段使用默认值
+//
+// 返回:
+//   - *DNSServer: 尚未启动的查询服务，使用 ListenAndServe，或 ServePacket 和 Serve 启动
+//   - error: 未指定区域名或区域名无效时返回错误
+func NewDNSServer(searcher *db.ReloadableSearcher, config DNSConfig) (*DNSServer, error) {
+	zone, err := splitDNSName(config.Zone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone: %w", err)
+	}
+	if len(zone) == 0 {
+		return nil, fmt.Errorf("zone is required")
+	}
+	if config.TTL == 0 {
+		config.TTL = DefaultDNSTTL
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = DefaultDNSIdleTimeout
+	}
+	if config.Logger == nil {
+		config.Logger = log.Default()
+	}
+	return &DNSServer{searcher: searcher, config: config, zone: zone}, nil
+}
+
+// ListenAndServe 在同一地址上监听 UDP 和 TCP 并处理查询
+//
+// 参数:
+//   - addr: 监听地址，如 ":53"
+//
+// 返回:
+//   - error: 总是返回非 nil 的错误，Shutdown 或 Close 之后返回 ErrServerClosed
+func (server *DNSServer) ListenAndServe(addr string) error {
+	if server.tracker.closing.Load() {
+		return ErrServerClosed
+	}
+	packetConn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	// 端口为 0 时让 TCP 使用与 UDP 相同的端口
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	if err != nil {
+		packetConn.Close()
+		return err
+	}
+
+	errs := make(chan error, 2)
+	go func() { errs <- server.ServePacket(packetConn) }()
+	go func() { errs <- server.Serve(listener) }()
+	err = <-errs
+	packetConn.Close()
+	listener.Close()
+	<-errs
+	return err
+}
+
+// ServePacket 在 UDP 连接上处理查询，每个查询由单独的 goroutine 处理
+//
+// 参数:
+//   - packetConn: UDP 连接，ServePacket 返回时已被关闭
+//
+// 返回:
+//   - error: 总是返回非 nil 的错误，Shutdown 或 Close 之后返回 ErrServerClosed
+func (server *DNSServer) ServePacket(packetConn net.PacketConn) error {
+	if !server.tracker.addListener(packetConn) {
+		packetConn.Close()
+		return ErrServerClosed
+	}
+	defer server.tracker.removeListener(packetConn)
+	defer packetConn.Close()
+
+	buf := make([]byte, dnsMaxTCPSize)
+	for {
+		n, addr, err := packetConn.ReadFrom(buf)
+		if err != nil {
+			if server.tracker.closing.Load() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !server.tracker.addTask() {
+			return ErrServerClosed
+		}
+		msg := append([]byte(nil), buf[:n]...)
+		go func() {
+			defer server.tracker.doneTask()
+			if response := server.handle(msg, false); response != nil {
+				packetConn.WriteTo(response, addr)
+			}
+		}()
+	}
+}
+
+// Serve 在 TCP 监听器上接受连接，每个连接上可以依次发送多个查询
+//
+// 参数:
+//   - listener: 监听器，Serve 返回时已被关闭
+//
+// 返回:
+//   - error: 总是返回非 nil 的错误，Shutdown 或 Close 之后返回 ErrServerClosed
+func (server *DNSServer) Serve(listener net.Listener) error {
+	return acceptLoop(&server.tracker, listener, server.config.Logger, server.serveConn)
+}
+
+// Shutdown 停止接受新的查询，等待进行中的查询结束后关闭所有连接
+//
+// 参数:
+//   - ctx: 等待的期限，到期后强制关闭剩余的连接
+//
+// 返回:
+//   - error: 等待期限到期时返回 ctx.Err()
+func (server *DNSServer) Shutdown(ctx context.Context) error {
+	return server.tracker.shutdown(ctx)
+}
+
+// Close 立即关闭所有监听器和连接
+func (server *DNSServer) Close() error {
+	return server.tracker.close()
+}
+
+// serveConn 处理 TCP 连接上以两字节长度为前缀的查询 (RFC 1035 4.2.2)
+func (server *DNSServer) serveConn(conn net.Conn) {
+	defer server.tracker.removeConn(conn)
+	defer conn.Close()
+
+	var prefix [2]byte
+	for server.tracker.waitRead(conn, server.config.IdleTimeout) {
+		if _, err := io.ReadFull(conn, prefix[:]); err != nil {
+			return
+		}
+		msg := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			return
+		}
+		response := server.handle(msg, true)
+		if response == nil {
+			return
+		}
+		response = append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...)
+		if _, err := conn.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+// handle 处理一个 DNS 查询并返回编码后的响应，不应回应的消息返回 nil
+func (server *DNSServer) handle(msg []byte, tcp bool) []byte {
+	query, err := parseDNSQuery(msg)
+	// 头部不完整的消息和响应消息不回应，避免与其他服务器互相回应形成循环
+	if query == nil || query.Header.Flags&dnsFlagQR != 0 {
+		return nil
+	}
+
+	var response *dnsMessage
+	switch {
+	case err != nil:
+		response = newDNSResponse(query, dnsRcodeFormErr)
+		response.Question = nil
+	case query.Header.opcode() != 0:
+		response = newDNSResponse(query, dnsRcodeNotImp)
+	default:
+		response = server.answer(query)
+	}
+
+	maxSize := dnsMaxTCPSize
+	if !tcp {
+		maxSize = query.UDPSize
+		if maxSize > dnsMaxUDPSize {
+			maxSize = dnsMaxUDPSize
+		}
+	}
+	return response.pack(maxSize)
+}
+
+// newDNSResponse 创建回应 query 的空响应，复制 ID、操作码和 RD 标志
+func newDNSResponse(query *dnsQuery, rcode int) *dnsMessage {
+	question := query.Question
+	return &dnsMessage{
+		Header: dnsHeader{
+			ID:    query.Header.ID,
+			Flags: dnsFlagQR | query.Header.Flags&(0xF<<11|dnsFlagRD) | uint16(rcode),
+		},
+		Question: &question,
+		EDNS:     query.EDNS,
+	}
+}
+
+// answer 回应区域内的标准查询
+func (server *DNSServer) answer(query *dnsQuery) *dnsMessage {
+	question := query.Question
+	if question.Class != dnsClassIN && question.Class != dnsClassANY ||
+		len(question.Labels) < len(server.zone) ||
+		!equalDNSLabels(question.Labels[len(question.Labels)-len(server.zone):], server.zone) {
+		return newDNSResponse(query, dnsRcodeRefused)
+	}
+	response := newDNSResponse(query, dnsRcodeSuccess)
+	response.Header.Flags |= dnsFlagAA
+
+	soa, err := server.soa()
+	if err != nil {
+		return server.failure(query, err)
+	}
+	labels := question.Labels[:len(question.Labels)-len(server.zone)]
+	if len(labels) == 0 {
+		// 区域顶点只有 SOA 记录
+		if question.Type == dnsTypeSOA || question.Type == dnsTypeANY {
+			response.Answers = append(response.Answers, soa)
+		} else {
+			response.Authority = append(response.Authority, soa)
+		}
+		return response
+	}
+
+	addr, ok := parseReverseName(labels)
+	var result *db.GeoResult
+	if ok {
+		result, err = server.searcher.SearchAddr(addr)
+	}
+	switch {
+	case !ok || errors.Is(err, db.ErrNotFound) || errors.Is(err, db.ErrInvalidIP) || errors.Is(err, db.ErrIPVersionMismatch):
+		response.Header.Flags |= dnsRcodeNXDomain
+		response.Authority = append(response.Authority, soa)
+	case err != nil:
+		return server.failure(query, err)
+	case question.Type == dnsTypeTXT || question.Type == dnsTypeANY:
+		response.Answers = append(response.Answers, dnsRecord{
+			Labels: question.Labels,
+			Type:   dnsTypeTXT,
+			Class:  dnsClassIN,
+			TTL:    server.config.TTL,
+			Data:   txtData(result.String()),
+		})
+	default:
+		// 名称存在但没有该类型的记录
+		response.Authority = append(response.Authority, soa)
+	}
+	return response
+}
+
+// failure 返回 SERVFAIL 响应，搜索器关闭以外的错误会被记录
+func (server *DNSServer) failure(query *dnsQuery, err error) *dnsMessage {
+	if !errors.Is(err, db.ErrClosed) {
+		server.config.Logger.Printf("dns: lookup %s failed: %v", strings.Join(query.Question.Labels, "."), err)
+	}
+	return newDNSResponse(query, dnsRcodeServFail)
+}
+
+// soa 返回区域的 SOA 记录，序列号为数据库版本，否定应答的缓存时间与 TTL 相同
+func (server *DNSServer) soa() (dnsRecord, error) {
+	var serial uint32
+	err := server.searcher.Do(func(dbSearcher *db.DBSearcher) error {
+		serial = uint32(dbSearcher.HyperHeader.Version)
+		return nil
+	})
+	if err != nil {
+		return dnsRecord{}, err
+	}
+	mname := append([]string{"ns"}, server.zone...)
+	rname := append([]string{"hostmaster"}, server.zone...)
+	return dnsRecord{
+		Labels: server.zone,
+		Type:   dnsTypeSOA,
+		Class:  dnsClassIN,
+		TTL:    server.config.TTL,
+		Data:   soaData(mname, rname, serial, 3600, 600, 86400, server.config.TTL),
+	}, nil
+}
+
+// parseReverseName 解析区域名之前的标签：4 个倒序的十进制字节为 IPv4 地址，
+// 32 个倒序的十六进制半字节为 IPv6 地址
+func parseReverseName(labels []string) (netip.Addr, bool) {
+	switch len(labels) {
+	case 4:
+		var ip [4]byte
+		for i, label := range labels {
+			if len(label) == 0 || len(label) > 3 || len(label) > 1 && label[0] == '0' {
+				return netip.Addr{}, false
+			}
+			value := 0
+			for _, c := range []byte(label) {
+				if c < '0' || c > '9' {
+					return netip.Addr{}, false
+				}
+				value = value*10 + int(c-'0')
+			}
+			if value > 255 {
+				return netip.Addr{}, false
+			}
+			ip[3-i] = byte(value)
+		}
+		return netip.AddrFrom4(ip), true
+	case 32:
+		var ip [16]byte
+		for i, label := range labels {
+			if len(label) != 1 {
+				return netip.Addr{}, false
+			}
+			var nibble byte
+			switch c := label[0]; {
+			case c >= '0' && c <= '9':
+				nibble = c - '0'
+			case c >= 'a' && c <= 'f':
+				nibble = c - 'a' + 10
+			case c >= 'A' && c <= 'F':
+				nibble = c - 'A' + 10
+			default:
+				return netip.Addr{}, false
+			}
+			// 第一个标签是最低的半字节
+			position := 31 - i
+			ip[position/2] |= nibble << (4 * (1 - position%2))
+		}
+		return netip.AddrFrom16(ip), true
+	}
+	return netip.Addr{}, false
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dnsReply 是测试中解析的 DNS 响应
+type dnsReply struct {
+	ID        uint16
+	Flags     uint16
+	Question  []string
+	Answers   []dnsRecord
+	Authority []dnsRecord
+	EDNS      bool
+}
+
+// rcode 返回响应码
+func (reply *dnsReply) rcode() int {
+	return int(reply.Flags & 0xF)
+}
+
+// txt 返回第一条应答的 TXT 字符串
+func (reply *dnsReply) txt(t *testing.T) []string {
+	t.Helper()
+
+	if len(reply.Answers) == 0 || reply.Answers[0].Type != dnsTypeTXT {
+		t.Fatalf("没有 TXT 应答: %+v", reply)
+	}
+	var texts []string
+	for data := reply.Answers[0].Data; len(data) > 0; data = data[1+int(data[0]):] {
+		texts = append(texts, string(data[1:1+int(data[0])]))
+	}
+	return texts
+}
+
+// buildDNSQuery 手工编码一个带 RD 标志的查询，edns 大于 0 时附加声明该UDP上限的 OPT 记录
+func buildDNSQuery(id uint16, name string, qtype uint16, edns int) []byte {
+	msg := []byte{byte(id >> 8), byte(id), 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, byte(qtype>>8), byte(qtype), 0, 1)
+	if edns > 0 {
+		msg[11] = 1
+		msg = append(msg, 0, 0, 41, byte(edns>>8), byte(edns), 0, 0, 0, 0, 0, 0)
+	}
+	return msg
+}
+
+// parseDNSReply 解析 DNS 响应
+func parseDNSReply(t *testing.T, msg []byte) *dnsReply {
+	t.Helper()
+
+	if len(msg) < dnsHeaderLength {
+		t.Fatalf("响应只有 %d 字节", len(msg))
+	}
+	reply := &dnsReply{ID: binary.BigEndian.Uint16(msg), Flags: binary.BigEndian.Uint16(msg[2:])}
+	counts := []int{int(binary.BigEndian.Uint16(msg[4:])), int(binary.BigEndian.Uint16(msg[6:])),
+		int(binary.BigEndian.Uint16(msg[8:])), int(binary.BigEndian.Uint16(msg[10:]))}
+	offset := dnsHeaderLength
+	if counts[0] == 1 {
+		labels, next, err := readDNSName(msg, offset)
+		if err != nil {
+			t.Fatalf("解析问题失败: %v", err)
+		}
+		reply.Question, offset = labels, next+4
+	}
+	for section := 1; section < 4; section++ {
+		for i := 0; i < counts[section]; i++ {
+			labels, next, err := readDNSName(msg, offset)
+			if err != nil || next+10 > len(msg) {
+				t.Fatalf("解析记录失败: %v", err)
+			}
+			length := int(binary.BigEndian.Uint16(msg[next+8:]))
+			record := dnsRecord{
+				Labels: labels,
+				Type:   binary.BigEndian.Uint16(msg[next:]),
+				Class:  binary.BigEndian.Uint16(msg[next+2:]),
+				TTL:    binary.BigEndian.Uint32(msg[next+4:]),
+				Data:   msg[next+10 : next+10+length],
+			}
+			offset = next + 10 + length
+			switch section {
+			case 1:
+				reply.Answers = append(reply.Answers, record)
+			case 2:
+				reply.Authority = append(reply.Authority, record)
+			case 3:
+				reply.EDNS = reply.EDNS || record.Type == dnsTypeOPT
+			}
+		}
+	}
+	if offset != len(msg) {
+		t.Fatalf("响应末尾有 %d 字节多余数据", len(msg)-offset)
+	}
+	return reply
+}
+
+// startDNSServer 在回环地址上启动 UDP 和 TCP 服务，返回两者的地址
+func startDNSServer(t *testing.T, config DNSConfig) (*DNSServer, string, string, <-chan error) {
+	t.Helper()
+
+	if config.Logger == nil {
+		config.Logger = log.New(io.Discard, "", 0)
+	}
+	server, err := NewDNSServer(openTestSearcher(t, 991231), config)
+	if err != nil {
+		t.Fatalf("创建DNS服务失败: %v", err)
+	}
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听UDP失败: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听TCP失败: %v", err)
+	}
+	served := make(chan error, 2)
+	go func() { served <- server.ServePacket(packetConn) }()
+	go func() { served <- server.Serve(listener) }()
+	t.Cleanup(func() { server.Close() })
+	return server, packetConn.LocalAddr().String(), listener.Addr().String(), served
+}
+
+// exchangeUDP 通过UDP发送查询并读取响应
+func exchangeUDP(t *testing.T, addr string, query []byte) []byte {
+	t.Helper()
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(query); err != nil {
+		t.Fatalf("发送查询失败: %v", err)
+	}
+	buf := make([]byte, dnsMaxTCPSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("读取响应失败: %v", err)
+	}
+	return buf[:n]
+}
+
+// writeTCPQuery 在TCP连接上发送带长度前缀的查询
+func writeTCPQuery(t *testing.T, conn net.Conn, query []byte) {
+	t.Helper()
+
+	if _, err := conn.Write(append([]byte{byte(len(query) >> 8), byte(len(query))}, query...)); err != nil {
+		t.Fatalf("发送查询失败: %v", err)
+	}
+}
+
+// readTCPReply 读取带长度前缀的响应
+func readTCPReply(t *testing.T, conn net.Conn) []byte {
+	t.Helper()
+
+	var prefix [2]byte
+	if _, err := io.ReadFull(conn, prefix[:]); err != nil {
+		t.Fatalf("读取响应长度失败: %v", err)
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		t.Fatalf("读取响应失败: %v", err)
+	}
+	return msg
+}
+
+// nibbleName 返回IPv6地址的倒序半字节名称
+func nibbleName(addr netip.Addr, zone string) string {
+	var labels []string
+	ip := addr.As16()
+	for i := len(ip) - 1; i >= 0; i-- {
+		labels = append(labels, string("0123456789abcdef"[ip[i]&0xF]), string("0123456789abcdef"[ip[i]>>4]))
+	}
+	return strings.Join(labels, ".") + "." + zone
+}
+
+// TestDNSUDP 测试通过UDP查询TXT记录及各种否定应答
+func TestDNSUDP(t *testing.T) {
+	_, udpAddr, _, _ := startDNSServer(t, DNSConfig{Zone: "geo.internal.", TTL: 60})
+
+	tests := []struct {
+		name    string
+		qtype   uint16
+		rcode   int
+		txt     []string
+		soaOnly bool // 否定应答，授权部分只有 SOA
+	}{
+		{"3.2.0.1.geo.internal", dnsTypeTXT, dnsRcodeSuccess, []string{"中国\t福建\t福州\t电信"}, false},
+		{"8.8.8.8.GEO.Internal.", dnsTypeTXT, dnsRcodeSuccess, []string{"美国\tnull\tnull\tGoogle"}, false},
+		{nibbleName(netip.MustParseAddr("::ffff:223.5.5.5"), "geo.internal"), dnsTypeTXT, dnsRcodeSuccess, []string{"中国\t浙江\t杭州\t阿里云"}, false},
+		{"8.8.8.8.geo.internal", dnsTypeANY, dnsRcodeSuccess, []string{"美国\tnull\tnull\tGoogle"}, false},
+		{"8.8.8.8.geo.internal", dnsTypeA, dnsRcodeSuccess, nil, true},
+		{"9.9.9.9.geo.internal", dnsTypeTXT, dnsRcodeNXDomain, nil, true},
+		{"1.0.0.1.0.geo.internal", dnsTypeTXT, dnsRcodeNXDomain, nil, true},
+		{"08.8.8.8.geo.internal", dnsTypeTXT, dnsRcodeNXDomain, nil, true},
+		{"256.8.8.8.geo.internal", dnsTypeTXT, dnsRcodeNXDomain, nil, true},
+		{nibbleName(netip.MustParseAddr("2001:db8::1"), "geo.internal"), dnsTypeTXT, dnsRcodeNXDomain, nil, true},
+		{"geo.internal", dnsTypeTXT, dnsRcodeSuccess, nil, true},
+		{"8.8.8.8.example.com", dnsTypeTXT, dnsRcodeRefused, nil, false},
+		{"internal", dnsTypeTXT, dnsRcodeRefused, nil, false},
+	}
+	for i, test := range tests {
+		query := buildDNSQuery(uint16(1000+i), test.name, test.qtype, 0)
+		reply := parseDNSReply(t, exchangeUDP(t, udpAddr, query))
+
+		if reply.ID != uint16(1000+i) || reply.Flags&dnsFlagQR == 0 || reply.Flags&dnsFlagRD == 0 || reply.rcode() != test.rcode {
+			t.Errorf("%s: ID = %d, 标志 = %#04x, 期望响应码 %d", test.name, reply.ID, reply.Flags, test.rcode)
+			continue
+		}
+		// 问题中的名称保留原始大小写
+		if got := strings.Join(reply.Question, ".") + "."; got != strings.TrimSuffix(test.name, ".")+"." {
+			t.Errorf("%s: 问题名称 = %q", test.name, got)
+		}
+		if test.txt != nil {
+			if texts := reply.txt(t); !reflect.DeepEqual(texts, test.txt) || reply.Answers[0].TTL != 60 {
+				t.Errorf("%s: TXT = %q, TTL = %d", test.name, texts, reply.Answers[0].TTL)
+			}
+		} else if len(reply.Answers) != 0 {
+			t.Errorf("%s: 应答 = %+v", test.name, reply.Answers)
+		}
+		if test.soaOnly != (len(reply.Authority) == 1 && reply.Authority[0].Type == dnsTypeSOA) {
+			t.Errorf("%s: 授权部分 = %+v", test.name, reply.Authority)
+		}
+		if test.rcode != dnsRcodeRefused && reply.Flags&dnsFlagAA == 0 {
+			t.Errorf("%s: 缺少 AA 标志", test.name)
+		}
+	}
+
+	// 区域顶点的 SOA 查询
+	reply := parseDNSReply(t, exchangeUDP(t, udpAddr, buildDNSQuery(1, "geo.internal", dnsTypeSOA, 0)))
+	if len(reply.Answers) != 1 || reply.Answers[0].Type != dnsTypeSOA {
+		t.Fatalf("SOA 应答 = %+v", reply.Answers)
+	}
+	mname, next, err := readDNSName(reply.Answers[0].Data, 0)
+	if err != nil || strings.Join(mname, ".") != "ns.geo.internal" || binary.BigEndian.Uint32(reply.Answers[0].Data[len(reply.Answers[0].Data)-4:]) != 60 {
+		t.Errorf("SOA 数据 = %q, %d, %v", mname, next, err)
+	}
+
+	// 带 EDNS 的查询在响应中也带有 OPT 记录
+	reply = parseDNSReply(t, exchangeUDP(t, udpAddr, buildDNSQuery(2, "8.8.8.8.geo.internal", dnsTypeTXT, 1232)))
+	if !reply.EDNS || len(reply.Answers) != 1 {
+		t.Errorf("EDNS 查询的响应 = %+v", reply)
+	}
+
+	// 问题数不为 1 时返回 FORMERR
+	query := buildDNSQuery(3, "8.8.8.8.geo.internal", dnsTypeTXT, 0)
+	query[5] = 2
+	if reply := parseDNSReply(t, exchangeUDP(t, udpAddr, query)); reply.rcode() != dnsRcodeFormErr || reply.ID != 3 {
+		t.Errorf("两个问题时响应 = %+v", reply)
+	}
+	// 非标准查询返回 NOTIMP
+	query = buildDNSQuery(4, "8.8.8.8.geo.internal", dnsTypeTXT, 0)
+	query[2] |= 2 << 3
+	if reply := parseDNSReply(t, exchangeUDP(t, udpAddr, query)); reply.rcode() != dnsRcodeNotImp {
+		t.Errorf("操作码为 2 时响应码 = %d", reply.rcode())
+	}
+}
+
+// TestDNSTCP 测试在同一个TCP连接上依次发送多个查询
+func TestDNSTCP(t *testing.T) {
+	_, _, tcpAddr, _ := startDNSServer(t, DNSConfig{Zone: "geo.internal"})
+
+	conn, err := net.Dial("tcp", tcpAddr)
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	writeTCPQuery(t, conn, buildDNSQuery(1, "1.1.0.1.geo.internal", dnsTypeTXT, 0))
+	writeTCPQuery(t, conn, buildDNSQuery(2, "9.9.9.9.geo.internal", dnsTypeTXT, 0))
+	first := parseDNSReply(t, readTCPReply(t, conn))
+	if texts := first.txt(t); first.ID != 1 || !reflect.DeepEqual(texts, []string{"中国\t福建\t福州\t电信"}) || first.Answers[0].TTL != DefaultDNSTTL {
+		t.Errorf("第一个响应 = %+v, %q", first, texts)
+	}
+	if second := parseDNSReply(t, readTCPReply(t, conn)); second.ID != 2 || second.rcode() != dnsRcodeNXDomain {
+		t.Errorf("第二个响应 = %+v", second)
+	}
+}
+
+// TestDNSWire 测试名称压缩、TXT 拆分和截断
+func TestDNSWire(t *testing.T) {
+	// 第二个名称通过指针引用第一个名称的后缀
+	msg := []byte{3, 'f', 'o', 'o', 3, 'c', 'o', 'm', 0, 3, 'b', 'a', 'r', 0xC0, 4}
+	if labels, next, err := readDNSName(msg, 9); err != nil || !reflect.DeepEqual(labels, []string{"bar", "com"}) || next != len(msg) {
+		t.Errorf("readDNSName = %q, %d, %v", labels, next, err)
+	}
+	for _, bad := range [][]byte{
+		{0xC0, 0},         // 指向自身
+		{3, 'f', 'o'},     // 标签被截断
+		{0x40, 0},         // 扩展标签类型
+		{1, 'a', 0xC0, 2}, // 指向之后的位置
+	} {
+		if _, _, err := readDNSName(bad, 0); !errors.Is(err, errDNSFormat) {
+			t.Errorf("readDNSName(%v) 错误 = %v", bad, err)
+		}
+	}
+
+	// 超过 255 字节的文本拆分为多个字符串，不拆开 UTF-8 字符
+	text := strings.Repeat("a", 254) + "福州" + strings.Repeat("b", 300)
+	data := txtData(text)
+	var parts []string
+	for len(data) > 0 {
+		parts = append(parts, string(data[1:1+int(data[0])]))
+		data = data[1+int(data[0]):]
+	}
+	if strings.Join(parts, "") != text || len(parts) != 3 || len(parts[0]) != 254 {
+		t.Errorf("TXT 拆分为 %d 个字符串，第一个 %d 字节", len(parts), len(parts[0]))
+	}
+
+	// 超过上限时去掉记录并设置 TC 标志
+	query, err := parseDNSQuery(buildDNSQuery(7, "8.8.8.8.geo.internal", dnsTypeTXT, 0))
+	if err != nil || query.UDPSize != dnsMinUDPSize {
+		t.Fatalf("parseDNSQuery = %+v, %v", query, err)
+	}
+	response := newDNSResponse(query, dnsRcodeSuccess)
+	response.Answers = []dnsRecord{{Labels: query.Question.Labels, Type: dnsTypeTXT, Class: dnsClassIN, Data: txtData(strings.Repeat("x", 600))}}
+	full := parseDNSReply(t, response.pack(dnsMaxTCPSize))
+	truncated := parseDNSReply(t, response.pack(dnsMinUDPSize))
+	if full.Flags&dnsFlagTC != 0 || len(full.Answers) != 1 || truncated.Flags&dnsFlagTC == 0 || len(truncated.Answers) != 0 || truncated.ID != 7 {
+		t.Errorf("截断前 = %+v, 截断后 = %+v", full.Flags, truncated)
+	}
+}
+
+// TestDNSShutdown 测试关闭服务时UDP和TCP都停止服务
+func TestDNSShutdown(t *testing.T) {
+	server, _, tcpAddr, served := startDNSServer(t, DNSConfig{Zone: "geo.internal"})
+
+	conn, err := net.Dial("tcp", tcpAddr)
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	writeTCPQuery(t, conn, buildDNSQuery(1, "8.8.8.8.geo.internal", dnsTypeTXT, 0))
+	readTCPReply(t, conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown 失败: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-served; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve 返回 %v", err)
+		}
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("关闭服务后连接未关闭: %v", err)
+	}
+
+	if _, err := NewDNSServer(nil, DNSConfig{}); err == nil {
+		t.Error("未指定区域名时没有返回错误")
+	}
+	if _, err := NewDNSServer(nil, DNSConfig{Zone: "a..b"}); err == nil {
+		t.Error("区域名无效时没有返回错误")
+	}
+}
@@ -0,0 +1,362 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// DNS 资源记录类型和类别 (RFC 1035、RFC 3596、RFC 6891)
+const (
+	dnsTypeA    uint16 = 1
+	dnsTypeSOA  uint16 = 6
+	dnsTypeTXT  uint16 = 16
+	dnsTypeAAAA uint16 = 28
+	dnsTypeOPT  uint16 = 41
+	dnsTypeANY  uint16 = 255
+
+	dnsClassIN  uint16 = 1
+	dnsClassANY uint16 = 255
+)
+
+// DNS 响应码
+const (
+	dnsRcodeSuccess  = 0
+	dnsRcodeFormErr  = 1
+	dnsRcodeServFail = 2
+	dnsRcodeNXDomain = 3
+	dnsRcodeNotImp   = 4
+	dnsRcodeRefused  = 5
+)
+
+// DNS 头部标志位
+const (
+	dnsFlagQR uint16 = 1 << 15 // 响应
+	dnsFlagAA uint16 = 1 << 10 // 权威应答
+	dnsFlagTC uint16 = 1 << 9  // 已截断
+	dnsFlagRD uint16 = 1 << 8  // 期望递归
+)
+
+// DNS 消息的长度限制
+const (
+	dnsHeaderLength   = 12
+	dnsMaxLabelLength = 63
+	dnsMaxNameLength  = 255
+	dnsMinUDPSize     = 512   // 不支持 EDNS 的客户端可以接收的最大UDP消息
+	dnsMaxUDPSize     = 4096  // 本服务通过 EDNS 声明的UDP消息上限
+	dnsMaxTCPSize     = 65535 // TCP 消息的长度前缀为 16 位
+)
+
+// errDNSFormat 表示无法解析的 DNS 消息
+var errDNSFormat = errors.New("malformed dns message")
+
+// dnsHeader 是 DNS 消息的头部
+type dnsHeader struct {
+	ID      uint16
+	Flags   uint16 // QR、Opcode、AA、TC、RD、RA 和 RCODE
+	QDCount uint16
+	ANCount uint16
+	NSCount uint16
+	ARCount uint16
+}
+
+// opcode 返回头部中的操作码，0 表示标准查询
+func (header dnsHeader) opcode() int {
+	return int(header.Flags>>11) & 0xF
+}
+
+// dnsQuestion 是 DNS 消息中的问题
+type dnsQuestion struct {
+	Labels []string // 名称的各个标签，保留原始的大小写
+	Type   uint16
+	Class  uint16
+}
+
+// dnsQuery 是解析后的 DNS 查询
+type dnsQuery struct {
+	Header   dnsHeader
+	Question dnsQuestion
+	EDNS     bool // 查询中是否带有 OPT 记录
+	UDPSize  int  // 客户端通过 EDNS 声明的UDP消息上限，未声明时为 dnsMinUDPSize
+}
+
+// parseDNSQuery 解析只有一个问题的 DNS 查询，附加部分中的 OPT 记录用于确定UDP消息上限
+//
+// 参数:
+//   - msg: DNS 消息
+//
+// 返回:
+//   - *dnsQuery: 解析结果；头部不完整时为 nil，其余部分解析失败时只有头部有效
+//   - error: 消息格式错误时返回包装了 errDNSFormat 的错误
+func parseDNSQuery(msg []byte) (*dnsQuery, error) {
+	if len(msg) < dnsHeaderLength {
+		return nil, fmt.Errorf("%w: message of %d bytes is shorter than the header", errDNSFormat, len(msg))
+	}
+	query := &dnsQuery{
+		Header: dnsHeader{
+			ID:      binary.BigEndian.Uint16(msg[0:]),
+			Flags:   binary.BigEndian.Uint16(msg[2:]),
+			QDCount: binary.BigEndian.Uint16(msg[4:]),
+			ANCount: binary.BigEndian.Uint16(msg[6:]),
+			NSCount: binary.BigEndian.Uint16(msg[8:]),
+			ARCount: binary.BigEndian.Uint16(msg[10:]),
+		},
+		UDPSize: dnsMinUDPSize,
+	}
+	if query.Header.QDCount != 1 {
+		return query, fmt.Errorf("%w: expected 1 question, got %d", errDNSFormat, query.Header.QDCount)
+	}
+
+	labels, offset, err := readDNSName(msg, dnsHeaderLength)
+	if err != nil {
+		return query, err
+	}
+	if offset+4 > len(msg) {
+		return query, fmt.Errorf("%w: truncated question", errDNSFormat)
+	}
+	query.Question = dnsQuestion{
+		Labels: labels,
+		Type:   binary.BigEndian.Uint16(msg[offset:]),
+		Class:  binary.BigEndian.Uint16(msg[offset+2:]),
+	}
+	offset += 4
+
+	// 跳过应答和授权部分，在附加部分中查找 OPT 记录
+	records := int(query.Header.ANCount) + int(query.Header.NSCount) + int(query.Header.ARCount)
+	for i := 0; i < records; i++ {
+		name, next, err := readDNSName(msg, offset)
+		if err != nil {
+			return query, err
+		}
+		if next+10 > len(msg) {
+			return query, fmt.Errorf("%w: truncated resource record", errDNSFormat)
+		}
+		rrType := binary.BigEndian.Uint16(msg[next:])
+		rrClass := binary.BigEndian.Uint16(msg[next+2:])
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		offset = next + 10 + length
+		if offset > len(msg) {
+			return query, fmt.Errorf("%w: truncated resource record data", errDNSFormat)
+		}
+
+		if rrType == dnsTypeOPT && len(name) == 0 && i >= records-int(query.Header.ARCount) {
+			query.EDNS = true
+			query.UDPSize = int(rrClass)
+			if query.UDPSize < dnsMinUDPSize {
+				query.UDPSize = dnsMinUDPSize
+			}
+		}
+	}
+	return query, nil
+}
+
+// readDNSName 读取 offset 处的名称，支持压缩指针 (RFC 1035 4.1.4)
+//
+// 参数:
+//   - msg: 整个 DNS 消息，压缩指针相对于消息开头
+//   - offset: 名称的起始位置
+//
+// 返回:
+//   - []string: 名称的各个标签，根域名为空切片
+//   - int: 名称之后的位置，名称以压缩指针结尾时为指针之后的位置
+//   - error: 名称格式错误时返回包装了 errDNSFormat 的错误
+func readDNSName(msg []byte, offset int) ([]string, int, error) {
+	var labels []string
+	next := -1
+	length := 1 // 结尾的空标签
+	for {
+		if offset >= len(msg) {
+			return nil, 0, fmt.Errorf("%w: truncated name", errDNSFormat)
+		}
+		b := int(msg[offset])
+		switch {
+		case b == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return labels, next, nil
+		case b&0xC0 == 0xC0:
+			if offset+1 >= len(msg) {
+				return nil, 0, fmt.Errorf("%w: truncated compression pointer", errDNSFormat)
+			}
+			pointer := (b&0x3F)<<8 | int(msg[offset+1])
+			// 只允许指向之前的位置，避免指针形成循环
+			if pointer >= offset {
+				return nil, 0, fmt.Errorf("%w: compression pointer does not point backwards", errDNSFormat)
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = pointer
+		case b&0xC0 != 0:
+			return nil, 0, fmt.Errorf("%w: unsupported label type 0x%02x", errDNSFormat, b&0xC0)
+		default:
+			if offset+1+b > len(msg) {
+				return nil, 0, fmt.Errorf("%w: truncated label", errDNSFormat)
+			}
+			if length += b + 1; length > dnsMaxNameLength {
+				return nil, 0, fmt.Errorf("%w: name exceeds %d bytes", errDNSFormat, dnsMaxNameLength)
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+b]))
+			offset += 1 + b
+		}
+	}
+}
+
+// splitDNSName 将以点分隔的名称拆分为标签，忽略结尾的点，"" 和 "." 表示根域名
+func splitDNSName(name string) ([]string, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return nil, nil
+	}
+	labels := strings.Split(name, ".")
+	length := 1
+	for _, label := range labels {
+		if label == "" || len(label) > dnsMaxLabelLength {
+			return nil, fmt.Errorf("invalid dns name %q", name)
+		}
+		length += len(label) + 1
+	}
+	if length > dnsMaxNameLength {
+		return nil, fmt.Errorf("dns name %q exceeds %d bytes", name, dnsMaxNameLength)
+	}
+	return labels, nil
+}
+
+// dnsRecord 是响应中的资源记录
+type dnsRecord struct {
+	Labels []string
+	Type   uint16
+	Class  uint16
+	TTL    uint32
+	Data   []byte
+}
+
+// dnsMessage 是要发送的 DNS 响应
+type dnsMessage struct {
+	Header    dnsHeader    // 只使用 ID 和 Flags，各部分的记录数由 pack 填写
+	Question  *dnsQuestion // 无法解析问题时为 nil
+	Answers   []dnsRecord
+	Authority []dnsRecord
+	EDNS      bool // 是否在附加部分写出 OPT 记录
+}
+
+// pack 编码 DNS 消息，超过 maxSize 时去掉所有记录并设置 TC 标志，让客户端改用 TCP 重试
+func (message *dnsMessage) pack(maxSize int) []byte {
+	buf := message.appendTo(nil, true)
+	if len(buf) > maxSize {
+		buf = message.appendTo(buf[:0], false)
+	}
+	return buf
+}
+
+// appendTo 将消息追加到 buf，withRecords 为 false 时只写出头部、问题和 OPT 记录并设置 TC 标志
+func (message *dnsMessage) appendTo(buf []byte, withRecords bool) []byte {
+	header := message.Header
+	header.QDCount, header.ANCount, header.NSCount, header.ARCount = 0, 0, 0, 0
+	if message.Question != nil {
+		header.QDCount = 1
+	}
+	if withRecords {
+		header.ANCount = uint16(len(message.Answers))
+		header.NSCount = uint16(len(message.Authority))
+	} else {
+		header.Flags |= dnsFlagTC
+	}
+	if message.EDNS {
+		header.ARCount = 1
+	}
+
+	buf = binary.BigEndian.AppendUint16(buf, header.ID)
+	buf = binary.BigEndian.AppendUint16(buf, header.Flags)
+	buf = binary.BigEndian.AppendUint16(buf, header.QDCount)
+	buf = binary.BigEndian.AppendUint16(buf, header.ANCount)
+	buf = binary.BigEndian.AppendUint16(buf, header.NSCount)
+	buf = binary.BigEndian.AppendUint16(buf, header.ARCount)
+
+	if message.Question != nil {
+		buf = appendDNSName(buf, message.Question.Labels)
+		buf = binary.BigEndian.AppendUint16(buf, message.Question.Type)
+		buf = binary.BigEndian.AppendUint16(buf, message.Question.Class)
+	}
+	if withRecords {
+		for _, records := range [][]dnsRecord{message.Answers, message.Authority} {
+			for _, record := range records {
+				buf = message.appendRecord(buf, record)
+			}
+		}
+	}
+	if message.EDNS {
+		// OPT 记录：根域名，类别字段为UDP消息上限，扩展 RCODE、版本和标志均为 0
+		buf = message.appendRecord(buf, dnsRecord{Type: dnsTypeOPT, Class: dnsMaxUDPSize})
+	}
+	return buf
+}
+
+// appendRecord 追加一条资源记录，名称与问题相同时使用指向问题名称的压缩指针
+func (message *dnsMessage) appendRecord(buf []byte, record dnsRecord) []byte {
+	if message.Question != nil && len(record.Labels) > 0 && equalDNSLabels(record.Labels, message.Question.Labels) {
+		buf = append(buf, 0xC0, dnsHeaderLength)
+	} else {
+		buf = appendDNSName(buf, record.Labels)
+	}
+	buf = binary.BigEndian.AppendUint16(buf, record.Type)
+	buf = binary.BigEndian.AppendUint16(buf, record.Class)
+	buf = binary.BigEndian.AppendUint32(buf, record.TTL)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(record.Data)))
+	return append(buf, record.Data...)
+}
+
+// appendDNSName 以未压缩的形式追加名称
+func appendDNSName(buf []byte, labels []string) []byte {
+	for _, label := range labels {
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	return append(buf, 0)
+}
+
+// equalDNSLabels 按 DNS 的规则 (ASCII 不区分大小写) 比较两个名称
+func equalDNSLabels(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// txtData 将文本编码为 TXT 记录的数据，超过 255 字节时拆分为多个字符串，不拆开 UTF-8 字符
+func txtData(text string) []byte {
+	data := make([]byte, 0, len(text)+len(text)/255+1)
+	for {
+		n := len(text)
+		if n > 255 {
+			n = 255
+			for n > 0 && !utf8.RuneStart(text[n]) {
+				n--
+			}
+		}
+		data = append(data, byte(n))
+		data = append(data, text[:n]...)
+		text = text[n:]
+		if text == "" {
+			return data
+		}
+	}
+}
+
+// soaData 编码 SOA 记录的数据 (RFC 1035 3.3.13)
+func soaData(mname, rname []string, serial, refresh, retry, expire, minimum uint32) []byte {
+	data := appendDNSName(nil, mname)
+	data = appendDNSName(data, rname)
+	for _, value := range []uint32{serial, refresh, retry, expire, minimum} {
+		data = binary.BigEndian.AppendUint32(data, value)
+	}
+	return data
+}
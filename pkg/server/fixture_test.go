@@ -0,0 +1,29 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/tagphi/czdb-search-golang/internal/testdb"
+	"github.com/tagphi/czdb-search-golang/pkg/builder"
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+)
+
+// testRanges 是测试数据库中的记录
+var testRanges = []builder.Range{
+	testdb.Range("1.0.1.0", "1.0.3.255", []string{"中国", "福建", "福州"}, "电信"),
+	testdb.Range("8.8.8.0", "8.8.8.255", []string{"美国", "", ""}, "Google"),
+	testdb.Range("223.5.5.0", "223.5.5.255", []string{"中国", "浙江", "杭州"}, "阿里云"),
+}
+
+// openTestSearcher 生成测试数据库并打开可热加载的搜索器，测试结束时自动关闭
+func openTestSearcher(t *testing.T, expirationDate int32) *db.ReloadableSearcher {
+	t.Helper()
+
+	path := testdb.Write(t, expirationDate, testRanges)
+	searcher, err := db.OpenReloadable(path, testdb.Key, &db.Options{SearchType: db.BTREE, CacheSize: 16})
+	if err != nil {
+		t.Fatalf("初始化数据库搜索器失败: %v", err)
+	}
+	t.Cleanup(searcher.Close)
+	return searcher
+}
@@ -0,0 +1,312 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+)
+
+// 默认的HTTP服务配置
+const (
+	DefaultMaxBatch    = 10000
+	DefaultMaxBodySize = 4 << 20
+	DefaultWarnDays    = 30
+)
+
+// HTTPConfig HTTP查询服务的配置
+type HTTPConfig struct {
+	MaxBatch    int         // POST /v1/lookup 一次最多查询的IP数，默认 DefaultMaxBatch
+	MaxBodySize int64       // POST /v1/lookup 请求体的最大字节数，默认 DefaultMaxBodySize
+	WarnDays    int         // 授权剩余天数少于该值时 /healthz 的状态为 expiring，默认 DefaultWarnDays
+	Logger      *log.Logger // 记录服务端错误，默认使用 log.Default()
+}
+
+// HTTPHandler 提供IP查询的 HTTP/JSON 接口
+//
+//	GET  /v1/lookup/{ip}  查询单个IP，IP无效或版本不符时返回 400，未找到时返回 404
+//	POST /v1/lookup       批量查询，请求体为 JSON 字符串数组或每行一个IP
+//	GET  /v1/info         数据库信息、列名称和缓存统计
+//	GET  /healthz         数据库版本和授权过期状态
+type HTTPHandler struct {
+	searcher *db.ReloadableSearcher
+	config   HTTPConfig
+	mux      *http.ServeMux
+}
+
+// NewHTTPHandler 创建HTTP查询服务
+//
+// 参数:
+//   - searcher: 数据库搜索器，由调用方负责关闭
+//   - config: 服务配置，零值字段使用默认值
+//
+// 返回:
+//   - *HTTPHandler: 实现 http.Handler 的查询服务
+func NewHTTPHandler(searcher *db.ReloadableSearcher, config HTTPConfig) *HTTPHandler {
+	if config.MaxBatch <= 0 {
+		config.MaxBatch = DefaultMaxBatch
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultMaxBodySize
+	}
+	if config.WarnDays <= 0 {
+		config.WarnDays = DefaultWarnDays
+	}
+	if config.Logger == nil {
+		config.Logger = log.Default()
+	}
+
+	handler := &HTTPHandler{searcher: searcher, config: config, mux: http.NewServeMux()}
+	handler.mux.HandleFunc("/v1/lookup/", handler.handleLookup)
+	handler.mux.HandleFunc("/v1/lookup", handler.handleBatch)
+	handler.mux.HandleFunc("/v1/info", handler.handleInfo)
+	handler.mux.HandleFunc("/healthz", handler.handleHealth)
+	handler.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "no such endpoint: "+r.URL.Path)
+	})
+	return handler
+}
+
+// ServeHTTP 实现 http.Handler
+func (handler *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler.mux.ServeHTTP(w, r)
+}
+
+// batchResponse 是批量查询的响应
+type batchResponse struct {
+	Count   int      `json:"count"`   // 查询的IP数
+	Found   int      `json:"found"`   // 找到的IP数
+	Results []Result `json:"results"` // 按请求顺序排列的结果
+}
+
+// InfoResponse 是 /v1/info 的响应
+type InfoResponse struct {
+	Health
+	Path             string        `json:"path"`      // 当前数据库文件路径
+	ClientId         int32         `json:"client_id"` // 授权的客户端ID
+	HeaderEntries    int           `json:"header_entries"`
+	IndexRecords     int           `json:"index_records"`
+	Columns          []string      `json:"columns"`           // 查询返回的列名称
+	AvailableColumns []string      `json:"available_columns"` // 地理映射中的所有列名称
+	Cache            db.CacheStats `json:"cache"`
+}
+
+// handleLookup 处理 GET /v1/lookup/{ip}
+func (handler *HTTPHandler) handleLookup(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	ip := strings.TrimPrefix(r.URL.Path, "/v1/lookup/")
+	if ip == "" {
+		writeError(w, http.StatusBadRequest, "missing ip in path")
+		return
+	}
+
+	addr, err := parseAddr(ip)
+	var result *db.GeoResult
+	if err == nil {
+		result, err = handler.searcher.SearchAddr(addr)
+	}
+	status := http.StatusOK
+	if err != nil {
+		status = handler.errorStatus(err)
+	}
+	writeJSON(w, status, newResult(ip, result, err))
+}
+
+// handleBatch 处理 POST /v1/lookup
+func (handler *HTTPHandler) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	ips, err := readBatch(http.MaxBytesReader(w, r.Body, handler.config.MaxBodySize), r.Header.Get("Content-Type"))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", handler.config.MaxBodySize))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(ips) > handler.config.MaxBatch {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("batch of %d ips exceeds the limit of %d", len(ips), handler.config.MaxBatch))
+		return
+	}
+
+	results, errs := lookupBatch(handler.searcher, ips)
+	response := batchResponse{Count: len(results), Results: results}
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			response.Found++
+		case !clientError(err):
+			// 整批查询共用同一个搜索器，服务端错误时整个请求失败
+			writeError(w, handler.errorStatus(err), errorMessage(err))
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// readBatch 读取批量查询的IP列表
+//
+// Content-Type 为 application/json 或请求体以 '[' 开头时按 JSON 字符串数组解析，
+// 否则按每行一个IP解析，忽略空行。
+func readBatch(body io.Reader, contentType string) ([]string, error) {
+	reader := bufio.NewReader(body)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	isJSON := mediaType == "application/json"
+	if !isJSON {
+		if first, err := peekNonSpace(reader); err == nil && first == '[' {
+			isJSON = true
+		} else if err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+
+	if isJSON {
+		var ips []string
+		if err := json.NewDecoder(reader).Decode(&ips); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("request body must be a JSON array of strings: %v", err)
+		}
+		return ips, nil
+	}
+
+	var ips []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			ips = append(ips, line)
+		}
+	}
+	return ips, scanner.Err()
+}
+
+// peekNonSpace 跳过开头的空白并返回第一个非空白字节，不消耗该字节
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return b, reader.UnreadByte()
+		}
+	}
+}
+
+// handleInfo 处理 GET /v1/info
+func (handler *HTTPHandler) handleInfo(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	health, err := newHealth(handler.searcher, handler.config.WarnDays)
+	if err != nil {
+		writeError(w, handler.errorStatus(err), errorMessage(err))
+		return
+	}
+
+	info := InfoResponse{Health: health, Path: handler.searcher.Path(), Columns: []string{}}
+	handler.searcher.Do(func(dbSearcher *db.DBSearcher) error {
+		info.ClientId = dbSearcher.DecryptedBlock.ClientId
+		info.HeaderEntries = dbSearcher.BtreeModeParam.HeaderLength
+		info.IndexRecords = int((dbSearcher.EndIndexPtr-dbSearcher.StartIndexPtr)/dbSearcher.IndexLength) + 1
+		for _, index := range db.SelectedColumns(dbSearcher.Selection()) {
+			info.Columns = append(info.Columns, db.ColumnName(dbSearcher.Schema, index))
+		}
+		info.AvailableColumns = dbSearcher.AvailableColumns()
+		info.Cache = dbSearcher.CacheStats()
+		return nil
+	})
+	writeJSON(w, http.StatusOK, info)
+}
+
+// handleHealth 处理 GET /healthz
+//
+// 授权即将过期或已过期时仍然返回 200，状态写在 status 字段中，
+// 以免授权到期导致所有实例同时被摘除；搜索器不可用时返回 503。
+func (handler *HTTPHandler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	health, err := newHealth(handler.searcher, handler.config.WarnDays)
+	if err != nil {
+		writeError(w, handler.errorStatus(err), errorMessage(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, health)
+}
+
+// errorStatus 返回错误对应的HTTP状态码，服务端错误会被记录
+func (handler *HTTPHandler) errorStatus(err error) int {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrInvalidIP), errors.Is(err, db.ErrIPVersionMismatch):
+		return http.StatusBadRequest
+	case errors.Is(err, db.ErrClosed):
+		return http.StatusServiceUnavailable
+	default:
+		handler.config.Logger.Printf("lookup failed: %v", err)
+		return http.StatusInternalServerError
+	}
+}
+
+// allowMethod 检查请求方法，GET 同时允许 HEAD，不允许时返回 405
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method || method == http.MethodGet && r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed")
+	return false
+}
+
+// writeJSON 以 JSON 格式写出响应
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+}
+
+// writeError 以 {"error": "..."} 的形式写出错误响应
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// NewHTTPServer 创建使用合理超时设置的 http.Server
+//
+// 参数:
+//   - addr: 监听地址，如 ":8080"
+//   - handler: 请求处理器
+//
+// 返回:
+//   - *http.Server: 尚未启动的服务器
+func NewHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      time.Minute,
+		IdleTimeout:       2 * time.Minute,
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// doRequest 发送请求并解析 JSON 响应
+func doRequest(t *testing.T, handler http.Handler, method, path, contentType, body string, out interface{}) int {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+		t.Errorf("%s %s: Content-Type = %q", method, path, got)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: 解析响应失败: %v\n%s", method, path, err, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+// TestHTTPLookup 测试单个IP查询的状态码和响应
+func TestHTTPLookup(t *testing.T) {
+	handler := NewHTTPHandler(openTestSearcher(t, 991231), HTTPConfig{})
+
+	tests := []struct {
+		path     string
+		status   int
+		expected Result
+	}{
+		{"/v1/lookup/1.0.2.3", http.StatusOK, Result{IP: "1.0.2.3", Found: true,
+			Columns: map[string]string{"country": "中国", "province": "福建", "city": "福州"}, Other: "电信"}},
+		{"/v1/lookup/::ffff:8.8.8.8", http.StatusOK, Result{IP: "::ffff:8.8.8.8", Found: true,
+			Columns: map[string]string{"country": "美国", "province": "", "city": ""}, Other: "Google"}},
+		{"/v1/lookup/9.9.9.9", http.StatusNotFound, Result{IP: "9.9.9.9", Error: "ip not found"}},
+		{"/v1/lookup/not-an-ip", http.StatusBadRequest, Result{IP: "not-an-ip", Error: `invalid ip address: "not-an-ip"`}},
+		{"/v1/lookup/2001:db8::1", http.StatusBadRequest, Result{IP: "2001:db8::1", Error: "ip version mismatch: expected IPv4 address but got IPv6: 2001:db8::1"}},
+	}
+	for _, test := range tests {
+		var result Result
+		status := doRequest(t, handler, http.MethodGet, test.path, "", "", &result)
+		if status != test.status {
+			t.Errorf("%s: 状态码 = %d, 期望 %d", test.path, status, test.status)
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s: 响应 = %+v, 期望 %+v", test.path, result, test.expected)
+		}
+	}
+
+	var body map[string]string
+	if status := doRequest(t, handler, http.MethodGet, "/v1/lookup/", "", "", &body); status != http.StatusBadRequest {
+		t.Errorf("缺少IP时状态码 = %d", status)
+	}
+	if status := doRequest(t, handler, http.MethodDelete, "/v1/lookup/8.8.8.8", "", "", &body); status != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE 状态码 = %d", status)
+	}
+	if status := doRequest(t, handler, http.MethodGet, "/v2/unknown", "", "", &body); status != http.StatusNotFound || body["error"] == "" {
+		t.Errorf("未知路径状态码 = %d, %v", status, body)
+	}
+}
+
+// TestHTTPBatch 测试 JSON 数组和按行分隔的批量查询
+func TestHTTPBatch(t *testing.T) {
+	handler := NewHTTPHandler(openTestSearcher(t, 991231), HTTPConfig{MaxBatch: 4, MaxBodySize: 256})
+
+	for _, request := range []struct {
+		contentType string
+		body        string
+	}{
+		{"application/json", `["223.5.5.5", "bad", "9.9.9.9", "1.0.1.1"]`},
+		{"", "  \n[\"223.5.5.5\",\"bad\",\"9.9.9.9\",\"1.0.1.1\"]"},
+		{"text/plain", "223.5.5.5\nbad\r\n\n9.9.9.9\n 1.0.1.1 \n"},
+	} {
+		var response batchResponse
+		status := doRequest(t, handler, http.MethodPost, "/v1/lookup", request.contentType, request.body, &response)
+		if status != http.StatusOK || response.Count != 4 || response.Found != 2 {
+			t.Fatalf("%q: 状态码 = %d, 响应 = %+v", request.body, status, response)
+		}
+		var summary []string
+		for _, result := range response.Results {
+			summary = append(summary, result.IP+" "+result.Columns["city"]+result.Error)
+		}
+		expected := []string{"223.5.5.5 杭州", `bad invalid ip address: "bad"`, "9.9.9.9 ip not found", "1.0.1.1 福州"}
+		if !reflect.DeepEqual(summary, expected) {
+			t.Errorf("%q: 结果 = %q", request.body, summary)
+		}
+	}
+
+	var body map[string]string
+	for _, test := range []struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		{"application/json", `{"ips": ["8.8.8.8"]}`, http.StatusBadRequest},
+		{"application/json", `["1.1.1.1","1.1.1.2","1.1.1.3","1.1.1.4","1.1.1.5"]`, http.StatusRequestEntityTooLarge},
+		{"text/plain", strings.Repeat("255.255.255.255\n", 20), http.StatusRequestEntityTooLarge},
+	} {
+		if status := doRequest(t, handler, http.MethodPost, "/v1/lookup", test.contentType, test.body, &body); status != test.status {
+			t.Errorf("%.30q: 状态码 = %d, 期望 %d (%v)", test.body, status, test.status, body)
+		}
+	}
+	if status := doRequest(t, handler, http.MethodGet, "/v1/lookup", "", "", &body); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET /v1/lookup 状态码 = %d", status)
+	}
+}
+
+// TestHTTPHealthAndInfo 测试健康检查中的版本和过期状态，以及数据库信息
+func TestHTTPHealthAndInfo(t *testing.T) {
+	searcher := openTestSearcher(t, 991231)
+	handler := NewHTTPHandler(searcher, HTTPConfig{})
+
+	var health Health
+	if status := doRequest(t, handler, http.MethodGet, "/healthz", "", "", &health); status != http.StatusOK {
+		t.Fatalf("/healthz 状态码 = %d", status)
+	}
+	if health.Status != StatusOK || health.IPVersion != 4 || health.DaysUntilExpiry == nil ||
+		!strings.HasPrefix(health.ExpiresAt, "2100-01-01T00:00:00") {
+		t.Errorf("/healthz = %+v", health)
+	}
+	// 不需要认证的健康检查不暴露文件路径和客户端ID
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if body := rec.Body.String(); strings.Contains(body, "path") || strings.Contains(body, "client_id") {
+		t.Errorf("/healthz 包含路径或客户端ID: %s", body)
+	}
+
+	// 剩余天数少于阈值
+	expiring := NewHTTPHandler(searcher, HTTPConfig{WarnDays: 1 << 30})
+	doRequest(t, expiring, http.MethodGet, "/healthz", "", "", &health)
+	if health.Status != StatusExpiring {
+		t.Errorf("剩余天数少于阈值时状态 = %q", health.Status)
+	}
+
+	// 授权已过期时仍然返回 200
+	expired := NewHTTPHandler(openTestSearcher(t, 200101), HTTPConfig{})
+	if status := doRequest(t, expired, http.MethodGet, "/healthz", "", "", &health); status != http.StatusOK || health.Status != StatusExpired || *health.DaysUntilExpiry >= 0 {
+		t.Errorf("授权过期时 /healthz = %d, %+v", status, health)
+	}
+
+	doRequest(t, handler, http.MethodGet, "/v1/lookup/8.8.8.8", "", "", nil)
+	doRequest(t, handler, http.MethodGet, "/v1/lookup/8.8.8.9", "", "", nil)
+	var info InfoResponse
+	if status := doRequest(t, handler, http.MethodGet, "/v1/info", "", "", &info); status != http.StatusOK {
+		t.Fatalf("/v1/info 状态码 = %d", status)
+	}
+	if info.Status != StatusOK || info.IndexRecords != 3 || !reflect.DeepEqual(info.Columns, []string{"country", "province", "city"}) ||
+		info.Cache.Capacity != 16 || info.Cache.Hits != 1 || info.ClientId != 42 || info.Path != searcher.Path() {
+		t.Errorf("/v1/info = %+v", info)
+	}
+
+	// 搜索器关闭后返回 503
+	searcher.Close()
+	quiet := NewHTTPHandler(searcher, HTTPConfig{Logger: log.New(io.Discard, "", 0)})
+	var body map[string]string
+	if status := doRequest(t, quiet, http.MethodGet, "/healthz", "", "", &body); status != http.StatusServiceUnavailable {
+		t.Errorf("关闭后 /healthz 状态码 = %d", status)
+	}
+	var result Result
+	if status := doRequest(t, quiet, http.MethodGet, "/v1/lookup/8.8.8.8", "", "", &result); status != http.StatusServiceUnavailable || result.Error != "searcher closed" {
+		t.Errorf("关闭后查询 = %d, %+v", status, result)
+	}
+}
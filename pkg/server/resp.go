@@ -0,0 +1,378 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+)
+
+// RESP 协议的限制
+const (
+	maxRESPLineLength = 64 << 10 // 内联命令及数组、字符串长度行的最大字节数
+	maxRESPBulkLength = 4 << 10  // 单个参数的最大字节数，IP地址远小于该值
+	minRESPArgs       = 1024     // 数组元素数的下限，使略超批量限制的请求能收到普通的错误回复
+)
+
+// RESPConfig Redis 协议查询服务的配置
+type RESPConfig struct {
+	MaxBatch    int           // GEOIP.MLOOKUP 一次最多查询的IP数，默认 DefaultMaxBatch
+	WarnDays    int           // 授权剩余天数少于该值时 GEOIP.INFO 的状态为 expiring，默认 DefaultWarnDays
+	IdleTimeout time.Duration // 连接空闲超过该时间后关闭，0 表示不限制
+	Logger      *log.Logger   // 记录服务端错误，默认使用 log.Default()
+}
+
+// RESPServer 使用 Redis 协议 (RESP2) 提供IP查询，任何 Redis 客户端都可以连接
+//
+// 支持的命令 (不区分大小写):
+//
+//	GEOIP.LOOKUP <ip>         返回 [列名, 列值, ..., "other", 其他数据]，未找到时返回 nil
+//	GEOIP.MLOOKUP <ip> [ip..] 返回与参数一一对应的数组，元素的格式与 GEOIP.LOOKUP 相同，IP无效时为错误
+//	GEOIP.INFO                返回 "名称:值" 形式的多行文本，与 Redis INFO 相同
+//	PING [message]            返回 PONG 或 message
+//	QUIT                      返回 OK 并关闭连接
+//
+// 所有连接共享同一个搜索器，每个连接由单独的 goroutine 处理，支持流水线请求。
+type RESPServer struct {
+	searcher *db.ReloadableSearcher
+	config   RESPConfig
+	tracker  connTracker
+}
+
+// NewRESPServer 创建 Redis 协议查询服务
+//
+// 参数:
+//   - searcher: 数据库搜索器，由调用方负责关闭
+//   - config: 服务配置，零值字段使用默认值
+//
+// 返回:
+//   - *RESPServer: 尚未启动的查询服务，使用 Serve 或 ListenAndServe 启动
+func NewRESPServer(searcher *db.ReloadableSearcher, config RESPConfig) *RESPServer {
+	if config.MaxBatch <= 0 {
+		config.MaxBatch = DefaultMaxBatch
+	}
+	if config.WarnDays <= 0 {
+		config.WarnDays = DefaultWarnDays
+	}
+	if config.Logger == nil {
+		config.Logger = log.Default()
+	}
+	return &RESPServer{searcher: searcher, config: config}
+}
+
+// ListenAndServe 监听 TCP 地址并处理连接
+//
+// 参数:
+//   - addr: 监听地址，如 ":6380"
+//
+// 返回:
+//   - error: 总是返回非 nil 的错误，Shutdown 或 Close 之后返回 ErrServerClosed
+func (server *RESPServer) ListenAndServe(addr string) error {
+	if server.tracker.closing.Load() {
+		return ErrServerClosed
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// Serve 在 listener 上接受连接，为每个连接启动一个 goroutine
+//
+// 参数:
+//   - listener: 监听器，Serve 返回时已被关闭
+//
+// 返回:
+//   - error: 总是返回非 nil 的错误，Shutdown 或 Close 之后返回 ErrServerClosed
+func (server *RESPServer) Serve(listener net.Listener) error {
+	return acceptLoop(&server.tracker, listener, server.config.Logger, server.serveConn)
+}
+
+// Shutdown 停止接受新连接，等待每个连接处理完当前命令后关闭
+//
+// 参数:
+//   - ctx: 等待的期限，到期后强制关闭剩余的连接
+//
+// 返回:
+//   - error: 等待期限到期时返回 ctx.Err()
+func (server *RESPServer) Shutdown(ctx context.Context) error {
+	return server.tracker.shutdown(ctx)
+}
+
+// Close 立即关闭所有监听器和连接
+func (server *RESPServer) Close() error {
+	return server.tracker.close()
+}
+
+// respProtocolError 表示客户端发送了不符合 RESP 的数据，回复错误后关闭连接
+type respProtocolError string
+
+func (err respProtocolError) Error() string {
+	return "Protocol error: " + string(err)
+}
+
+// serveConn 处理一个连接上的命令，直到客户端断开、发送 QUIT 或服务关闭
+func (server *RESPServer) serveConn(conn net.Conn) {
+	defer server.tracker.removeConn(conn)
+	defer conn.Close()
+
+	reader := bufio.NewReaderSize(conn, maxRESPLineLength)
+	maxArgs := server.config.MaxBatch + 1
+	if maxArgs < minRESPArgs {
+		maxArgs = minRESPArgs
+	}
+	writer := newRESPWriter(conn)
+	for {
+		if !server.tracker.waitRead(conn, server.config.IdleTimeout) {
+			return
+		}
+
+		args, err := readRESPCommand(reader, maxArgs)
+		if err != nil {
+			var protocolErr respProtocolError
+			if errors.As(err, &protocolErr) {
+				writer.writeError("ERR " + protocolErr.Error())
+				writer.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := server.execute(writer, args)
+		// 流水线请求中还有未处理的命令时合并写出
+		if quit || reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// execute 执行一条命令并写出回复，返回是否应关闭连接
+func (server *RESPServer) execute(writer *respWriter, args []string) bool {
+	name := strings.ToUpper(args[0])
+	arity := func(ok bool) bool {
+		if !ok {
+			writer.writeError("ERR wrong number of arguments for '" + strings.ToLower(args[0]) + "' command")
+		}
+		return ok
+	}
+
+	switch name {
+	case "GEOIP.LOOKUP":
+		if arity(len(args) == 2) {
+			addr, err := parseAddr(args[1])
+			var result *db.GeoResult
+			if err == nil {
+				result, err = server.searcher.SearchAddr(addr)
+			}
+			server.writeResult(writer, newResult(args[1], result, err), err)
+		}
+	case "GEOIP.MLOOKUP":
+		if !arity(len(args) >= 2) {
+			break
+		}
+		if len(args)-1 > server.config.MaxBatch {
+			writer.writeError(fmt.Sprintf("ERR batch of %d ips exceeds the limit of %d", len(args)-1, server.config.MaxBatch))
+			break
+		}
+		results, errs := lookupBatch(server.searcher, args[1:])
+		writer.writeArrayHeader(len(results))
+		for i := range results {
+			server.writeResult(writer, results[i], errs[i])
+		}
+	case "GEOIP.INFO":
+		if arity(len(args) == 1) {
+			server.writeInfo(writer)
+		}
+	case "PING":
+		switch len(args) {
+		case 1:
+			writer.writeSimple("PONG")
+		case 2:
+			writer.writeBulk(args[1])
+		default:
+			arity(false)
+		}
+	case "QUIT":
+		writer.writeSimple("OK")
+		return true
+	case "COMMAND":
+		// redis-cli 连接时会发送 COMMAND DOCS，返回空数组即可
+		writer.writeArrayHeader(0)
+	default:
+		writer.writeError("ERR unknown command '" + args[0] + "'")
+	}
+	return false
+}
+
+// writeResult 写出一个IP的查询结果，未找到时为 nil，IP无效等错误时为错误回复
+func (server *RESPServer) writeResult(writer *respWriter, result Result, err error) {
+	switch {
+	case err == nil:
+		writer.writeArrayHeader(len(result.Columns)*2 + 2)
+		// 按列的原始顺序写出，而不是 map 的随机顺序
+		for _, name := range result.names {
+			writer.writeBulk(name)
+			writer.writeBulk(result.Columns[name])
+		}
+		writer.writeBulk("other")
+		writer.writeBulk(result.Other)
+	case errors.Is(err, db.ErrNotFound):
+		writer.writeNil()
+	default:
+		if !clientError(err) && !errors.Is(err, db.ErrClosed) {
+			server.config.Logger.Printf("resp: lookup failed: %v", err)
+		}
+		writer.writeError("ERR " + result.Error)
+	}
+}
+
+// writeInfo 以 Redis INFO 的格式写出数据库信息
+func (server *RESPServer) writeInfo(writer *respWriter) {
+	health, err := newHealth(server.searcher, server.config.WarnDays)
+	if err != nil {
+		writer.writeError("ERR " + errorMessage(err))
+		return
+	}
+
+	var info strings.Builder
+	info.WriteString("# Database\r\n")
+	fmt.Fprintf(&info, "status:%s\r\n", health.Status)
+	fmt.Fprintf(&info, "ip_version:%d\r\n", health.IPVersion)
+	fmt.Fprintf(&info, "version:%d\r\n", health.Version)
+	if health.DaysUntilExpiry != nil {
+		fmt.Fprintf(&info, "expires_at:%s\r\n", health.ExpiresAt)
+		fmt.Fprintf(&info, "days_until_expiry:%d\r\n", *health.DaysUntilExpiry)
+	}
+	server.searcher.Do(func(dbSearcher *db.DBSearcher) error {
+		var columns []string
+		for _, index := range db.SelectedColumns(dbSearcher.Selection()) {
+			columns = append(columns, db.ColumnName(dbSearcher.Schema, index))
+		}
+		fmt.Fprintf(&info, "columns:%s\r\n", strings.Join(columns, ","))
+
+		stats := dbSearcher.CacheStats()
+		info.WriteString("\r\n# Cache\r\n")
+		fmt.Fprintf(&info, "cache_capacity:%d\r\n", stats.Capacity)
+		fmt.Fprintf(&info, "cache_entries:%d\r\n", stats.Entries)
+		fmt.Fprintf(&info, "cache_hits:%d\r\n", stats.Hits)
+		fmt.Fprintf(&info, "cache_misses:%d\r\n", stats.Misses)
+		fmt.Fprintf(&info, "cache_evictions:%d\r\n", stats.Evictions)
+		return nil
+	})
+	writer.writeBulk(info.String())
+}
+
+// readRESPCommand 读取一条命令，支持 RESP 字符串数组和以空白分隔的内联命令
+//
+// 数组超过 maxArgs 个元素或长度为负数时返回协议错误，以免客户端声明过大的数组耗尽内存；
+// 与 Redis 一致，*-1 和 *0 视为空命令。
+func readRESPCommand(reader *bufio.Reader, maxArgs int) ([]string, error) {
+	line, err := readRESPLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		// 内联命令，便于使用 telnet 或 nc 调试
+		return strings.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, respProtocolError("invalid multibulk length")
+	}
+	if count == -1 || count == 0 {
+		return nil, nil
+	}
+	if count < 0 {
+		return nil, respProtocolError("invalid multibulk length")
+	}
+	if count > maxArgs {
+		return nil, respProtocolError(fmt.Sprintf("too many arguments, the limit is %d", maxArgs))
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		line, err := readRESPLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, respProtocolError(fmt.Sprintf("expected '$', got %q", line))
+		}
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 || length > maxRESPBulkLength {
+			return nil, respProtocolError("invalid bulk length")
+		}
+		buf := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		if buf[length] != '\r' || buf[length+1] != '\n' {
+			return nil, respProtocolError("bulk string is not terminated by CRLF")
+		}
+		args = append(args, string(buf[:length]))
+	}
+	return args, nil
+}
+
+// readRESPLine 读取一行并去掉末尾的 \r\n
+func readRESPLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", respProtocolError("too big request")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// respWriter 写出 RESP2 格式的回复
+type respWriter struct {
+	*bufio.Writer
+}
+
+// newRESPWriter 创建带缓冲的回复写出器，调用方需调用 Flush
+func newRESPWriter(w io.Writer) *respWriter {
+	return &respWriter{bufio.NewWriter(w)}
+}
+
+// writeSimple 写出简单字符串，如 +OK
+func (writer *respWriter) writeSimple(value string) {
+	writer.WriteString("+" + value + "\r\n")
+}
+
+// writeError 写出错误，错误信息中的换行替换为空格
+func (writer *respWriter) writeError(message string) {
+	writer.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(message) + "\r\n")
+}
+
+// writeBulk 写出二进制安全的字符串
+func (writer *respWriter) writeBulk(value string) {
+	writer.WriteString("$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n")
+}
+
+// writeNil 写出 nil 字符串
+func (writer *respWriter) writeNil() {
+	writer.WriteString("$-1\r\n")
+}
+
+// writeArrayHeader 写出数组的长度，之后需写出 n 个元素
+func (writer *respWriter) writeArrayHeader(n int) {
+	writer.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// respError 是客户端收到的错误回复
+type respError string
+
+// respClient 是测试用的 RESP2 客户端
+type respClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// startRESPServer 在回环地址上启动服务，测试结束时关闭
+func startRESPServer(t *testing.T, config RESPConfig) (*RESPServer, string, <-chan error) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	if config.Logger == nil {
+		config.Logger = log.New(io.Discard, "", 0)
+	}
+	server := NewRESPServer(openTestSearcher(t, 991231), config)
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+	t.Cleanup(func() { server.Close() })
+	return server, listener.Addr().String(), served
+}
+
+// dialRESP 连接服务
+func dialRESP(t *testing.T, addr string) *respClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	t.Cleanup(func() { conn.Close() })
+	return &respClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// send 以 RESP 数组的形式发送命令，不等待回复
+func (client *respClient) send(args ...string) {
+	client.t.Helper()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	client.write(sb.String())
+}
+
+// write 发送原始数据
+func (client *respClient) write(data string) {
+	client.t.Helper()
+
+	if _, err := io.WriteString(client.conn, data); err != nil {
+		client.t.Fatalf("发送命令失败: %v", err)
+	}
+}
+
+// do 发送命令并读取回复
+func (client *respClient) do(args ...string) interface{} {
+	client.t.Helper()
+
+	client.send(args...)
+	return client.read()
+}
+
+// read 读取一个回复：简单字符串和字符串为 string，错误为 respError，整数为 int64，
+// nil 为 nil，数组为 []interface{}
+func (client *respClient) read() interface{} {
+	client.t.Helper()
+
+	reply, err := readRESPReply(client.reader)
+	if err != nil {
+		client.t.Fatalf("读取回复失败: %v", err)
+	}
+	return reply
+}
+
+// readRESPReply 解析一个 RESP2 回复
+func readRESPReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(line, "\r\n") || len(line) < 3 {
+		return nil, fmt.Errorf("回复行格式错误: %q", line)
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return respError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		buf := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:length]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, count)
+		for i := range values {
+			if values[i], err = readRESPReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("未知的回复类型: %q", line)
+}
+
+// fields 将字符串列表转换为数组回复，便于比较
+func fields(values ...string) []interface{} {
+	reply := make([]interface{}, len(values))
+	for i, value := range values {
+		reply[i] = value
+	}
+	return reply
+}
+
+// TestRESPCommands 测试各命令的回复
+func TestRESPCommands(t *testing.T) {
+	_, addr, _ := startRESPServer(t, RESPConfig{MaxBatch: 4})
+	client := dialRESP(t, addr)
+
+	fuzhou := fields("country", "中国", "province", "福建", "city", "福州", "other", "电信")
+	hangzhou := fields("country", "中国", "province", "浙江", "city", "杭州", "other", "阿里云")
+	tests := []struct {
+		args     []string
+		expected interface{}
+	}{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"ping", "你好"}, "你好"},
+		{[]string{"GEOIP.LOOKUP", "1.0.2.3"}, fuzhou},
+		{[]string{"geoip.lookup", "::ffff:8.8.8.8"}, fields("country", "美国", "province", "", "city", "", "other", "Google")},
+		{[]string{"GEOIP.LOOKUP", "9.9.9.9"}, nil},
+		{[]string{"GEOIP.LOOKUP", "bad"}, respError(`ERR invalid ip address: "bad"`)},
+		{[]string{"GEOIP.LOOKUP", "2001:db8::1"}, respError("ERR ip version mismatch: expected IPv4 address but got IPv6: 2001:db8::1")},
+		{[]string{"GEOIP.LOOKUP"}, respError("ERR wrong number of arguments for 'geoip.lookup' command")},
+		{[]string{"GEOIP.MLOOKUP", "223.5.5.5", "bad", "9.9.9.9", "1.0.1.1"},
+			[]interface{}{hangzhou, respError(`ERR invalid ip address: "bad"`), nil, fuzhou}},
+		{[]string{"GEOIP.MLOOKUP", "1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.4", "1.1.1.5"},
+			respError("ERR batch of 5 ips exceeds the limit of 4")},
+		{[]string{"GEOIP.MLOOKUP"}, respError("ERR wrong number of arguments for 'geoip.mlookup' command")},
+		{[]string{"GET", "key"}, respError("ERR unknown command 'GET'")},
+	}
+	for _, test := range tests {
+		if reply := client.do(test.args...); !reflect.DeepEqual(reply, test.expected) {
+			t.Errorf("%q: 回复 = %#v, 期望 %#v", test.args, reply, test.expected)
+		}
+	}
+
+	info, ok := client.do("GEOIP.INFO").(string)
+	for _, line := range []string{"status:ok\r\n", "ip_version:4\r\n", "columns:country,province,city\r\n", "cache_capacity:16\r\n"} {
+		if !ok || !strings.Contains(info, line) {
+			t.Errorf("GEOIP.INFO 缺少 %q:\n%s", line, info)
+		}
+	}
+	if strings.Contains(info, "path:") || strings.Contains(info, "client_id:") {
+		t.Errorf("GEOIP.INFO 不应包含路径或客户端ID:\n%s", info)
+	}
+
+	if reply := client.do("QUIT"); reply != "OK" {
+		t.Errorf("QUIT 回复 = %#v", reply)
+	}
+	if _, err := client.reader.ReadByte(); err != io.EOF {
+		t.Errorf("QUIT 之后连接未关闭: %v", err)
+	}
+}
+
+// TestRESPPipelineAndConcurrency 测试流水线请求、内联命令和多个并发连接
+func TestRESPPipelineAndConcurrency(t *testing.T) {
+	_, addr, _ := startRESPServer(t, RESPConfig{})
+
+	// 一次写出多条命令，按顺序读取回复
+	client := dialRESP(t, addr)
+	client.write("PING\r\nGEOIP.LOOKUP 8.8.8.8\r\n\r\n")
+	client.send("GEOIP.LOOKUP", "223.5.5.5")
+	client.send("GEOIP.MLOOKUP", "9.9.9.9")
+	expected := []interface{}{
+		"PONG",
+		fields("country", "美国", "province", "", "city", "", "other", "Google"),
+		fields("country", "中国", "province", "浙江", "city", "杭州", "other", "阿里云"),
+		[]interface{}{nil},
+	}
+	for i, want := range expected {
+		if reply := client.read(); !reflect.DeepEqual(reply, want) {
+			t.Errorf("第 %d 个回复 = %#v, 期望 %#v", i, reply, want)
+		}
+	}
+
+	cities := map[string]string{"1.0.1.9": "福州", "8.8.8.8": "", "223.5.5.200": "杭州"}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+			reader := bufio.NewReader(conn)
+			for j := 0; j < 50; j++ {
+				for ip, city := range cities {
+					fmt.Fprintf(conn, "*2\r\n$12\r\nGEOIP.LOOKUP\r\n$%d\r\n%s\r\n", len(ip), ip)
+					reply, err := readRESPReply(reader)
+					if err != nil {
+						errs <- err
+						return
+					}
+					values, ok := reply.([]interface{})
+					if !ok || len(values) != 8 || values[5] != city {
+						errs <- fmt.Errorf("%s: 回复 = %#v", ip, reply)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestRESPProtocolError 测试格式错误的请求会收到错误回复并被关闭连接
+func TestRESPProtocolError(t *testing.T) {
+	_, addr, _ := startRESPServer(t, RESPConfig{MaxBatch: 2000})
+
+	for _, request := range []string{
+		"*1\r\n+PING\r\n",
+		"*1\r\n$99999\r\n",
+		"*1\r\n$4\r\nPINGxx",
+		"*2002\r\n",
+		"*x\r\n",
+		"*-2\r\n",
+	} {
+		client := dialRESP(t, addr)
+		client.write(request)
+		if reply, ok := client.read().(respError); !ok || !strings.HasPrefix(string(reply), "ERR Protocol error") {
+			t.Errorf("%q: 回复 = %#v", request, reply)
+		}
+		if _, err := client.reader.ReadByte(); err != io.EOF {
+			t.Errorf("%q: 协议错误后连接未关闭: %v", request, err)
+		}
+	}
+
+	// *-1 和 *0 是空命令，不回复也不关闭连接
+	client := dialRESP(t, addr)
+	client.write("*-1\r\n*0\r\n")
+	if reply := client.do("PING"); reply != "PONG" {
+		t.Errorf("空命令之后 PING 回复 = %#v", reply)
+	}
+}
+
+// TestRESPShutdown 测试关闭服务时空闲连接被关闭，Serve 返回 ErrServerClosed
+func TestRESPShutdown(t *testing.T) {
+	server, addr, served := startRESPServer(t, RESPConfig{})
+	client := dialRESP(t, addr)
+	if reply := client.do("PING"); reply != "PONG" {
+		t.Fatalf("PING 回复 = %#v", reply)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown 失败: %v", err)
+	}
+	if err := <-served; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Serve 返回 %v", err)
+	}
+	if _, err := client.reader.ReadByte(); err != io.EOF {
+		t.Errorf("关闭服务后连接未关闭: %v", err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("关闭服务后仍然可以连接")
+	}
+	if err := server.ListenAndServe("127.0.0.1:0"); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("关闭后 ListenAndServe 返回 %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Package server 通过网络协议提供IP查询服务，数据库由 db.ReloadableSearcher 提供并支持热加载
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/tagphi/czdb-search-golang/pkg/db"
+)
+
+// Result 是一个IP的查询结果
+type Result struct {
+	IP      string            `json:"ip"`                // 查询的IP地址，与请求中的写法一致
+	Found   bool              `json:"found"`             // 是否找到包含该IP的区间
+	Columns map[string]string `json:"columns,omitempty"` // 按列名称的地理信息
+	Other   string            `json:"other,omitempty"`   // 数据记录中的其他数据
+	Error   string            `json:"error,omitempty"`   // 查询失败的原因
+
+	names []string // Columns 的键，按列顺序排列
+}
+
+// newResult 将查询结果或错误转换为 Result
+func newResult(ip string, result *db.GeoResult, err error) Result {
+	if err != nil {
+		return Result{IP: ip, Error: errorMessage(err)}
+	}
+	names := make([]string, len(result.Columns))
+	for i := range result.Columns {
+		names[i] = result.Name(i)
+	}
+	return Result{IP: ip, Found: true, Columns: result.Map(), Other: result.OtherData, names: names}
+}
+
+// errorMessage 返回可以展示给客户端的错误信息，内部错误不暴露细节
+func errorMessage(err error) string {
+	switch {
+	case errors.Is(err, db.ErrNotFound), errors.Is(err, db.ErrInvalidIP),
+		errors.Is(err, db.ErrIPVersionMismatch), errors.Is(err, db.ErrClosed):
+		return err.Error()
+	default:
+		return "internal error"
+	}
+}
+
+// clientError 判断错误是否由请求中的IP引起，而不是服务端的问题
+func clientError(err error) bool {
+	return errors.Is(err, db.ErrNotFound) || errors.Is(err, db.ErrInvalidIP) || errors.Is(err, db.ErrIPVersionMismatch)
+}
+
+// parseAddr 解析IP地址，失败时返回包装了 db.ErrInvalidIP 的错误
+func parseAddr(ip string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%w: %q", db.ErrInvalidIP, ip)
+	}
+	return addr, nil
+}
+
+// lookupBatch 批量查询，无法解析的IP不参与查询，结果按输入顺序返回
+func lookupBatch(searcher *db.ReloadableSearcher, ips []string) ([]Result, []error) {
+	results := make([]Result, len(ips))
+	errs := make([]error, len(ips))
+	addrs := make([]netip.Addr, 0, len(ips))
+	positions := make([]int, 0, len(ips))
+	for i, ip := range ips {
+		addr, err := parseAddr(ip)
+		if err != nil {
+			results[i], errs[i] = newResult(ip, nil, err), err
+			continue
+		}
+		addrs = append(addrs, addr)
+		positions = append(positions, i)
+	}
+
+	geoResults, geoErrs := searcher.SearchBatch(addrs)
+	for j, i := range positions {
+		results[i], errs[i] = newResult(ips[i], &geoResults[j], geoErrs[j]), geoErrs[j]
+	}
+	return results, errs
+}
+
+// Health 是数据库的健康状态
+//
+// 健康检查不需要认证，因此不包含文件路径和客户端ID，这些信息只在 /v1/info 中返回。
+type Health struct {
+	Status          string `json:"status"`                      // ok、expiring (剩余天数少于阈值) 或 expired
+	IPVersion       int    `json:"ip_version"`                  // 4 或 6
+	Version         int32  `json:"version"`                     // 数据库版本
+	ExpiresAt       string `json:"expires_at,omitempty"`        // 授权失效的时间，RFC 3339 格式
+	DaysUntilExpiry *int   `json:"days_until_expiry,omitempty"` // 剩余天数，0 表示今天是最后一天
+}
+
+// Health 状态值
+const (
+	StatusOK       = "ok"
+	StatusExpiring = "expiring"
+	StatusExpired  = "expired"
+)
+
+// newHealth 收集当前数据库的健康状态
+//
+// 参数:
+//   - searcher: 数据库搜索器
+//   - warnDays: 剩余天数少于该值时状态为 expiring
+//
+// 返回:
+//   - Health: 健康状态
+//   - error: 搜索器已关闭时返回 db.ErrClosed
+func newHealth(searcher *db.ReloadableSearcher, warnDays int) (Health, error) {
+	var health Health
+	err := searcher.Do(func(dbSearcher *db.DBSearcher) error {
+		health = Health{
+			Status:    StatusOK,
+			IPVersion: int(dbSearcher.IPType),
+			Version:   dbSearcher.HyperHeader.Version,
+		}
+		if expiresAt := dbSearcher.ExpiresAt(); !expiresAt.IsZero() {
+			days := dbSearcher.DaysUntilExpiry()
+			health.ExpiresAt = expiresAt.Format(time.RFC3339)
+			health.DaysUntilExpiry = &days
+			if dbSearcher.Expired() {
+				health.Status = StatusExpired
+			} else if days < warnDays {
+				health.Status = StatusExpiring
+			}
+		}
+		return nil
+	})
+	return health, err
+}